@@ -12,6 +12,8 @@ import (
 type AddRequest struct {
 	Entry    *Entry
 	Controls []Control
+	// ResponseControls are set by Add from the AddResponse.
+	ResponseControls []Control
 }
 
 func (req *AddRequest) RecordType() uint8 {
@@ -34,7 +36,19 @@ func (l *LDAPConnection) Add(req *AddRequest) error {
 		return err
 	}
 
-	return l.sendReqRespPacket(messageID, packet)
+	req.ResponseControls, err = l.sendReqRespPacket(messageID, packet)
+	if referrals, ok := l.isReferral(err); ok {
+		return l.chaseReferrals(referrals, func(conn *LDAPConnection, lu *LDAPURL) error {
+			entry := *req.Entry
+			entry.DN = referralDN(entry.DN, lu)
+			referred := *req
+			referred.Entry = &entry
+			err := conn.Add(&referred)
+			req.ResponseControls = referred.ResponseControls
+			return err
+		})
+	}
+	return err
 }
 
 /*
@@ -0,0 +1,193 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains attribute description parsing and matching
+package ldap
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+/*
+RFC 4512 2.5
+
+	attributedescription = attributetype options
+	attributetype = oid
+	options = *( SEMI option )
+	option = 1*keychar
+
+Active Directory also uses range=<low>-<high|*> as an option.
+*/
+var attributeTypeRegex = regexp.MustCompile(`^(?:[A-Za-z][-A-Za-z0-9]*|(?:0|[1-9][0-9]*)(?:\.(?:0|[1-9][0-9]*))+)$`)
+var attributeOptionRegex = regexp.MustCompile(`^(?:[-A-Za-z0-9]+|[Rr][Aa][Nn][Gg][Ee]=[0-9]+-(?:[0-9]+|\*))$`)
+
+// AttributeDescription is an attribute type with its options e.g.
+// userCertificate;binary or cn;lang-en.
+type AttributeDescription struct {
+	Type    string
+	Options []string
+}
+
+var (
+	defaultAttributeAliases     AttributeAliases
+	defaultAttributeAliasesLock sync.RWMutex
+)
+
+// SetDefaultAttributeAliases sets the aliases used by attribute description
+// matching, Entry lookups, filter matching and normalization and DN matching
+// to treat attribute type names and OIDs as equivalent, nil for none. See
+// StandardAttributeAliases and Schema. The setting is shared by all
+// connections, so set it once before use, e.g. from the schema of the server
+// used. aliases is copied, later changes to it have no effect.
+func SetDefaultAttributeAliases(aliases AttributeAliases) {
+	var copied AttributeAliases
+	if aliases != nil {
+		copied = make(AttributeAliases, len(aliases))
+		for name, canonical := range aliases {
+			copied[name] = canonical
+		}
+	}
+	defaultAttributeAliasesLock.Lock()
+	defaultAttributeAliases = copied
+	defaultAttributeAliasesLock.Unlock()
+}
+
+// DefaultAttributeAliases returns the aliases set by
+// SetDefaultAttributeAliases, nil if none. It must not be modified.
+func DefaultAttributeAliases() AttributeAliases {
+	defaultAttributeAliasesLock.RLock()
+	defer defaultAttributeAliasesLock.RUnlock()
+	return defaultAttributeAliases
+}
+
+// ParseAttributeDescription parses and validates an attribute description.
+func ParseAttributeDescription(desc string) (*AttributeDescription, error) {
+	ad := splitAttributeDescription(desc)
+	if !attributeTypeRegex.MatchString(ad.Type) {
+		return nil, NewLDAPError(ErrorInvalidArgument, "Invalid attribute type: "+desc)
+	}
+	for _, option := range ad.Options {
+		if !attributeOptionRegex.MatchString(option) {
+			return nil, NewLDAPError(ErrorInvalidArgument, "Invalid attribute option: "+desc)
+		}
+	}
+	return ad, nil
+}
+
+// splitAttributeDescription splits without validation, used for lookups.
+func splitAttributeDescription(desc string) *AttributeDescription {
+	parts := strings.Split(desc, ";")
+	return &AttributeDescription{Type: parts[0], Options: parts[1:]}
+}
+
+func (ad *AttributeDescription) String() string {
+	if len(ad.Options) == 0 {
+		return ad.Type
+	}
+	return ad.Type + ";" + strings.Join(ad.Options, ";")
+}
+
+// HasOption - case-insensitive check for an option.
+func (ad *AttributeDescription) HasOption(option string) bool {
+	for _, o := range ad.Options {
+		if strings.EqualFold(o, option) {
+			return true
+		}
+	}
+	return false
+}
+
+// Equal is true for the same attribute type (ignoring case and, with
+// SetDefaultAttributeAliases, alias names or OIDs) and the same set of options.
+func (ad *AttributeDescription) Equal(other *AttributeDescription) bool {
+	return len(ad.Options) == len(other.Options) && ad.Matches(other)
+}
+
+// Matches is true if ad is query or a subtype of it i.e. the same attribute
+// type and ad has all of the options of query e.g. userCertificate;binary
+// matches userCertificate.
+func (ad *AttributeDescription) Matches(query *AttributeDescription) bool {
+	if !attributeTypesEqual(ad.Type, query.Type) {
+		return false
+	}
+	for _, option := range query.Options {
+		if !ad.HasOption(option) {
+			return false
+		}
+	}
+	return true
+}
+
+func attributeTypesEqual(a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	aliases := DefaultAttributeAliases()
+	if aliases == nil {
+		return false
+	}
+	return aliases.Canonical(a) == aliases.Canonical(b)
+}
+
+// AttributeDescriptionsEqual compares two attribute description strings, see
+// AttributeDescription.Equal.
+func AttributeDescriptionsEqual(a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	return splitAttributeDescription(a).Equal(splitAttributeDescription(b))
+}
+
+// AttributeAliases maps attribute type names and OIDs to a canonical form, so
+// that e.g. cn, commonName and 2.5.4.3 are equivalent. Keys are lower case.
+type AttributeAliases map[string]string
+
+// Add makes names, attribute type names and/or an OID, equivalent.
+func (aa AttributeAliases) Add(names ...string) {
+	if len(names) == 0 {
+		return
+	}
+	canonical := aa.Canonical(names[0])
+	for _, name := range names {
+		aa[strings.ToLower(name)] = canonical
+	}
+}
+
+// Canonical returns the canonical form of an attribute type name or OID,
+// unknown names are returned in lower case.
+func (aa AttributeAliases) Canonical(name string) string {
+	lower := strings.ToLower(name)
+	if canonical, ok := aa[lower]; ok {
+		return canonical
+	}
+	return lower
+}
+
+// StandardAttributeAliases returns the aliases and OIDs of common RFC 4519
+// attribute types.
+func StandardAttributeAliases() AttributeAliases {
+	aa := make(AttributeAliases)
+	aa.Add("2.5.4.0", "objectClass")
+	aa.Add("2.5.4.1", "aliasedObjectName", "aliasedEntryName")
+	aa.Add("2.5.4.3", "cn", "commonName")
+	aa.Add("2.5.4.4", "sn", "surname")
+	aa.Add("2.5.4.6", "c", "countryName")
+	aa.Add("2.5.4.7", "l", "localityName")
+	aa.Add("2.5.4.8", "st", "stateOrProvinceName")
+	aa.Add("2.5.4.9", "street", "streetAddress")
+	aa.Add("2.5.4.10", "o", "organizationName")
+	aa.Add("2.5.4.11", "ou", "organizationalUnitName")
+	aa.Add("2.5.4.12", "title")
+	aa.Add("2.5.4.13", "description")
+	aa.Add("2.5.4.20", "telephoneNumber")
+	aa.Add("2.5.4.31", "member")
+	aa.Add("2.5.4.35", "userPassword")
+	aa.Add("2.5.4.42", "givenName", "gn")
+	aa.Add("0.9.2342.19200300.100.1.1", "uid", "userid")
+	aa.Add("0.9.2342.19200300.100.1.3", "mail", "rfc822Mailbox")
+	aa.Add("0.9.2342.19200300.100.1.25", "dc", "domainComponent")
+	return aa
+}
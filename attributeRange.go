@@ -0,0 +1,114 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains Active Directory ranged attribute retrieval
+package ldap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AD returns large multi-valued attributes in ranges e.g. member;range=0-1499,
+// the last range has an end of "*" e.g. member;range=1500-*.
+const rangeOption = "range="
+
+// SearchWithRangedAttributes is Search followed by FetchRangedAttributes for
+// every returned entry.
+func (l *LDAPConnection) SearchWithRangedAttributes(searchRequest *SearchRequest) (*SearchResult, error) {
+	result, err := l.Search(searchRequest)
+	if err != nil {
+		return result, err
+	}
+	for _, entry := range result.Entries {
+		if err := l.FetchRangedAttributes(entry); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// FetchRangedAttributes finds attributes of entry with a ;range= option,
+// retrieves the remaining values with base searches on the entry and merges
+// all values under the attribute name without the range option. A range that
+// is empty or does not end after the previous one is an error.
+func (l *LDAPConnection) FetchRangedAttributes(entry *Entry) error {
+	attributes := make([]*EntryAttribute, 0, len(entry.Attributes))
+	for _, attr := range entry.Attributes {
+		name, _, high, ok := parseRangeOption(attr.Name)
+		if !ok {
+			attributes = append(attributes, attr)
+			continue
+		}
+		values := attr.Values
+		for high >= 0 {
+			previous := high
+			var more []string
+			var err error
+			more, high, err = l.fetchAttributeRange(entry.DN, name, high+1)
+			if err != nil {
+				return err
+			}
+			// a server repeating a range would be asked for it forever
+			if high >= 0 && (high <= previous || len(more) == 0) {
+				return NewLDAPError(ErrorDecoding,
+					fmt.Sprintf("Ranged attribute %s of %s did not progress past %d", name, entry.DN, previous))
+			}
+			values = append(values, more...)
+		}
+		attributes = append(attributes, &EntryAttribute{Name: name, Values: values})
+	}
+	entry.Attributes = attributes
+	return nil
+}
+
+// fetchAttributeRange requests attrName;range=low-* of dn, returns the
+// values and the end of the returned range, -1 for the last range.
+func (l *LDAPConnection) fetchAttributeRange(dn, attrName string, low int) (values []string, high int, err error) {
+	rangeAttr := fmt.Sprintf("%s;%s%d-*", attrName, rangeOption, low)
+	req := NewSimpleSearchRequest(dn, ScopeBaseObject, "(objectclass=*)", []string{rangeAttr})
+	result, err := l.Search(req)
+	if err != nil {
+		return nil, -1, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, -1, NewLDAPError(ErrorDecoding, "Ranged attribute search did not return the entry: "+dn)
+	}
+	for _, attr := range result.Entries[0].Attributes {
+		name, _, high, ok := parseRangeOption(attr.Name)
+		if ok && strings.EqualFold(name, attrName) {
+			return attr.Values, high, nil
+		}
+	}
+	// no more values
+	return nil, -1, nil
+}
+
+// parseRangeOption splits a range option from an attribute description.
+// high is -1 for an end of "*". ok is false if there is no range option.
+func parseRangeOption(attrDesc string) (name string, low, high int, ok bool) {
+	options := strings.Split(attrDesc, ";")
+	for i, option := range options {
+		if i == 0 || !strings.HasPrefix(strings.ToLower(option), rangeOption) {
+			continue
+		}
+		bounds := strings.SplitN(option[len(rangeOption):], "-", 2)
+		if len(bounds) != 2 {
+			return attrDesc, 0, 0, false
+		}
+		var err error
+		if low, err = strconv.Atoi(bounds[0]); err != nil {
+			return attrDesc, 0, 0, false
+		}
+		if bounds[1] == "*" {
+			high = -1
+		} else if high, err = strconv.Atoi(bounds[1]); err != nil {
+			return attrDesc, 0, 0, false
+		}
+		name = strings.Join(append(options[:i:i], options[i+1:]...), ";")
+		return name, low, high, true
+	}
+	return attrDesc, 0, 0, false
+}
@@ -0,0 +1,112 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"fmt"
+	"github.com/mavricknz/asn1-ber"
+	"strconv"
+	"testing"
+)
+
+func TestParseRangeOption(t *testing.T) {
+	tests := []struct {
+		desc      string
+		name      string
+		low, high int
+		ok        bool
+	}{
+		{"member;range=0-1499", "member", 0, 1499, true},
+		{"member;Range=1500-*", "member", 1500, -1, true},
+		{"member;binary;range=10-20", "member;binary", 10, 20, true},
+		{"member", "member", 0, 0, false},
+		{"member;range=a-*", "member;range=a-*", 0, 0, false},
+	}
+	for _, test := range tests {
+		name, low, high, ok := parseRangeOption(test.desc)
+		if name != test.name || low != test.low || high != test.high || ok != test.ok {
+			t.Errorf("%s: got %s %d %d %t", test.desc, name, low, high, ok)
+		}
+	}
+}
+
+func TestSearchWithRangedAttributes(t *testing.T) {
+	const total, rangeSize = 7, 3
+	requested := make([]string, 0)
+	l := newTestConnection(t, func(request *ber.Packet) []*ber.Packet {
+		if request.Children[1].Tag != ApplicationSearchRequest {
+			return nil
+		}
+		low := 0
+		attrs := request.Children[1].Children[7].Children
+		if len(attrs) > 0 {
+			attr := attrs[0].Value.(string)
+			requested = append(requested, attr)
+			_, low, _, _ = parseRangeOption(attr)
+		}
+		high := low + rangeSize - 1
+		end := strconv.Itoa(high)
+		if high >= total-1 {
+			high, end = total-1, "*"
+		}
+		e := NewEntry("cn=group,o=example")
+		e.AddAttributeValue("cn", "group")
+		name := fmt.Sprintf("member;range=%d-%s", low, end)
+		for i := low; i <= high; i++ {
+			e.AddAttributeValue(name, strconv.Itoa(i))
+		}
+		return []*ber.Packet{
+			testResponse(request, testEntry(e), nil),
+			testResponse(request, testResult(ApplicationSearchResultDone, LDAPResultSuccess, ""), nil),
+		}
+	})
+	defer l.Close()
+
+	sr, err := l.SearchWithRangedAttributes(NewSimpleSearchRequest("o=example", ScopeWholeSubtree, "(cn=group)", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := sr.Entries[0].GetAttributeValues("member")
+	if len(members) != total {
+		t.Fatalf("expected %d members got %d: %v", total, len(members), sr.Entries[0])
+	}
+	for i, m := range members {
+		if m != strconv.Itoa(i) {
+			t.Errorf("member %d out of order: %s", i, m)
+		}
+	}
+	if len(requested) != 2 || requested[0] != "member;range=3-*" || requested[1] != "member;range=6-*" {
+		t.Errorf("unexpected range requests %v", requested)
+	}
+	if len(sr.Entries[0].Attributes) != 2 {
+		t.Errorf("ranged attribute names not removed: %v", sr.Entries[0])
+	}
+}
+
+func TestFetchRangedAttributesNoProgress(t *testing.T) {
+	for _, name := range []string{"member;range=0-2", "member;range=3-1", "member;range=3-5"} {
+		searches := 0
+		l := newTestConnection(t, func(request *ber.Packet) []*ber.Packet {
+			searches++
+			e := NewEntry("cn=group,o=example")
+			if name == "member;range=3-5" {
+				e.Attributes = append(e.Attributes, &EntryAttribute{Name: name})
+			} else {
+				e.AddAttributeValue(name, "x")
+			}
+			return []*ber.Packet{
+				testResponse(request, testEntry(e), nil),
+				testResponse(request, testResult(ApplicationSearchResultDone, LDAPResultSuccess, ""), nil),
+			}
+		})
+		entry := NewEntry("cn=group,o=example")
+		entry.AddAttributeValue("member;range=0-2", "0")
+		err := l.FetchRangedAttributes(entry)
+		l.Close()
+		if err == nil || searches != 1 {
+			t.Errorf("%s: expected an error after 1 search, got %v after %d", name, err, searches)
+		}
+	}
+}
@@ -14,20 +14,30 @@ Simple bind to the server. If using a timeout you should close the connection
 on a bind failure.
 */
 func (l *LDAPConnection) Bind(username, password string) error {
+	_, err := l.BindWithControls(username, password, nil)
+	return err
+}
+
+/*
+Simple bind sending controls with the request. Returns any controls from the
+BindResponse, also on a bind failure e.g. password policy responses.
+*/
+func (l *LDAPConnection) BindWithControls(username, password string, controls []Control) ([]Control, error) {
 	messageID, ok := l.nextMessageID()
 	if !ok {
-		return NewLDAPError(ErrorClosing, "MessageID channel is closed.")
+		return nil, NewLDAPError(ErrorClosing, "MessageID channel is closed.")
 	}
 
 	encodedBind := encodeSimpleBindRequest(username, password)
 
-	packet, err := requestBuildPacket(messageID, encodedBind, nil)
+	packet, err := requestBuildPacket(messageID, encodedBind, controls)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	// also reset on failure, the connection is then anonymous
+	defer l.resetRootDSE()
 	return l.sendReqRespPacket(messageID, packet)
-
 }
 
 func encodeSimpleBindRequest(username, password string) (bindRequest *ber.Packet) {
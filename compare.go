@@ -18,11 +18,14 @@ AttributeValueAssertion ::= SEQUENCE {
     assertionValue  AssertionValue }
 */
 
+// Value is sent as is, it may hold binary data (see NewCompareRequestBytes).
 type CompareRequest struct {
 	DN       string
 	Name     string
 	Value    string
 	Controls []Control
+	// ResponseControls are set by Compare from the CompareResponse.
+	ResponseControls []Control
 }
 
 func (l *LDAPConnection) Compare(req *CompareRequest) (bool, error) {
@@ -43,7 +46,19 @@ func (l *LDAPConnection) Compare(req *CompareRequest) (bool, error) {
 
 	// CompareTrue = 6, CompareFalse = 5
 	// returns an "Error"
-	err = l.sendReqRespPacket(messageID, packet)
+	req.ResponseControls, err = l.sendReqRespPacket(messageID, packet)
+	if referrals, ok := l.isReferral(err); ok {
+		var result bool
+		err = l.chaseReferrals(referrals, func(conn *LDAPConnection, lu *LDAPURL) error {
+			referred := *req
+			referred.DN = referralDN(req.DN, lu)
+			var err error
+			result, err = conn.Compare(&referred)
+			req.ResponseControls = referred.ResponseControls
+			return err
+		})
+		return result, err
+	}
 	if lerr, ok := err.(*LDAPError); ok {
 		return lerr.ResultCode == LDAPResultCompareTrue, nil
 	} else {
@@ -55,10 +70,10 @@ func (l *LDAPConnection) Compare(req *CompareRequest) (bool, error) {
 func encodeCompareRequest(req *CompareRequest) (*ber.Packet, error) {
 	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationCompareRequest, nil, ApplicationMap[ApplicationCompareRequest])
 	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, req.DN, "LDAP DN"))
-	ava, err := encodeItem([]string{req.Name, "=", req.Value})
-	if err != nil {
-		return nil, err
-	}
+	// The value is not a filter value, no unescaping or wildcards.
+	ava := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "AttributeValueAssertion")
+	ava.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, req.Name, "AttributeDesc"))
+	ava.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, req.Value, "AssertionValue"))
 	p.AppendChild(ava)
 	return p, nil
 }
@@ -67,3 +82,7 @@ func NewCompareRequest(dn, name, value string) (req *CompareRequest) {
 	req = &CompareRequest{DN: dn, Name: name, Value: value, Controls: make([]Control, 0)}
 	return
 }
+
+func NewCompareRequestBytes(dn, name string, value []byte) (req *CompareRequest) {
+	return NewCompareRequest(dn, name, string(value))
+}
@@ -24,6 +24,7 @@ import (
 //	AbandonMessageOnReadTimeout bool // send abandon on a ReadTimeout (not for searches yet)
 //	Network        string // default empty "tcp"
 //	Addr           string // default empty
+//	ReferralConfig *ReferralConfig // default nil, referrals are not chased
 //
 // A minimal connection...
 //	ldap := NewLDAPConnection("localhost",389)
@@ -40,6 +41,8 @@ type LDAPConnection struct {
 
 	TlsConfig *tls.Config
 
+	ReferralConfig *ReferralConfig
+
 	conn               net.Conn
 	chanResults        map[uint64]chan *ber.Packet
 	lockChanResults    sync.RWMutex
@@ -47,6 +50,9 @@ type LDAPConnection struct {
 	closeLock          sync.RWMutex
 	chanMessageID      chan uint64
 	connected          bool
+	referralChain      []string // the origin server and referrals followed to reach this connection
+	rootDSE            *RootDSE // read by GetRootDSE
+	rootDSELock        sync.Mutex
 }
 
 // Connect connects using information in LDAPConnection.
@@ -156,7 +162,7 @@ func (l *LDAPConnection) startTLS() error {
 		return err
 	}
 
-	err = l.sendReqRespPacket(messageID, packet)
+	_, err = l.sendReqRespPacket(messageID, packet)
 	if err != nil {
 		return err
 	}
@@ -168,13 +174,14 @@ func (l *LDAPConnection) startTLS() error {
 	}
 	l.IsSSL = true
 	l.conn = conn
+	l.resetRootDSE()
 
 	return nil
 }
 
 func encodeTLSRequest() (tlsRequest *ber.Packet) {
 	tlsRequest = ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationExtendedRequest, nil, "Start TLS")
-	tlsRequest.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, 0, "1.3.6.1.4.1.1466.20037", "TLS Extended Command"))
+	tlsRequest.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, 0, ExtensionStartTLS, "TLS Extended Command"))
 	return
 }
 
@@ -8,6 +8,8 @@ package ldap
 import (
 	"fmt"
 	"github.com/mavricknz/asn1-ber"
+	"strings"
+	"sync"
 )
 
 const (
@@ -17,6 +19,7 @@ const (
 	ControlTypeManageDsaITRequest      = "2.16.840.1.113730.3.4.2"
 	ControlTypeSubtreeDeleteRequest    = "1.2.840.113556.1.4.805"
 	ControlTypeNoOpRequest             = "1.3.6.1.4.1.4203.1.10.2"
+	ControlTypeRelaxRulesRequest       = "1.3.6.1.4.1.4203.666.5.12"
 	ControlTypeServerSideSortRequest   = "1.2.840.113556.1.4.473"
 	ControlTypeServerSideSortResponse  = "1.2.840.113556.1.4.474"
 	ControlTypeVlvRequest              = "2.16.840.1.113730.3.4.9"
@@ -43,6 +46,8 @@ const (
 //
 )
 
+// ControlTypeMap names control types for descriptions and String() output.
+// Use RegisterControl to add to it.
 var ControlTypeMap = map[string]string{
 	ControlTypeMatchedValuesRequest:    "MatchedValuesRequest",
 	ControlTypePermissiveModifyRequest: "PermissiveModifyRequest",
@@ -50,16 +55,95 @@ var ControlTypeMap = map[string]string{
 	ControlTypeManageDsaITRequest:      "ManageDsaITRequest",
 	ControlTypeSubtreeDeleteRequest:    "SubtreeDeleteRequest",
 	ControlTypeNoOpRequest:             "NoOpRequest",
+	ControlTypeRelaxRulesRequest:       "RelaxRulesRequest",
 	ControlTypeServerSideSortRequest:   "ServerSideSortRequest",
 	ControlTypeServerSideSortResponse:  "ServerSideSortResponse",
 	ControlTypeVlvRequest:              "VlvRequest",
 	ControlTypeVlvResponse:             "VlvResponse",
 }
 
+// ControlDecodeMap holds the decoders used by DecodeControl, keyed by control
+// type. Request controls are included so that a server or proxy can decode
+// the controls of a request. Use RegisterControl to add to it.
 var ControlDecodeMap = map[string]func(p *ber.Packet) (Control, error){
 	ControlTypeServerSideSortResponse: NewControlServerSideSortResponse,
 	ControlTypePaging:                 NewControlPagingFromPacket,
 	ControlTypeVlvResponse:            NewControlVlvResponse,
+	ControlTypeServerSideSortRequest:  NewControlServerSideSortRequestFromPacket,
+	ControlTypeVlvRequest:             NewControlVlvRequestFromPacket,
+	ControlTypeMatchedValuesRequest:   NewControlMatchedValuesRequestFromPacket,
+}
+
+var controlDecodeLock sync.RWMutex
+
+// RegisterControl sets decodeFunc as the decoder for response controls of
+// controlType, replacing any existing decoder. If name is not empty it is
+// added to ControlTypeMap for descriptions and String() output.
+// Normally called from an init function, before any connections are used.
+func RegisterControl(controlType, name string, decodeFunc func(p *ber.Packet) (Control, error)) {
+	controlDecodeLock.Lock()
+	defer controlDecodeLock.Unlock()
+	ControlDecodeMap[controlType] = decodeFunc
+	if len(name) > 0 {
+		ControlTypeMap[controlType] = name
+	}
+}
+
+// controlTypeName returns the ControlTypeMap name of controlType, "" if it
+// has none.
+func controlTypeName(controlType string) string {
+	controlDecodeLock.RLock()
+	defer controlDecodeLock.RUnlock()
+	return ControlTypeMap[controlType]
+}
+
+// DecodeControl decodes a single Control packet with the decoder registered
+// for its control type. Controls without a decoder are returned as a
+// *ControlString holding the raw control value and criticality.
+func DecodeControl(p *ber.Packet) (Control, error) {
+	return decodeControl(p, true)
+}
+
+// decodeControl decodes p with the registered decoder if registered is true
+// and there is one, otherwise as a *ControlString.
+func decodeControl(p *ber.Packet, registered bool) (control Control, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			control = nil
+			err = NewLDAPError(ErrorDecoding, fmt.Sprintf("Error decoding Control: %v", r))
+		}
+	}()
+	controlType := p.Children[0].Value.(string)
+
+	decodeFunc := NewControlStringFromPacket
+	if registered {
+		controlDecodeLock.RLock()
+		if registeredFunc, present := ControlDecodeMap[controlType]; present {
+			decodeFunc = registeredFunc
+		}
+		controlDecodeLock.RUnlock()
+	}
+	return decodeFunc(p)
+}
+
+// decodeResponseControls decodes the optional controls of an LDAPMessage
+// packet, returns nil if the message has none. A control its decoder fails
+// on is returned as a *ControlString, so that it does not hide the result.
+func decodeResponseControls(packet *ber.Packet) ([]Control, error) {
+	if len(packet.Children) < 3 {
+		return nil, nil
+	}
+	controls := make([]Control, 0, len(packet.Children[2].Children))
+	for _, child := range packet.Children[2].Children {
+		c, err := DecodeControl(child)
+		if err != nil {
+			if c, err = decodeControl(child, false); err != nil {
+				return nil, err
+			}
+		}
+		controls = append(controls, c)
+	}
+	return controls, nil
 }
 
 // Control Interface
@@ -80,7 +164,9 @@ func NewControlStringFromPacket(p *ber.Packet) (Control, error) {
 	c := new(ControlString)
 	c.ControlType = controlType
 	c.Criticality = criticality
-	c.ControlValue = value.Value.(string)
+	if value != nil {
+		c.ControlValue = string(value.Data.Bytes())
+	}
 	return c, nil
 }
 
@@ -90,7 +176,7 @@ func (c *ControlString) GetControlType() string {
 
 func (c *ControlString) Encode() (p *ber.Packet, err error) {
 	p = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
-	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, c.ControlType, "Control Type ("+ControlTypeMap[c.ControlType]+")"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, c.ControlType, "Control Type ("+controlTypeName(c.ControlType)+")"))
 	if c.Criticality {
 		p.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimative, ber.TagBoolean, c.Criticality, "Criticality"))
 	}
@@ -101,12 +187,13 @@ func (c *ControlString) Encode() (p *ber.Packet, err error) {
 }
 
 func (c *ControlString) String() string {
-	return fmt.Sprintf("Control Type: %s (%q)  Criticality: %t  Control Value: %s", ControlTypeMap[c.ControlType], c.ControlType, c.Criticality, c.ControlValue)
+	return fmt.Sprintf("Control Type: %s (%q)  Criticality: %t  Control Value: %s", controlTypeName(c.ControlType), c.ControlType, c.Criticality, c.ControlValue)
 }
 
 type ControlPaging struct {
-	PagingSize uint32
-	Cookie     []byte
+	PagingSize  uint32
+	Cookie      []byte
+	Criticality bool
 }
 
 func NewControlPaging(PagingSize uint32) *ControlPaging {
@@ -114,18 +201,15 @@ func NewControlPaging(PagingSize uint32) *ControlPaging {
 }
 
 func NewControlPagingFromPacket(p *ber.Packet) (Control, error) {
-	_, _, value := decodeControlTypeAndCrit(p)
-	value.Description += " (Paging)"
-	c := new(ControlPaging)
-
-	if value.Value != nil {
-		value_children := ber.DecodePacket(value.Data.Bytes())
-		value.Data.Truncate(0)
-		value.Value = nil
-		value.AppendChild(value_children)
+	_, criticality, value := decodeControlTypeAndCrit(p)
+	c := &ControlPaging{Criticality: criticality}
+	if value != nil {
+		value.Description += " (Paging)"
+	}
+	value = decodeControlValue(value, "Search Control Value")
+	if value == nil || len(value.Children) < 2 {
+		return nil, NewLDAPError(ErrorDecoding, "Invalid Paging control value")
 	}
-	value = value.Children[0]
-	value.Description = "Search Control Value"
 	value.Children[0].Description = "Paging Size"
 	value.Children[1].Description = "Cookie"
 	c.PagingSize = uint32(value.Children[0].Value.(uint64))
@@ -140,7 +224,10 @@ func (c *ControlPaging) GetControlType() string {
 
 func (c *ControlPaging) Encode() (p *ber.Packet, err error) {
 	p = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
-	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, ControlTypePaging, "Control Type ("+ControlTypeMap[ControlTypePaging]+")"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, ControlTypePaging, "Control Type ("+controlTypeName(ControlTypePaging)+")"))
+	if c.Criticality {
+		p.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimative, ber.TagBoolean, c.Criticality, "Criticality"))
+	}
 
 	p2 := ber.Encode(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, nil, "Control Value (Paging)")
 	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Search Control Value")
@@ -158,9 +245,9 @@ func (c *ControlPaging) Encode() (p *ber.Packet, err error) {
 func (c *ControlPaging) String() string {
 	return fmt.Sprintf(
 		"Control Type: %s (%q)  Criticality: %t  PagingSize: %d  Cookie: %q",
-		ControlTypeMap[ControlTypePaging],
+		controlTypeName(ControlTypePaging),
 		ControlTypePaging,
-		false,
+		c.Criticality,
 		c.PagingSize,
 		c.Cookie)
 }
@@ -226,21 +313,57 @@ func ReplaceControl(controls []Control, control Control) (oldControl Control) {
 //	return c
 //}
 
+// value is nil if the control has no controlValue.
 func decodeControlTypeAndCrit(p *ber.Packet) (controlType string, criticality bool, value *ber.Packet) {
 	controlType = p.Children[0].Value.(string)
-	p.Children[0].Description = "Control Type (" + ControlTypeMap[controlType] + ")"
+	p.Children[0].Description = "Control Type (" + controlTypeName(controlType) + ")"
 	criticality = false
-	if len(p.Children) == 3 {
+	switch len(p.Children) {
+	case 3:
 		criticality = p.Children[1].Value.(bool)
 		p.Children[1].Description = "Criticality"
 		value = p.Children[2]
-	} else {
+	case 2:
+		if p.Children[1].Tag == ber.TagBoolean {
+			criticality = p.Children[1].Value.(bool)
+			p.Children[1].Description = "Criticality"
+			return
+		}
 		value = p.Children[1]
+	default:
+		return
 	}
 	value.Description = "Control Value"
 	return
 }
 
+// decodeControlValue decodes the BER encoded controlValue of a control. The
+// raw bytes are replaced by the decoded packet as a child, so the control
+// prints with ber.PrintPacket. Returns the decoded packet, nil if there is
+// no value.
+func decodeControlValue(value *ber.Packet, description string) *ber.Packet {
+	if value == nil {
+		return nil
+	}
+	if value.Data.Len() > 0 {
+		decoded := ber.DecodePacket(value.Data.Bytes())
+		value.Data.Truncate(0)
+		value.Value = nil
+		value.AppendChild(decoded)
+	}
+	if len(value.Children) == 0 {
+		return nil
+	}
+	value.Children[0].Description = description
+	return value.Children[0]
+}
+
+// decodeControlBoolean - a BOOLEAN, also when it is context specific and
+// has no decoded Value.
+func decodeControlBoolean(p *ber.Packet) bool {
+	return strings.Trim(packetString(p), "\x00") != ""
+}
+
 func NewControlString(ControlType string, Criticality bool, ControlValue string) *ControlString {
 	return &ControlString{
 		ControlType:  ControlType,
@@ -293,21 +416,83 @@ func NewControlNoOpRequest() *ControlString {
 	return NewControlString(ControlTypeNoOpRequest, true, "")
 }
 
+/*********************/
+/* RelaxRulesRequest */
+/*********************/
+
+func NewControlRelaxRulesRequest(criticality bool) *ControlString {
+	return NewControlString(ControlTypeRelaxRulesRequest, criticality, "")
+}
+
 /************************/
 /* MatchedValuesRequest */
 /************************/
 
+/*
+ValuesReturnFilter ::= SEQUENCE OF SimpleFilterItem
+
+SimpleFilterItem ::= CHOICE {
+        equalityMatch   [3] AttributeValueAssertion,
+        substrings      [4] SubstringFilter,
+        greaterOrEqual  [5] AttributeValueAssertion,
+        lessOrEqual     [6] AttributeValueAssertion,
+        present         [7] AttributeDescription,
+        approxMatch     [8] AttributeValueAssertion,
+        extensibleMatch [9] SimpleMatchingAssertion }
+*/
+
+// ControlMatchedValuesRequest - RFC 3876. The ValuesReturnFilter is Filter,
+// if not empty, followed by Filters. Each is a single SimpleFilterItem, and,
+// or and not filters are not allowed.
 type ControlMatchedValuesRequest struct {
 	Criticality bool
 	Filter      string
+	Filters     []string
 }
 
 func NewControlMatchedValuesRequest(criticality bool, filter string) *ControlMatchedValuesRequest {
-	return &ControlMatchedValuesRequest{criticality, filter}
+	return &ControlMatchedValuesRequest{Criticality: criticality, Filter: filter}
+}
+
+// NewControlMatchedValuesRequestFromPacket decodes a MatchedValuesRequest.
+// The first SimpleFilterItem is returned as Filter, any others as Filters.
+func NewControlMatchedValuesRequestFromPacket(p *ber.Packet) (Control, error) {
+	_, criticality, value := decodeControlTypeAndCrit(p)
+	items := decodeControlValue(value, "ValuesReturnFilter")
+	if items == nil || len(items.Children) == 0 {
+		return nil, NewLDAPError(ErrorDecoding, "Invalid MatchedValuesRequest control value")
+	}
+	c := NewControlMatchedValuesRequest(criticality, "")
+	for i, item := range items.Children {
+		if !isSimpleFilterItem(item) {
+			return nil, NewLDAPError(ErrorDecoding, "Invalid MatchedValuesRequest SimpleFilterItem")
+		}
+		f, err := DecodeFilter(item)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			c.Filter = f.String()
+		} else {
+			c.Filters = append(c.Filters, f.String())
+		}
+	}
+	return c, nil
+}
+
+func isSimpleFilterItem(p *ber.Packet) bool {
+	return p.ClassType == ber.ClassContext && p.Tag != FilterAnd && p.Tag != FilterOr && p.Tag != FilterNot
 }
 
+// Decode sets c from the control packet p.
 func (c *ControlMatchedValuesRequest) Decode(p *ber.Packet) (*Control, error) {
-	return nil, NewLDAPError(ErrorDecoding, "Decode of Control unsupported.")
+	decoded, err := NewControlMatchedValuesRequestFromPacket(p)
+	if err != nil {
+		return nil, err
+	}
+	*c = *decoded.(*ControlMatchedValuesRequest)
+	var control Control = c
+	return &control, nil
 }
 
 func (c *ControlMatchedValuesRequest) GetControlType() string {
@@ -315,22 +500,34 @@ func (c *ControlMatchedValuesRequest) GetControlType() string {
 }
 
 func (c *ControlMatchedValuesRequest) Encode() (p *ber.Packet, err error) {
+	filters := c.Filters
+	if len(c.Filter) > 0 {
+		filters = append([]string{c.Filter}, filters...)
+	}
+	if len(filters) == 0 {
+		return nil, NewLDAPError(ErrorEncoding, "MatchedValuesRequest without a filter")
+	}
 	p = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "ControlMatchedValuesRequest")
 	p.AppendChild(
 		ber.NewString(ber.ClassUniversal, ber.TypePrimative,
 			ber.TagOctetString, ControlTypeMatchedValuesRequest,
-			"Control Type ("+ControlTypeMap[ControlTypeMatchedValuesRequest]+")"))
+			"Control Type ("+controlTypeName(ControlTypeMatchedValuesRequest)+")"))
 	if c.Criticality {
 		p.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimative, ber.TagBoolean, c.Criticality, "Criticality"))
 	}
 	octetString := ber.Encode(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, nil, "Octet String")
-	simpleFilterSeq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SimpleFilterItem")
-	filterPacket, err := filterParse(c.Filter)
-	if err != nil {
-		return nil, err
+	valuesReturnFilter := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "ValuesReturnFilter")
+	for _, filter := range filters {
+		filterPacket, err := CompileFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if !isSimpleFilterItem(filterPacket) {
+			return nil, NewLDAPError(ErrorEncoding, "MatchedValuesRequest filter is not a SimpleFilterItem: "+filter)
+		}
+		valuesReturnFilter.AppendChild(filterPacket)
 	}
-	simpleFilterSeq.AppendChild(filterPacket)
-	octetString.AppendChild(simpleFilterSeq)
+	octetString.AppendChild(valuesReturnFilter)
 	p.AppendChild(octetString)
 	return p, nil
 }
@@ -338,10 +535,10 @@ func (c *ControlMatchedValuesRequest) Encode() (p *ber.Packet, err error) {
 func (c *ControlMatchedValuesRequest) String() string {
 	return fmt.Sprintf(
 		"Control Type: %s (%q)  Criticality: %t  Filter: %s",
-		ControlTypeMap[ControlTypeMatchedValuesRequest],
+		controlTypeName(ControlTypeMatchedValuesRequest),
 		ControlTypeMatchedValuesRequest,
 		c.Criticality,
-		c.Filter,
+		strings.Join(append([]string{c.Filter}, c.Filters...), ""),
 	)
 }
 
@@ -372,8 +569,45 @@ func NewControlServerSideSortRequest(sortKeyList []ServerSideSortAttrRuleOrder,
 	return &ControlServerSideSortRequest{sortKeyList, criticality}
 }
 
+// NewControlServerSideSortRequestFromPacket decodes a ServerSideSortRequest.
+func NewControlServerSideSortRequestFromPacket(p *ber.Packet) (Control, error) {
+	_, criticality, value := decodeControlTypeAndCrit(p)
+	sortKeyList := decodeControlValue(value, "SortKeyLists")
+	if sortKeyList == nil {
+		return nil, NewLDAPError(ErrorDecoding, "Invalid ServerSideSortRequest control value")
+	}
+	c := &ControlServerSideSortRequest{Criticality: criticality}
+	for _, seqKey := range sortKeyList.Children {
+		if len(seqKey.Children) == 0 {
+			return nil, NewLDAPError(ErrorDecoding, "ServerSideSortRequest sort key without an attribute")
+		}
+		seqKey.Description = "SortKey"
+		seqKey.Children[0].Description = "AttributeDescription"
+		sortKey := ServerSideSortAttrRuleOrder{AttributeName: packetString(seqKey.Children[0])}
+		for _, child := range seqKey.Children[1:] {
+			switch child.Tag {
+			case 0:
+				child.Description = "OrderingRule"
+				sortKey.OrderingRule = packetString(child)
+			case 1:
+				child.Description = "ReverseOrder"
+				sortKey.ReverseOrder = decodeControlBoolean(child)
+			}
+		}
+		c.SortKeyList = append(c.SortKeyList, sortKey)
+	}
+	return c, nil
+}
+
+// Decode sets c from the control packet p.
 func (c *ControlServerSideSortRequest) Decode(p *ber.Packet) (*Control, error) {
-	return nil, NewLDAPError(ErrorDecoding, "Decode of Control unsupported.")
+	decoded, err := NewControlServerSideSortRequestFromPacket(p)
+	if err != nil {
+		return nil, err
+	}
+	*c = *decoded.(*ControlServerSideSortRequest)
+	var control Control = c
+	return &control, nil
 }
 
 func (c *ControlServerSideSortRequest) GetControlType() string {
@@ -385,7 +619,7 @@ func (c *ControlServerSideSortRequest) Encode() (p *ber.Packet, err error) {
 	p.AppendChild(
 		ber.NewString(ber.ClassUniversal, ber.TypePrimative,
 			ber.TagOctetString, ControlTypeServerSideSortRequest,
-			"Control Type ("+ControlTypeMap[ControlTypeServerSideSortRequest]+")"))
+			"Control Type ("+controlTypeName(ControlTypeServerSideSortRequest)+")"))
 	if c.Criticality {
 		p.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimative, ber.TagBoolean, c.Criticality, "Criticality"))
 	}
@@ -399,12 +633,14 @@ func (c *ControlServerSideSortRequest) Encode() (p *ber.Packet, err error) {
 		)
 		if len(sortKey.OrderingRule) > 0 {
 			seqKey.AppendChild(
-				ber.NewString(ber.ClassUniversal, ber.TypePrimative, 0, sortKey.OrderingRule, "OrderingRule"),
+				ber.NewString(ber.ClassContext, ber.TypePrimative, 0, sortKey.OrderingRule, "OrderingRule"),
+			)
+		}
+		if sortKey.ReverseOrder {
+			seqKey.AppendChild(
+				ber.NewBoolean(ber.ClassContext, ber.TypePrimative, 1, sortKey.ReverseOrder, "ReverseOrder"),
 			)
 		}
-		seqKey.AppendChild(
-			ber.NewBoolean(ber.ClassUniversal, ber.TypePrimative, 1, sortKey.ReverseOrder, "ReverseOrder"),
-		)
 		seqSortKeyLists.AppendChild(seqKey)
 	}
 	octetString.AppendChild(seqSortKeyLists)
@@ -415,7 +651,7 @@ func (c *ControlServerSideSortRequest) Encode() (p *ber.Packet, err error) {
 func (c *ControlServerSideSortRequest) String() string {
 	ctext := fmt.Sprintf(
 		"Control Type: %s (%q)  Criticality: %t, SortKeys: ",
-		ControlTypeMap[ControlTypeServerSideSortRequest],
+		controlTypeName(ControlTypeServerSideSortRequest),
 		ControlTypeServerSideSortRequest,
 		c.Criticality,
 	)
@@ -456,12 +692,60 @@ type ControlVlvRequest struct {
 	ContextID          []byte
 }
 
+// NewControlVlvRequestFromPacket decodes a VirtualListViewRequest.
+func NewControlVlvRequestFromPacket(p *ber.Packet) (Control, error) {
+	_, criticality, value := decodeControlTypeAndCrit(p)
+	vlvSeq := decodeControlValue(value, "VirtualListViewRequest")
+	if vlvSeq == nil || len(vlvSeq.Children) < 3 {
+		return nil, NewLDAPError(ErrorDecoding, "Invalid VlvRequest control value")
+	}
+	vlvSeq.Children[0].Description = "BeforeCount"
+	vlvSeq.Children[1].Description = "AfterCount"
+	c := &ControlVlvRequest{
+		Criticality: criticality,
+		BeforeCount: int32(vlvSeq.Children[0].Value.(uint64)),
+		AfterCount:  int32(vlvSeq.Children[1].Value.(uint64)),
+	}
+	target := vlvSeq.Children[2]
+	switch {
+	case target.Tag == 0 && len(target.Children) == 2:
+		target.Description = "ByOffset"
+		target.Children[0].Description = "Offset"
+		target.Children[1].Description = "ContentCount"
+		c.ByOffset = &VlvOffSet{
+			Offset:       int32(target.Children[0].Value.(uint64)),
+			ContentCount: int32(target.Children[1].Value.(uint64)),
+		}
+	case target.Tag == 1:
+		target.Description = "GreaterThanOrEqual"
+		c.GreaterThanOrEqual = packetString(target)
+	default:
+		return nil, NewLDAPError(ErrorDecoding, "Invalid VlvRequest target")
+	}
+	if len(vlvSeq.Children) > 3 {
+		vlvSeq.Children[3].Description = "ContextID"
+		c.ContextID = []byte(packetString(vlvSeq.Children[3]))
+	}
+	return c, nil
+}
+
+// Decode sets c from the control packet p.
+func (c *ControlVlvRequest) Decode(p *ber.Packet) (*Control, error) {
+	decoded, err := NewControlVlvRequestFromPacket(p)
+	if err != nil {
+		return nil, err
+	}
+	*c = *decoded.(*ControlVlvRequest)
+	var control Control = c
+	return &control, nil
+}
+
 func (c *ControlVlvRequest) Encode() (*ber.Packet, error) {
 	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "ControlVlvRequest")
 	p.AppendChild(
 		ber.NewString(ber.ClassUniversal, ber.TypePrimative,
 			ber.TagOctetString, ControlTypeVlvRequest,
-			"Control Type ("+ControlTypeMap[ControlTypeVlvRequest]+")"))
+			"Control Type ("+controlTypeName(ControlTypeVlvRequest)+")"))
 	if c.Criticality {
 		p.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimative, ber.TagBoolean, c.Criticality, "Criticality"))
 	}
@@ -507,17 +791,21 @@ func (c *ControlVlvRequest) Encode() (*ber.Packet, error) {
 }
 
 func (c *ControlVlvRequest) GetControlType() string {
-	return ControlTypeMap[ControlTypeVlvRequest]
+	return ControlTypeVlvRequest
 }
 
 func (c *ControlVlvRequest) String() string {
+	byOffset := VlvOffSet{}
+	if c.ByOffset != nil {
+		byOffset = *c.ByOffset
+	}
 	ctext := fmt.Sprintf(
 		"Control Type: %s (%q)  Criticality: %t, BeforeCount: %d, AfterCount: %d"+
 			", ByOffset.Offset: %d, ByOffset.ContentCount: %d, GreaterThanOrEqual: %s",
-		ControlTypeMap[ControlTypeVlvRequest],
+		controlTypeName(ControlTypeVlvRequest),
 		ControlTypeVlvRequest,
-		c.Criticality, c.BeforeCount, c.AfterCount, c.ByOffset.Offset,
-		c.ByOffset.ContentCount, c.GreaterThanOrEqual,
+		c.Criticality, c.BeforeCount, c.AfterCount, byOffset.Offset,
+		byOffset.ContentCount, c.GreaterThanOrEqual,
 	)
 	return ctext
 }
@@ -533,7 +821,28 @@ func (c *ControlVlvRequest) String() string {
 type ControlServerSideSortResponse struct {
 	AttributeName string // Optional
 	Criticality   bool
-	Err           error
+	SortResult    SortResultCode
+}
+
+// SortResultCode - the sortResult of a ServerSideSortResponse, one of the
+// LDAP result codes listed below.
+type SortResultCode uint8
+
+func (r SortResultCode) String() string {
+	return LDAPResultCodeMap[uint8(r)]
+}
+
+// SortError returns nil if the results were sorted, else an *LDAPError with
+// the SortResult code.
+func (c *ControlServerSideSortResponse) SortError() error {
+	if c.SortResult == LDAPResultSuccess {
+		return nil
+	}
+	text := "Server side sort failed"
+	if len(c.AttributeName) > 0 {
+		text += " for " + c.AttributeName
+	}
+	return NewLDAPError(uint8(c.SortResult), text)
 }
 
 //SortResult ::= SEQUENCE {
@@ -564,30 +873,39 @@ func NewControlServerSideSortResponse(p *ber.Packet) (Control, error) {
 	_, criticality, value := decodeControlTypeAndCrit(p)
 	c.Criticality = criticality
 
-	if value.Value != nil {
-		sortResult := ber.DecodePacket(value.Data.Bytes())
-		value.Data.Truncate(0)
-		value.Value = nil
-		value.AppendChild(sortResult)
+	value = decodeControlValue(value, "ServerSideSortResponse Control Value")
+	if value == nil || len(value.Children) == 0 {
+		return nil, NewLDAPError(ErrorDecoding, "Invalid ServerSideSortResponse control value")
 	}
-
-	value = value.Children[0]
-	value.Description = "ServerSideSortResponse Control Value"
-
 	value.Children[0].Description = "SortResult"
-	errNum := uint8(value.Children[0].Value.(uint64))
-	c.Err = NewLDAPError(errNum, "")
+	c.SortResult = SortResultCode(value.Children[0].Value.(uint64))
 
 	if len(value.Children) == 2 {
 		value.Children[1].Description = "Attribute Name"
-		c.AttributeName = value.Children[1].Value.(string)
-		value.Children[1].Value = c.AttributeName
+		c.AttributeName = packetString(value.Children[1])
 	}
 	return c, nil
 }
 
 func (c *ControlServerSideSortResponse) Encode() (p *ber.Packet, err error) {
-	return nil, NewLDAPError(ErrorEncoding, "Encode of Control unsupported.")
+	p = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "ControlServerSideSortResponse")
+	p.AppendChild(
+		ber.NewString(ber.ClassUniversal, ber.TypePrimative,
+			ber.TagOctetString, ControlTypeServerSideSortResponse,
+			"Control Type ("+controlTypeName(ControlTypeServerSideSortResponse)+")"))
+	if c.Criticality {
+		p.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimative, ber.TagBoolean, c.Criticality, "Criticality"))
+	}
+	octetString := ber.Encode(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, nil, "Octet String")
+	sortResult := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SortResult")
+	sortResult.AppendChild(
+		ber.NewInteger(ber.ClassUniversal, ber.TypePrimative, ber.TagEnumerated, uint64(c.SortResult), "SortResult"))
+	if len(c.AttributeName) > 0 {
+		sortResult.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, 0, c.AttributeName, "Attribute Name"))
+	}
+	octetString.AppendChild(sortResult)
+	p.AppendChild(octetString)
+	return p, nil
 }
 
 func (c *ControlServerSideSortResponse) GetControlType() string {
@@ -595,12 +913,13 @@ func (c *ControlServerSideSortResponse) GetControlType() string {
 }
 
 func (c *ControlServerSideSortResponse) String() string {
-	return fmt.Sprintf("Control Type: %s (%q)  Criticality: %t, AttributeName: %s, ErrorValue: %d",
-		ControlTypeMap[ControlTypeServerSideSortResponse],
+	return fmt.Sprintf("Control Type: %s (%q)  Criticality: %t, AttributeName: %s, SortResult: %d (%s)",
+		controlTypeName(ControlTypeServerSideSortResponse),
 		ControlTypeServerSideSortResponse,
 		c.Criticality,
 		c.AttributeName,
-		c.Err.(*LDAPError).ResultCode,
+		c.SortResult,
+		c.SortResult,
 	)
 }
 
@@ -612,10 +931,38 @@ type ControlVlvResponse struct {
 	Criticality    bool
 	TargetPosition uint64
 	ContentCount   uint64
-	Err            error // VirtualListViewResult
+	VlvResult      VlvResultCode
 	ContextID      string
 }
 
+// VlvResultCode - the virtualListViewResult of a VlvResponse, an LDAP result
+// code or one of the VLV codes below.
+type VlvResultCode uint8
+
+const (
+	VlvResultSortControlMissing VlvResultCode = 60
+	VlvResultOffsetRangeError   VlvResultCode = 61
+)
+
+func (r VlvResultCode) String() string {
+	switch r {
+	case VlvResultSortControlMissing:
+		return "Sort Control Missing"
+	case VlvResultOffsetRangeError:
+		return "Offset Range Error"
+	}
+	return LDAPResultCodeMap[uint8(r)]
+}
+
+// VlvError returns nil if the VLV request succeeded, else an *LDAPError with
+// the VlvResult code.
+func (c *ControlVlvResponse) VlvError() error {
+	if c.VlvResult == LDAPResultSuccess {
+		return nil
+	}
+	return NewLDAPError(uint8(c.VlvResult), "Virtual list view failed: "+c.VlvResult.String())
+}
+
 /*
  VirtualListViewResponse ::= SEQUENCE {
        targetPosition    INTEGER (0 .. maxInt),
@@ -640,36 +987,49 @@ func NewControlVlvResponse(p *ber.Packet) (Control, error) {
 	_, criticality, value := decodeControlTypeAndCrit(p)
 	c.Criticality = criticality
 
-	if value.Value != nil {
-		vlvResult := ber.DecodePacket(value.Data.Bytes())
-		value.Data.Truncate(0)
-		value.Value = nil
-		value.AppendChild(vlvResult)
+	value = decodeControlValue(value, "VlvResponse Control Value")
+	if value == nil || len(value.Children) < 3 {
+		return nil, NewLDAPError(ErrorDecoding, "Invalid VlvResponse control value")
 	}
 
-	value = value.Children[0]
-	value.Description = "VlvResponse Control Value"
-
 	value.Children[0].Description = "TargetPosition"
 	value.Children[1].Description = "ContentCount"
-	value.Children[2].Description = "VirtualListViewResult/Err"
+	value.Children[2].Description = "VirtualListViewResult"
 
 	c.TargetPosition = value.Children[0].Value.(uint64)
 	c.ContentCount = value.Children[1].Value.(uint64)
 
-	errNum := uint8(value.Children[2].Value.(uint64))
-	c.Err = NewLDAPError(errNum, "")
+	c.VlvResult = VlvResultCode(value.Children[2].Value.(uint64))
 
 	if len(value.Children) == 4 {
 		value.Children[3].Description = "ContextID"
-		c.ContextID = value.Children[3].Value.(string)
+		// raw bytes, the contextID is opaque and may be binary
+		c.ContextID = string(value.Children[3].Data.Bytes())
 	}
 
 	return c, nil
 }
 
 func (c *ControlVlvResponse) Encode() (p *ber.Packet, err error) {
-	return nil, NewLDAPError(ErrorEncoding, "Encode of Control unsupported.")
+	p = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "ControlVlvResponse")
+	p.AppendChild(
+		ber.NewString(ber.ClassUniversal, ber.TypePrimative,
+			ber.TagOctetString, ControlTypeVlvResponse,
+			"Control Type ("+controlTypeName(ControlTypeVlvResponse)+")"))
+	if c.Criticality {
+		p.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimative, ber.TagBoolean, c.Criticality, "Criticality"))
+	}
+	octetString := ber.Encode(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, nil, "Octet String")
+	vlvSeq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "VirtualListViewResponse")
+	vlvSeq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimative, ber.TagInteger, c.TargetPosition, "TargetPosition"))
+	vlvSeq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimative, ber.TagInteger, c.ContentCount, "ContentCount"))
+	vlvSeq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimative, ber.TagEnumerated, uint64(c.VlvResult), "VirtualListViewResult"))
+	if len(c.ContextID) > 0 {
+		vlvSeq.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, c.ContextID, "ContextID"))
+	}
+	octetString.AppendChild(vlvSeq)
+	p.AppendChild(octetString)
+	return p, nil
 }
 
 func (c *ControlVlvResponse) GetControlType() string {
@@ -677,13 +1037,14 @@ func (c *ControlVlvResponse) GetControlType() string {
 }
 
 func (c *ControlVlvResponse) String() string {
-	return fmt.Sprintf("Control Type: %s (%q)  Criticality: %t, TargetPosition: %d, ContentCount: %d, ErrorValue: %d, ContextID: %s",
-		ControlTypeMap[ControlTypeVlvResponse],
+	return fmt.Sprintf("Control Type: %s (%q)  Criticality: %t, TargetPosition: %d, ContentCount: %d, VlvResult: %d (%s), ContextID: %s",
+		controlTypeName(ControlTypeVlvResponse),
 		ControlTypeVlvResponse,
 		c.Criticality,
 		c.TargetPosition,
 		c.ContentCount,
-		c.Err.(*LDAPError).ResultCode,
+		c.VlvResult,
+		c.VlvResult,
 		c.ContextID,
 	)
 }
@@ -0,0 +1,274 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"fmt"
+	"github.com/mavricknz/asn1-ber"
+	"reflect"
+	"testing"
+)
+
+const testControlType = "1.3.6.1.4.1.99999.1"
+
+type testControl struct {
+	Criticality bool
+	Value       string
+}
+
+func (c *testControl) Encode() (*ber.Packet, error) {
+	return NewControlString(testControlType, c.Criticality, c.Value).Encode()
+}
+
+func (c *testControl) GetControlType() string {
+	return testControlType
+}
+
+func (c *testControl) String() string {
+	return fmt.Sprintf("testControl: %t %s", c.Criticality, c.Value)
+}
+
+func newTestControlFromPacket(p *ber.Packet) (Control, error) {
+	_, criticality, value := decodeControlTypeAndCrit(p)
+	c := &testControl{Criticality: criticality}
+	if value != nil {
+		c.Value = string(value.Data.Bytes())
+	}
+	return c, nil
+}
+
+// buildResponse encodes then decodes an LDAPMessage, as read off the wire.
+func buildResponse(t *testing.T, op *ber.Packet, controls []Control) *ber.Packet {
+	p, err := requestBuildPacket(1, op, controls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ber.DecodePacket(p.Bytes())
+}
+
+func TestDecodeControlUnknown(t *testing.T) {
+	controlType := "1.3.6.1.4.1.99999.2"
+	packet := ber.DecodePacket(mustEncode(t, NewControlString(controlType, true, "\x00\xffraw")).Bytes())
+	c, err := DecodeControl(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, ok := c.(*ControlString)
+	if !ok {
+		t.Fatalf("expected *ControlString got %T", c)
+	}
+	if cs.ControlType != controlType || !cs.Criticality || cs.ControlValue != "\x00\xffraw" {
+		t.Errorf("unknown control not preserved: %s", cs)
+	}
+
+	// criticality with no value
+	packet = ber.DecodePacket(mustEncode(t, NewControlString(controlType, true, "")).Bytes())
+	c, err = DecodeControl(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs = c.(*ControlString); !cs.Criticality || cs.ControlValue != "" {
+		t.Errorf("criticality only control not preserved: %s", cs)
+	}
+}
+
+func TestRegisterControl(t *testing.T) {
+	RegisterControl(testControlType, "TestControl", newTestControlFromPacket)
+	defer func() {
+		delete(ControlDecodeMap, testControlType)
+		delete(ControlTypeMap, testControlType)
+	}()
+
+	packet := buildResponse(t, testResult(ApplicationModifyResponse, LDAPResultSuccess, ""),
+		[]Control{&testControl{Value: "modify"}})
+	controls, err := decodeResponseControls(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(controls) != 1 {
+		t.Fatalf("expected 1 control got %d", len(controls))
+	}
+	if c, ok := controls[0].(*testControl); !ok || c.Value != "modify" {
+		t.Errorf("registered decoder not used: %s", controls[0])
+	}
+}
+
+func TestDecodeResponseControlsInvalid(t *testing.T) {
+	l := newTestConnection(t, func(request *ber.Packet) []*ber.Packet {
+		done := testResult(ApplicationDelResponse, LDAPResultNoSuchObject, "no such entry")
+		return []*ber.Packet{testResponse(request, done, []Control{NewControlString(ControlTypePaging, false, "bad")})}
+	})
+	defer l.Close()
+	req := NewDeleteRequest("cn=bob,o=example")
+	err := l.Delete(req)
+	if lerr, ok := err.(*LDAPError); !ok || lerr.ResultCode != LDAPResultNoSuchObject {
+		t.Errorf("expected the no such object result, got %v", err)
+	}
+	if len(req.ResponseControls) != 1 || req.ResponseControls[0].(*ControlString).ControlValue != "bad" {
+		t.Errorf("undecodable control not kept raw: %v", req.ResponseControls)
+	}
+}
+
+func TestDecodeSearchEntryControls(t *testing.T) {
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationSearchResultEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, "cn=bob,o=example", "Object Name"))
+	entry.AppendChild(ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes"))
+
+	packet := buildResponse(t, entry, []Control{NewControlString("1.3.6.1.4.1.99999.3", false, "entry")})
+	dsr, err := decodeSearchResponse(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsr.Entry == nil || dsr.Entry.DN != "cn=bob,o=example" {
+		t.Fatalf("entry not decoded")
+	}
+	if len(dsr.Controls) != 1 || dsr.Controls[0].(*ControlString).ControlValue != "entry" {
+		t.Errorf("entry controls not decoded: %v", dsr.Controls)
+	}
+
+	l := newTestConnection(t, func(request *ber.Packet) []*ber.Packet {
+		e := NewEntry("cn=bob,o=example")
+		return []*ber.Packet{
+			testResponse(request, testEntry(e), []Control{NewControlString("1.3.6.1.4.1.99999.3", false, "entry")}),
+			testResponse(request, testResult(ApplicationSearchResultDone, LDAPResultSuccess, ""), nil),
+		}
+	})
+	defer l.Close()
+	sr, err := l.Search(NewSimpleSearchRequest("o=example", ScopeWholeSubtree, "(cn=bob)", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sr.Entries) != 1 || len(sr.Entries[0].Controls) != 1 ||
+		sr.Entries[0].Controls[0].(*ControlString).ControlValue != "entry" {
+		t.Errorf("entry controls not kept by Search: %v", sr.Entries)
+	}
+}
+
+func mustEncode(t *testing.T, c Control) *ber.Packet {
+	p, err := c.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestControlEncodeDecode(t *testing.T) {
+	for _, c := range []Control{
+		NewControlManageDsaITRequest(true),
+		NewControlSubtreeDeleteRequest(false),
+		&ControlPaging{PagingSize: 500, Cookie: []byte("\x00\xffcookie"), Criticality: true},
+		NewControlMatchedValuesRequest(true, "(cn=Bob*)"),
+		&ControlMatchedValuesRequest{Filter: "(cn=a)", Filters: []string{"(sn=b)", "(mail=*)"}},
+		NewControlServerSideSortRequest([]ServerSideSortAttrRuleOrder{
+			{AttributeName: "sn"},
+			{AttributeName: "uidNumber", OrderingRule: MatchingRule_integerOrderingMatch, ReverseOrder: true},
+		}, true),
+		&ControlVlvRequest{BeforeCount: 1, AfterCount: 9, ByOffset: &VlvOffSet{Offset: 5, ContentCount: 100},
+			ContextID: []byte("\x01ctx")},
+		&ControlVlvRequest{Criticality: true, AfterCount: 19, GreaterThanOrEqual: "Smith"},
+		&ControlServerSideSortResponse{SortResult: LDAPResultNoSuchAttribute, AttributeName: "sn"},
+		&ControlServerSideSortResponse{Criticality: true},
+		&ControlVlvResponse{TargetPosition: 5, ContentCount: 100, VlvResult: VlvResultOffsetRangeError, ContextID: "ctx"},
+	} {
+		decoded, err := DecodeControl(ber.DecodePacket(mustEncode(t, c).Bytes()))
+		if err != nil {
+			t.Errorf("%s: %s", c, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, c) {
+			t.Errorf("expected %s, got %s", c, decoded)
+		}
+	}
+}
+
+func TestControlServerSideSortRequestEncode(t *testing.T) {
+	c := NewControlServerSideSortRequest([]ServerSideSortAttrRuleOrder{
+		{AttributeName: "cn", OrderingRule: "2.5.13.3", ReverseOrder: true},
+		{AttributeName: "sn"},
+	}, false)
+	// orderingRule [0], reverseOrder [1] and omitted when FALSE
+	want := "\x30\x19\x30\x11\x04\x02cn\x80\x082.5.13.3\x81\x01\xff\x30\x04\x04\x02sn"
+	p := ber.DecodePacket(mustEncode(t, c).Bytes())
+	if value := p.Children[1].Data.String(); value != want {
+		t.Errorf("expected %q, got %q", want, value)
+	}
+}
+
+func TestControlDecodeMethods(t *testing.T) {
+	sortRequest := new(ControlServerSideSortRequest)
+	if _, err := sortRequest.Decode(ber.DecodePacket(mustEncode(t,
+		NewControlServerSideSortRequest([]ServerSideSortAttrRuleOrder{{AttributeName: "cn"}}, true)).Bytes())); err != nil ||
+		!sortRequest.Criticality || sortRequest.SortKeyList[0].AttributeName != "cn" {
+		t.Errorf("ServerSideSortRequest.Decode: %v %s", err, sortRequest)
+	}
+	vlvRequest := new(ControlVlvRequest)
+	if _, err := vlvRequest.Decode(ber.DecodePacket(mustEncode(t,
+		&ControlVlvRequest{GreaterThanOrEqual: "b"}).Bytes())); err != nil || vlvRequest.GreaterThanOrEqual != "b" {
+		t.Errorf("VlvRequest.Decode: %v %s", err, vlvRequest)
+	}
+	matchedValues := new(ControlMatchedValuesRequest)
+	if _, err := matchedValues.Decode(ber.DecodePacket(mustEncode(t,
+		NewControlMatchedValuesRequest(false, "(mail=*)")).Bytes())); err != nil || matchedValues.Filter != "(mail=*)" {
+		t.Errorf("MatchedValuesRequest.Decode: %v %s", err, matchedValues)
+	}
+	if _, err := sortRequest.Decode(ber.DecodePacket(mustEncode(t, NewControlString(ControlTypeServerSideSortRequest, false, "")).Bytes())); err == nil {
+		t.Errorf("expected an error decoding a sort request without a value")
+	}
+}
+
+func TestControlMatchedValuesRequestItems(t *testing.T) {
+	c := &ControlMatchedValuesRequest{Filter: "(cn=a)", Filters: []string{"(sn=b)"}}
+	encoded := mustEncode(t, c).Bytes()
+	decoded, err := DecodeControl(ber.DecodePacket(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reencoded := mustEncode(t, decoded).Bytes(); string(reencoded) != string(encoded) {
+		t.Errorf("expected %x, got %x", encoded, reencoded)
+	}
+	// one SimpleFilterItem per filter
+	value := ber.DecodePacket(encoded).Children[1].Data.String()
+	if want := "\x30\x12\xa3\x07\x04\x02cn\x04\x01a\xa3\x07\x04\x02sn\x04\x01b"; value != want {
+		t.Errorf("expected %q, got %q", want, value)
+	}
+
+	for _, filter := range []string{"(&(cn=a)(sn=b))", "(|(cn=a)(sn=b))", "(!(cn=a))", ""} {
+		if _, err := NewControlMatchedValuesRequest(false, filter).Encode(); err == nil {
+			t.Errorf("%q: expected an error", filter)
+		}
+	}
+	or := NewControlString(ControlTypeMatchedValuesRequest, false, "\x30\x09\xa1\x07\xa3\x05\x04\x01a\x04\x00")
+	if _, err := DecodeControl(ber.DecodePacket(mustEncode(t, or).Bytes())); err == nil {
+		t.Errorf("expected an error decoding an or filter item")
+	}
+}
+
+func TestControlServerSideSortResponseSortError(t *testing.T) {
+	c := &ControlServerSideSortResponse{SortResult: LDAPResultSuccess}
+	if c.SortError() != nil {
+		t.Errorf("unexpected %s", c.SortError())
+	}
+	c = &ControlServerSideSortResponse{SortResult: LDAPResultInappropriateMatching, AttributeName: "cn"}
+	if err, ok := c.SortError().(*LDAPError); !ok || err.ResultCode != LDAPResultInappropriateMatching {
+		t.Errorf("unexpected %v", c.SortError())
+	}
+	if c.SortResult.String() != LDAPResultCodeMap[LDAPResultInappropriateMatching] {
+		t.Errorf("unexpected %s", c.SortResult)
+	}
+}
+
+func TestControlVlvResponseVlvError(t *testing.T) {
+	c := &ControlVlvResponse{VlvResult: LDAPResultSuccess}
+	if c.VlvError() != nil {
+		t.Errorf("unexpected %s", c.VlvError())
+	}
+	c = &ControlVlvResponse{VlvResult: VlvResultOffsetRangeError}
+	if err, ok := c.VlvError().(*LDAPError); !ok || err.ResultCode != uint8(VlvResultOffsetRangeError) {
+		t.Errorf("unexpected %v", c.VlvError())
+	}
+	if c.VlvResult.String() != "Offset Range Error" {
+		t.Errorf("unexpected %s", c.VlvResult)
+	}
+}
@@ -11,6 +11,8 @@ import (
 type DeleteRequest struct {
 	DN       string
 	Controls []Control
+	// ResponseControls are set by Delete from the DelResponse.
+	ResponseControls []Control
 }
 
 func (req *DeleteRequest) RecordType() uint8 {
@@ -21,7 +23,7 @@ func (req *DeleteRequest) RecordType() uint8 {
 Simple delete
 */
 
-func (l *LDAPConnection) Delete(delReq *DeleteRequest) (error error) {
+func (l *LDAPConnection) Delete(delReq *DeleteRequest) error {
 	messageID, ok := l.nextMessageID()
 	if !ok {
 		return NewLDAPError(ErrorClosing, "MessageID channel is closed.")
@@ -33,7 +35,17 @@ func (l *LDAPConnection) Delete(delReq *DeleteRequest) (error error) {
 		return err
 	}
 
-	return l.sendReqRespPacket(messageID, packet)
+	delReq.ResponseControls, err = l.sendReqRespPacket(messageID, packet)
+	if referrals, ok := l.isReferral(err); ok {
+		return l.chaseReferrals(referrals, func(conn *LDAPConnection, lu *LDAPURL) error {
+			referred := *delReq
+			referred.DN = referralDN(delReq.DN, lu)
+			err := conn.Delete(&referred)
+			delReq.ResponseControls = referred.ResponseControls
+			return err
+		})
+	}
+	return err
 }
 
 func NewDeleteRequest(dn string) (delReq *DeleteRequest) {
@@ -0,0 +1,308 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains the DN type, parsing and formatting RFC 4514 strings
+package ldap
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// AttributeTypeAndValue is one assertion of an RDN e.g. cn=Bob. Value is
+// unescaped, for a #hex value the string content of the BER encoding.
+type AttributeTypeAndValue struct {
+	Type  string
+	Value string
+}
+
+// RelativeDN - an RDN, usually one AttributeTypeAndValue, more for a multi
+// valued RDN e.g. cn=Bob+uid=bob.
+type RelativeDN struct {
+	Attributes []*AttributeTypeAndValue
+}
+
+// DN - a distinguished name, RDNs[0] is the RDN of the entry and the last
+// RDN is nearest the root. The root DSE has no RDNs.
+type DN struct {
+	RDNs []*RelativeDN
+}
+
+// ParseDN parses the RFC 4514 string representation of a DN, e.g.
+//
+//	cn=Smith\, J+uid=js,ou=people,dc=example,dc=com
+//
+// Spaces around '=', ',' and '+' are ignored. Values may use \ escapes of
+// special characters, \xx hex escapes or be # followed by the hex of a BER
+// encoded string.
+func ParseDN(dn string) (*DN, error) {
+	p := &dnParser{dn: dn}
+	d := &DN{RDNs: make([]*RelativeDN, 0)}
+	if len(strings.TrimSpace(dn)) == 0 {
+		return d, nil
+	}
+	rdn := &RelativeDN{}
+	for {
+		atv, err := p.parseAttributeTypeAndValue()
+		if err != nil {
+			return nil, err
+		}
+		rdn.Attributes = append(rdn.Attributes, atv)
+		if p.pos == len(dn) {
+			d.RDNs = append(d.RDNs, rdn)
+			return d, nil
+		}
+		switch dn[p.pos] {
+		case ',':
+			d.RDNs = append(d.RDNs, rdn)
+			rdn = &RelativeDN{}
+		case '+':
+		default:
+			return nil, p.error()
+		}
+		p.pos++
+	}
+}
+
+// MustParseDN is like ParseDN but panics if dn is invalid.
+func MustParseDN(dn string) *DN {
+	d, err := ParseDN(dn)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+type dnParser struct {
+	dn  string
+	pos int
+}
+
+func (p *dnParser) error() error {
+	return NewLDAPError(ErrorInvalidArgument, "Invalid DN: "+p.dn)
+}
+
+func (p *dnParser) skipSpace() {
+	for p.pos < len(p.dn) && p.dn[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *dnParser) parseAttributeTypeAndValue() (*AttributeTypeAndValue, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.dn) && p.dn[p.pos] != '=' {
+		p.pos++
+	}
+	attrType := strings.TrimRight(p.dn[start:p.pos], " ")
+	if p.pos == len(p.dn) || !attributeTypeRegex.MatchString(attrType) {
+		return nil, p.error()
+	}
+	p.pos++
+	p.skipSpace()
+	if p.pos < len(p.dn) && p.dn[p.pos] == '#' {
+		p.pos++
+		start = p.pos
+		for p.pos+1 < len(p.dn) && isHexDigit(p.dn[p.pos]) && isHexDigit(p.dn[p.pos+1]) {
+			p.pos += 2
+		}
+		encoded := make([]byte, 0, (p.pos-start)/2)
+		for i := start; i < p.pos; i += 2 {
+			encoded = append(encoded, unhex(p.dn[i])<<4|unhex(p.dn[i+1]))
+		}
+		value, ok := decodeBERString(encoded)
+		p.skipSpace()
+		if !ok || (p.pos < len(p.dn) && p.dn[p.pos] != ',' && p.dn[p.pos] != '+') {
+			return nil, p.error()
+		}
+		return &AttributeTypeAndValue{Type: attrType, Value: value}, nil
+	}
+	value := make([]byte, 0, 16)
+	// escaped trailing spaces are kept
+	keep := 0
+	for p.pos < len(p.dn) && p.dn[p.pos] != ',' && p.dn[p.pos] != '+' {
+		c := p.dn[p.pos]
+		switch c {
+		case '\\':
+			if p.pos+2 < len(p.dn) && isHexDigit(p.dn[p.pos+1]) && isHexDigit(p.dn[p.pos+2]) {
+				value = append(value, unhex(p.dn[p.pos+1])<<4|unhex(p.dn[p.pos+2]))
+				p.pos += 3
+			} else if p.pos+1 < len(p.dn) && strings.IndexByte(` "#+,;<=>\`, p.dn[p.pos+1]) >= 0 {
+				value = append(value, p.dn[p.pos+1])
+				p.pos += 2
+			} else {
+				return nil, p.error()
+			}
+			keep = len(value)
+		case '"', ';', '<', '>', 0:
+			return nil, p.error()
+		default:
+			value = append(value, c)
+			p.pos++
+		}
+	}
+	for len(value) > keep && value[len(value)-1] == ' ' {
+		value = value[:len(value)-1]
+	}
+	return &AttributeTypeAndValue{Type: attrType, Value: string(value)}, nil
+}
+
+// decodeBERString returns the content of a single primitive BER element.
+func decodeBERString(b []byte) (string, bool) {
+	if len(b) < 2 || b[0]&0x20 != 0 {
+		return "", false
+	}
+	length, pos := int(b[1]), 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(b) < 2+n {
+			return "", false
+		}
+		length = 0
+		for _, c := range b[2 : 2+n] {
+			length = length<<8 | int(c)
+		}
+		pos += n
+	}
+	if len(b)-pos != length {
+		return "", false
+	}
+	return string(b[pos:]), true
+}
+
+// String - the RFC 4514 string representation.
+func (d *DN) String() string {
+	rdns := make([]string, len(d.RDNs))
+	for i, rdn := range d.RDNs {
+		rdns[i] = rdn.String()
+	}
+	return strings.Join(rdns, ",")
+}
+
+// RDN - the first RDN, nil for the root DSE.
+func (d *DN) RDN() *RelativeDN {
+	if len(d.RDNs) == 0 {
+		return nil
+	}
+	return d.RDNs[0]
+}
+
+// Parent - the DN without its first RDN, nil for the root DSE.
+func (d *DN) Parent() *DN {
+	if len(d.RDNs) == 0 {
+		return nil
+	}
+	return &DN{RDNs: d.RDNs[1:]}
+}
+
+// Equal compares DNs ignoring the case of attribute types and values,
+// repeated spaces in values and the order within multi valued RDNs.
+func (d *DN) Equal(other *DN) bool {
+	if len(d.RDNs) != len(other.RDNs) {
+		return false
+	}
+	for i := range d.RDNs {
+		if !d.RDNs[i].Equal(other.RDNs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsDescendantOf is true if d is below base, e.g. cn=x,dc=com is a
+// descendant of dc=com. A DN is not a descendant of itself.
+func (d *DN) IsDescendantOf(base *DN) bool {
+	return len(d.RDNs) > len(base.RDNs) && d.hasSuffix(base)
+}
+
+func (d *DN) hasSuffix(base *DN) bool {
+	if len(d.RDNs) < len(base.RDNs) {
+		return false
+	}
+	offset := len(d.RDNs) - len(base.RDNs)
+	for i, rdn := range base.RDNs {
+		if !d.RDNs[offset+i].Equal(rdn) {
+			return false
+		}
+	}
+	return true
+}
+
+// Rebase returns d moved from below oldBase to below newBase, e.g.
+// uid=a,ou=old,dc=com rebased from ou=old,dc=com to ou=new,dc=com gives
+// uid=a,ou=new,dc=com. d must be oldBase or a descendant of it.
+func (d *DN) Rebase(oldBase, newBase *DN) (*DN, error) {
+	if !d.hasSuffix(oldBase) {
+		return nil, NewLDAPError(ErrorInvalidArgument, d.String()+" is not below "+oldBase.String())
+	}
+	n := len(d.RDNs) - len(oldBase.RDNs)
+	rdns := make([]*RelativeDN, 0, n+len(newBase.RDNs))
+	rdns = append(rdns, d.RDNs[:n]...)
+	rdns = append(rdns, newBase.RDNs...)
+	return &DN{RDNs: rdns}, nil
+}
+
+func (r *RelativeDN) String() string {
+	atvs := make([]string, len(r.Attributes))
+	for i, atv := range r.Attributes {
+		atvs[i] = atv.String()
+	}
+	return strings.Join(atvs, "+")
+}
+
+// Equal - the same attribute types and values, in any order.
+func (r *RelativeDN) Equal(other *RelativeDN) bool {
+	if len(r.Attributes) != len(other.Attributes) {
+		return false
+	}
+	matched := make([]bool, len(other.Attributes))
+	for _, atv := range r.Attributes {
+		found := false
+		for i, otherATV := range other.Attributes {
+			if !matched[i] && atv.Equal(otherATV) {
+				matched[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *AttributeTypeAndValue) String() string {
+	return a.Type + "=" + EscapeDNValue(a.Value)
+}
+
+// Equal compares types ignoring case and aliases, and values ignoring case
+// and repeated spaces.
+func (a *AttributeTypeAndValue) Equal(other *AttributeTypeAndValue) bool {
+	if !attributeTypesEqual(a.Type, other.Type) {
+		return false
+	}
+	return ValuesEqual(GetMatchingRule(MatchingRule_caseIgnoreMatch), a.Value, other.Value)
+}
+
+// EscapeDNValue escapes an attribute value for use in a DN string, see
+// RFC 4514 2.4. Invalid UTF-8 is escaped as \xx.
+func EscapeDNValue(value string) string {
+	escaped := make([]byte, 0, len(value))
+	for i := 0; i < len(value); {
+		c := value[i]
+		r, size := utf8.DecodeRuneInString(value[i:])
+		switch {
+		case c == 0 || (r == utf8.RuneError && size <= 1):
+			escaped = append(escaped, '\\', hexDigits[c>>4], hexDigits[c&0xf])
+		case strings.IndexByte(`"+,;<>\`, c) >= 0,
+			(c == ' ' || c == '#') && i == 0,
+			c == ' ' && i == len(value)-1:
+			escaped = append(escaped, '\\', c)
+		default:
+			escaped = append(escaped, value[i:i+size]...)
+		}
+		i += size
+	}
+	return string(escaped)
+}
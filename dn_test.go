@@ -0,0 +1,124 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"testing"
+)
+
+func TestParseDN(t *testing.T) {
+	tests := []struct {
+		dn     string
+		rdns   [][]AttributeTypeAndValue
+		output string
+	}{
+		{"", nil, ""},
+		{"cn=Bob,dc=example,dc=com",
+			[][]AttributeTypeAndValue{{{"cn", "Bob"}}, {{"dc", "example"}}, {{"dc", "com"}}},
+			"cn=Bob,dc=example,dc=com"},
+		{" cn = Bob  Smith , ou=people ",
+			[][]AttributeTypeAndValue{{{"cn", "Bob  Smith"}}, {{"ou", "people"}}},
+			"cn=Bob  Smith,ou=people"},
+		{`cn=Smith\, J+uid=js,o=a\+b`,
+			[][]AttributeTypeAndValue{{{"cn", "Smith, J"}, {"uid", "js"}}, {{"o", "a+b"}}},
+			`cn=Smith\, J+uid=js,o=a\+b`},
+		{`cn=\#1\ \20,o=\22q\22 \3cx\3e\;\5c`,
+			[][]AttributeTypeAndValue{{{"cn", "#1  "}}, {{"o", `"q" <x>;\`}}},
+			`cn=\#1 \ ,o=\"q\" \<x\>\;\\`},
+		{`cn=\e4\b8\96\e7\95\8c,o=\00\ff`,
+			[][]AttributeTypeAndValue{{{"cn", "世界"}}, {{"o", "\x00\xff"}}},
+			`cn=世界,o=\00\ff`},
+		{"cn=#04034a6f65,2.5.4.10=#130141",
+			[][]AttributeTypeAndValue{{{"cn", "Joe"}}, {{"2.5.4.10", "A"}}},
+			"cn=Joe,2.5.4.10=A"},
+		{"cn=a=b,o=", [][]AttributeTypeAndValue{{{"cn", "a=b"}}, {{"o", ""}}}, "cn=a=b,o="},
+	}
+	for _, test := range tests {
+		dn, err := ParseDN(test.dn)
+		if err != nil {
+			t.Errorf("Problem parsing %q - %s", test.dn, err)
+			continue
+		}
+		if len(dn.RDNs) != len(test.rdns) {
+			t.Errorf("%q expected %d RDNs, got %d", test.dn, len(test.rdns), len(dn.RDNs))
+			continue
+		}
+		for i, rdn := range test.rdns {
+			if len(dn.RDNs[i].Attributes) != len(rdn) {
+				t.Errorf("%q RDN %d expected %v, got %s", test.dn, i, rdn, dn.RDNs[i])
+				continue
+			}
+			for j, atv := range rdn {
+				if *dn.RDNs[i].Attributes[j] != atv {
+					t.Errorf("%q RDN %d expected %v, got %v", test.dn, i, atv, *dn.RDNs[i].Attributes[j])
+				}
+			}
+		}
+		if dn.String() != test.output {
+			t.Errorf("%q expected %q, got %q", test.dn, test.output, dn.String())
+		}
+		if again, err := ParseDN(dn.String()); err != nil || !again.Equal(dn) {
+			t.Errorf("%q did not round trip via %q - %v", test.dn, dn.String(), err)
+		}
+	}
+	for _, dn := range []string{"cn", "=x", "cn=a,", "cn=a+", "cn=\"a\"", "cn=a;b", "cn=a\\", "cn=a\\x",
+		"cn=#04", "cn=#0403Joe", "cn=#04034a6f65x", "c n=a", "1.2.=a"} {
+		if _, err := ParseDN(dn); err == nil {
+			t.Errorf("%q expected an error", dn)
+		}
+	}
+}
+
+func TestDNOperations(t *testing.T) {
+	dn := MustParseDN("uid=bob+cn=Bob Smith,ou=People,dc=example,dc=com")
+	if got := dn.RDN().String(); got != "uid=bob+cn=Bob Smith" {
+		t.Errorf("RDN: %s", got)
+	}
+	if got := dn.Parent().String(); got != "ou=People,dc=example,dc=com" {
+		t.Errorf("Parent: %s", got)
+	}
+	root := MustParseDN("")
+	if root.RDN() != nil || root.Parent() != nil {
+		t.Errorf("expected no RDN or parent for the root DSE")
+	}
+	if !dn.Equal(MustParseDN("CN=bob  smith+UID=BOB, OU=people,DC=Example,dc=COM")) {
+		t.Errorf("expected equal DNs")
+	}
+	if dn.Equal(MustParseDN("uid=bob,ou=People,dc=example,dc=com")) || dn.Equal(dn.Parent()) {
+		t.Errorf("expected different DNs")
+	}
+	base := MustParseDN("DC=example, DC=com")
+	if !dn.IsDescendantOf(base) || !dn.IsDescendantOf(root) {
+		t.Errorf("expected a descendant of %s", base)
+	}
+	if dn.IsDescendantOf(dn) || base.IsDescendantOf(dn) || dn.IsDescendantOf(MustParseDN("dc=org")) {
+		t.Errorf("expected not a descendant")
+	}
+	rebased, err := dn.Rebase(MustParseDN("ou=people,dc=example,dc=com"), MustParseDN("ou=staff,o=corp"))
+	if err != nil || rebased.String() != "uid=bob+cn=Bob Smith,ou=staff,o=corp" {
+		t.Errorf("Rebase: %v %v", rebased, err)
+	}
+	if rebased, err := base.Rebase(base, root); err != nil || rebased.String() != "" {
+		t.Errorf("Rebase to root: %v %v", rebased, err)
+	}
+	if _, err := base.Rebase(dn, root); err == nil {
+		t.Errorf("expected an error rebasing from a DN not above")
+	}
+}
+
+func TestEscapeDNValue(t *testing.T) {
+	tests := map[string]string{
+		"Smith, J":    `Smith\, J`,
+		" #a# ":       `\ #a#\ `,
+		"a+b;c<d>\"":  `a\+b\;c\<d\>\"`,
+		"\\\x00é\xff": `\\\00é\ff`,
+		"=":           "=",
+	}
+	for value, want := range tests {
+		if got := EscapeDNValue(value); got != want {
+			t.Errorf("%q expected %q, got %q", value, want, got)
+		}
+	}
+}
@@ -8,13 +8,38 @@ package ldap
 type Entry struct {
 	DN         string
 	Attributes []*EntryAttribute
+	Server     string    // Addr of the server the entry was returned by, if from a search
+	Controls   []Control // response controls returned with the entry, if from a search
 }
 
+// EntryAttribute values are held unmodified as returned by the server, binary
+// values e.g. objectGUID, objectSid, jpegPhoto can be accessed via ByteValues.
 type EntryAttribute struct {
 	Name   string
 	Values []string
 }
 
+// ByteValues returns the attribute values as byte slices.
+func (attr *EntryAttribute) ByteValues() [][]byte {
+	return stringsToBytes(attr.Values)
+}
+
+func stringsToBytes(values []string) [][]byte {
+	byteValues := make([][]byte, len(values))
+	for i, value := range values {
+		byteValues[i] = []byte(value)
+	}
+	return byteValues
+}
+
+func bytesToStrings(byteValues [][]byte) []string {
+	values := make([]string, len(byteValues))
+	for i, value := range byteValues {
+		values[i] = string(value)
+	}
+	return values
+}
+
 func (req *Entry) RecordType() uint8 {
 	return EntryRecord
 }
@@ -49,13 +74,57 @@ func (e *Entry) AddAttributeValues(attributeName string, values []string) {
 	}
 }
 
+// AddAttributeByteValue - Add a single binary Attr value
+func (e *Entry) AddAttributeByteValue(attributeName string, value []byte) {
+	e.AddAttributeValue(attributeName, string(value))
+}
+
+// AddAttributeByteValues - Add via a name and slice of binary values
+func (e *Entry) AddAttributeByteValues(attributeName string, values [][]byte) {
+	e.AddAttributeValues(attributeName, bytesToStrings(values))
+}
+
+// GetAttributeByteValues - values as byte slices, for binary attributes.
+func (e *Entry) GetAttributeByteValues(attributeName string) [][]byte {
+	return stringsToBytes(e.GetAttributeValues(attributeName))
+}
+
+// GetAttributeValues - values of the attribute description attributeName,
+// matched case-insensitively along with any subtypes i.e. attributes with
+// further options e.g. "userCertificate" also returns the values of
+// "userCertificate;binary". See AttributeDescription.Matches.
 func (e *Entry) GetAttributeValues(attributeName string) []string {
+	attrs := e.GetAttributes(attributeName)
+	switch len(attrs) {
+	case 0:
+		return []string{}
+	case 1:
+		return attrs[0].Values
+	}
+	values := make([]string, 0)
+	for _, attr := range attrs {
+		values = append(values, attr.Values...)
+	}
+	return values
+}
+
+// GetAttributes - attributes matching the attribute description
+// attributeName, an exact match first followed by subtypes.
+func (e *Entry) GetAttributes(attributeName string) []*EntryAttribute {
+	attrs := make([]*EntryAttribute, 0)
+	query := splitAttributeDescription(attributeName)
 	for _, attr := range e.Attributes {
-		if attr.Name == attributeName {
-			return attr.Values
+		ad := splitAttributeDescription(attr.Name)
+		if !ad.Matches(query) {
+			continue
+		}
+		if ad.Equal(query) {
+			attrs = append([]*EntryAttribute{attr}, attrs...)
+		} else {
+			attrs = append(attrs, attr)
 		}
 	}
-	return []string{}
+	return attrs
 }
 
 // GetAttributeValue - returning an empty string is a bad idea
@@ -69,9 +138,11 @@ func (e *Entry) GetAttributeValues(attributeName string) []string {
 //	return values[0]
 //}
 
+// GetAttributeIndex - index of the attribute with the same attribute
+// description, case-insensitive and ignoring the order of options.
 func (e *Entry) GetAttributeIndex(Attribute string) int {
 	for i, attr := range e.Attributes {
-		if attr.Name == Attribute {
+		if AttributeDescriptionsEqual(attr.Name, Attribute) {
 			return i
 		}
 	}
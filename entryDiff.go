@@ -0,0 +1,132 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains Entry comparison producing a ModifyRequest
+package ldap
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// OperationalAttributes are maintained by the server and skipped by
+// DiffEntries with DiffOptions.IgnoreOperational. Add to it for other
+// servers.
+var OperationalAttributes = []string{
+	// RFC 4512, 3045 and 4530
+	"createTimestamp", "modifyTimestamp", "creatorsName", "modifiersName",
+	"subschemaSubentry", "structuralObjectClass", "hasSubordinates",
+	"numSubordinates", "entryDN", "entryUUID", "entryCSN", "contextCSN",
+	"pwdChangedTime", "pwdAccountLockedTime", "pwdFailureTime", "pwdHistory",
+	"vendorName", "vendorVersion",
+	// 389 Directory Server / Sun ONE
+	"nsUniqueId", "nsRoleDN", "nsRole",
+	// Active Directory
+	"whenCreated", "whenChanged", "uSNCreated", "uSNChanged", "objectGUID",
+	"objectSid", "distinguishedName", "instanceType", "objectCategory",
+	"dSCorePropagationData", "lastLogon", "lastLogonTimestamp", "logonCount",
+	"badPwdCount", "badPasswordTime", "pwdLastSet", "memberOf",
+}
+
+// DiffOptions control DiffEntries.
+type DiffOptions struct {
+	// CaseInsensitiveValues compares values ignoring case e.g. for
+	// caseIgnoreMatch attributes such as cn and mail.
+	CaseInsensitiveValues bool
+	// IgnoreOperational skips OperationalAttributes.
+	IgnoreOperational bool
+	// IgnoreAttributes are also skipped.
+	IgnoreAttributes []string
+}
+
+// DiffEntries returns a ModifyRequest for current.DN that changes the
+// attributes of current to those of desired, the DN of desired is not used.
+// Attributes only in current are deleted and attributes only in desired are
+// added. For attributes in both, the changed values are deleted and added
+// unless that takes as many values as replacing the attribute, in which case
+// ModReplace is used. Equal entries give a request with no Mods. opts can be
+// nil.
+func DiffEntries(current, desired *Entry, opts *DiffOptions) *ModifyRequest {
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+	modReq := NewModifyRequest(current.DN)
+	for _, attr := range current.Attributes {
+		if opts.ignore(attr.Name) {
+			continue
+		}
+		desiredIndex := desired.GetAttributeIndex(attr.Name)
+		if desiredIndex == -1 || len(desired.Attributes[desiredIndex].Values) == 0 {
+			if len(attr.Values) > 0 {
+				modReq.AddMod(NewMod(ModDelete, attr.Name, nil))
+			}
+			continue
+		}
+		desiredAttr := desired.Attributes[desiredIndex]
+		toDelete := opts.subtractValues(attr.Values, desiredAttr.Values)
+		toAdd := opts.subtractValues(desiredAttr.Values, attr.Values)
+		switch {
+		case len(toDelete) == 0 && len(toAdd) == 0:
+		case len(toDelete)+len(toAdd) >= len(desiredAttr.Values):
+			modReq.AddMod(NewMod(ModReplace, desiredAttr.Name, desiredAttr.Values))
+		default:
+			if len(toDelete) > 0 {
+				modReq.AddMod(NewMod(ModDelete, attr.Name, toDelete))
+			}
+			if len(toAdd) > 0 {
+				modReq.AddMod(NewMod(ModAdd, desiredAttr.Name, toAdd))
+			}
+		}
+	}
+	for _, attr := range desired.Attributes {
+		if opts.ignore(attr.Name) || len(attr.Values) == 0 || current.GetAttributeIndex(attr.Name) != -1 {
+			continue
+		}
+		modReq.AddMod(NewMod(ModAdd, attr.Name, attr.Values))
+	}
+	return modReq
+}
+
+func (opts *DiffOptions) ignore(attributeName string) bool {
+	for _, name := range opts.IgnoreAttributes {
+		if AttributeDescriptionsEqual(name, attributeName) {
+			return true
+		}
+	}
+	if !opts.IgnoreOperational {
+		return false
+	}
+	ad := splitAttributeDescription(attributeName)
+	for _, name := range OperationalAttributes {
+		if attributeTypesEqual(name, ad.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// subtractValues - values of a not in b, without duplicates.
+func (opts *DiffOptions) subtractValues(a, b []string) []string {
+	exclude := make(map[string]bool, len(b))
+	for _, value := range b {
+		exclude[opts.valueKey(value)] = true
+	}
+	result := make([]string, 0)
+	for _, value := range a {
+		key := opts.valueKey(value)
+		if !exclude[key] {
+			result = append(result, value)
+			exclude[key] = true
+		}
+	}
+	return result
+}
+
+func (opts *DiffOptions) valueKey(value string) string {
+	// binary values are always compared exactly
+	if opts.CaseInsensitiveValues && utf8.ValidString(value) {
+		return strings.ToLower(value)
+	}
+	return value
+}
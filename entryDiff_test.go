@@ -0,0 +1,80 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDiffEntries(t *testing.T) {
+	current := NewEntry("uid=bob,o=example")
+	current.AddAttributeValue("uid", "bob")
+	current.AddAttributeValue("sn", "Smith")
+	current.AddAttributeValue("mail", "Bob@Example.com")
+	current.AddAttributeValue("telephoneNumber", "555-1234")
+	current.AddAttributeValue("modifyTimestamp", "20130704153000Z")
+	for i := 0; i < 10; i++ {
+		current.AddAttributeValue("memberUid", strconv.Itoa(i))
+	}
+
+	desired := NewEntry("uid=robert,o=example")
+	desired.AddAttributeValue("UID", "bob")
+	desired.AddAttributeValue("sn", "Jones")
+	desired.AddAttributeValue("mail", "bob@example.com")
+	desired.AddAttributeValue("title", "Engineer")
+	for i := 1; i < 11; i++ {
+		desired.AddAttributeValue("memberUid", strconv.Itoa(i))
+	}
+
+	modReq := DiffEntries(current, desired, &DiffOptions{CaseInsensitiveValues: true, IgnoreOperational: true})
+	if modReq.DN != current.DN {
+		t.Errorf("unexpected DN %s", modReq.DN)
+	}
+	expected := []struct {
+		op     uint8
+		name   string
+		values []string
+	}{
+		{ModReplace, "sn", []string{"Jones"}},
+		{ModDelete, "telephoneNumber", []string{}},
+		{ModDelete, "memberUid", []string{"0"}},
+		{ModAdd, "memberUid", []string{"10"}},
+		{ModAdd, "title", []string{"Engineer"}},
+	}
+	if len(modReq.Mods) != len(expected) {
+		t.Fatalf("expected %d mods got:\n%s", len(expected), modReq)
+	}
+	for i, e := range expected {
+		mod := modReq.Mods[i]
+		if mod.ModOperation != e.op || mod.Modification.Name != e.name ||
+			len(mod.Modification.Values) != len(e.values) {
+			t.Errorf("mod %d: expected %s %s %v got:\n%s", i, ModMap[e.op], e.name, e.values, mod.DumpMod())
+			continue
+		}
+		for j, value := range e.values {
+			if mod.Modification.Values[j] != value {
+				t.Errorf("mod %d: expected %v got %v", i, e.values, mod.Modification.Values)
+			}
+		}
+	}
+
+	// case sensitive and operational attributes
+	modReq = DiffEntries(current, desired, nil)
+	ops := map[string]uint8{}
+	for _, mod := range modReq.Mods {
+		ops[mod.Modification.Name] = mod.ModOperation
+	}
+	if op, ok := ops["mail"]; !ok || op != ModReplace {
+		t.Errorf("expected case sensitive mail replace: %s", modReq)
+	}
+	if op, ok := ops["modifyTimestamp"]; !ok || op != ModDelete {
+		t.Errorf("expected operational attribute delete: %s", modReq)
+	}
+
+	if modReq = DiffEntries(current, current, nil); len(modReq.Mods) != 0 {
+		t.Errorf("expected no mods for equal entries: %s", modReq)
+	}
+}
@@ -0,0 +1,381 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains typed attribute value parsing and formatting
+package ldap
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Seconds between the FILETIME epoch 1601-01-01 and the unix epoch.
+const fileTimeEpochOffset = 11644473600
+
+// ParseGeneralizedTime parses an RFC 4517 GeneralizedTime e.g.
+// 20130704153000Z, 201307041530.5+0100 or 20130704153000.0Z (AD).
+func ParseGeneralizedTime(value string) (time.Time, error) {
+	invalid := NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid generalizedTime: "+value)
+	s := value
+	digits := func(n int) (int, bool) {
+		if len(s) < n {
+			return 0, false
+		}
+		v := 0
+		for i := 0; i < n; i++ {
+			if s[i] < '0' || s[i] > '9' {
+				return 0, false
+			}
+			v = v*10 + int(s[i]-'0')
+		}
+		s = s[n:]
+		return v, true
+	}
+	var year, month, day, hour, min, sec int
+	var ok bool
+	if year, ok = digits(4); !ok {
+		return time.Time{}, invalid
+	}
+	if month, ok = digits(2); !ok || month < 1 || month > 12 {
+		return time.Time{}, invalid
+	}
+	if day, ok = digits(2); !ok || day < 1 || day > 31 {
+		return time.Time{}, invalid
+	}
+	if hour, ok = digits(2); !ok || hour > 23 {
+		return time.Time{}, invalid
+	}
+	// a fraction applies to the last unit given
+	unit := time.Hour
+	if min, ok = digits(2); ok {
+		unit = time.Minute
+		if sec, ok = digits(2); ok {
+			unit = time.Second
+		}
+	}
+	if min > 59 || sec > 60 {
+		return time.Time{}, invalid
+	}
+	var fraction time.Duration
+	if len(s) > 0 && (s[0] == '.' || s[0] == ',') {
+		end := 1
+		for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+			end++
+		}
+		if end == 1 {
+			return time.Time{}, invalid
+		}
+		f, err := strconv.ParseFloat("0."+s[1:end], 64)
+		if err != nil {
+			return time.Time{}, invalid
+		}
+		fraction = time.Duration(f * float64(unit))
+		s = s[end:]
+	}
+	var loc *time.Location
+	switch {
+	case s == "Z":
+		loc = time.UTC
+	case len(s) == 3 || len(s) == 5:
+		sign := 1
+		if s[0] == '-' {
+			sign = -1
+		} else if s[0] != '+' {
+			return time.Time{}, invalid
+		}
+		s = s[1:]
+		offsetHour, ok := digits(2)
+		if !ok || offsetHour > 23 {
+			return time.Time{}, invalid
+		}
+		offsetMin := 0
+		if len(s) > 0 {
+			if offsetMin, ok = digits(2); !ok || offsetMin > 59 {
+				return time.Time{}, invalid
+			}
+		}
+		loc = time.FixedZone("", sign*(offsetHour*3600+offsetMin*60))
+	default:
+		return time.Time{}, invalid
+	}
+	t := time.Date(year, time.Month(month), day, hour, min, sec, 0, loc)
+	if t.Day() != day && sec != 60 {
+		// e.g. February 30
+		return time.Time{}, invalid
+	}
+	return t.Add(fraction), nil
+}
+
+// FormatGeneralizedTime formats t in UTC as a GeneralizedTime, with
+// fractional seconds only when t has them.
+func FormatGeneralizedTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.999999999") + "Z"
+}
+
+// ParseBool parses an RFC 4517 Boolean, TRUE or FALSE.
+func ParseBool(value string) (bool, error) {
+	switch {
+	case strings.EqualFold(value, "TRUE"):
+		return true, nil
+	case strings.EqualFold(value, "FALSE"):
+		return false, nil
+	}
+	return false, NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid boolean: "+value)
+}
+
+// FormatBool returns TRUE or FALSE.
+func FormatBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// ParseFileTime parses an AD large integer FILETIME (100 nanosecond intervals
+// since 1601-01-01 UTC) e.g. lastLogon, pwdLastSet and accountExpires.
+// 0 and 9223372036854775807 (never) return the zero Time.
+func ParseFileTime(value string) (time.Time, error) {
+	ft, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ft < 0 {
+		return time.Time{}, NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid FILETIME: "+value)
+	}
+	if ft == 0 || ft == math.MaxInt64 {
+		return time.Time{}, nil
+	}
+	return time.Unix(ft/1e7-fileTimeEpochOffset, (ft%1e7)*100).UTC(), nil
+}
+
+// FormatFileTime formats t as an AD FILETIME, the zero Time is formatted as 0.
+func FormatFileTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	ft := (t.Unix()+fileTimeEpochOffset)*1e7 + int64(t.Nanosecond()/100)
+	return strconv.FormatInt(ft, 10)
+}
+
+// getSingleValue - the value of a single valued attribute, an error if the
+// attribute is missing or has more than one value.
+func (e *Entry) getSingleValue(attributeName string) (string, error) {
+	values := e.GetAttributeValues(attributeName)
+	switch len(values) {
+	case 0:
+		return "", NewLDAPError(LDAPResultNoSuchAttribute, "No value for attribute: "+attributeName)
+	case 1:
+		return values[0], nil
+	}
+	return "", NewLDAPError(LDAPResultConstraintViolation,
+		fmt.Sprintf("Expected a single value for attribute %s, got %d", attributeName, len(values)))
+}
+
+// GetAttributeInt - the value of a single valued INTEGER or AD large integer
+// attribute.
+func (e *Entry) GetAttributeInt(attributeName string) (int64, error) {
+	value, err := e.getSingleValue(attributeName)
+	if err != nil {
+		return 0, err
+	}
+	return parseInt(value)
+}
+
+// GetAttributeInts - all values of an INTEGER attribute, empty if missing.
+func (e *Entry) GetAttributeInts(attributeName string) ([]int64, error) {
+	values := e.GetAttributeValues(attributeName)
+	ints := make([]int64, len(values))
+	for i, value := range values {
+		var err error
+		if ints[i], err = parseInt(value); err != nil {
+			return nil, err
+		}
+	}
+	return ints, nil
+}
+
+func parseInt(value string) (int64, error) {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid integer: "+value)
+	}
+	return i, nil
+}
+
+// GetAttributeBool - the value of a single valued Boolean attribute.
+func (e *Entry) GetAttributeBool(attributeName string) (bool, error) {
+	value, err := e.getSingleValue(attributeName)
+	if err != nil {
+		return false, err
+	}
+	return ParseBool(value)
+}
+
+// GetAttributeBools - all values of a Boolean attribute, empty if missing.
+func (e *Entry) GetAttributeBools(attributeName string) ([]bool, error) {
+	values := e.GetAttributeValues(attributeName)
+	bools := make([]bool, len(values))
+	for i, value := range values {
+		var err error
+		if bools[i], err = ParseBool(value); err != nil {
+			return nil, err
+		}
+	}
+	return bools, nil
+}
+
+// GetAttributeTime - the value of a single valued GeneralizedTime attribute
+// e.g. createTimestamp.
+func (e *Entry) GetAttributeTime(attributeName string) (time.Time, error) {
+	value, err := e.getSingleValue(attributeName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ParseGeneralizedTime(value)
+}
+
+// GetAttributeTimes - all values of a GeneralizedTime attribute, empty if
+// missing.
+func (e *Entry) GetAttributeTimes(attributeName string) ([]time.Time, error) {
+	return e.getTimes(attributeName, ParseGeneralizedTime)
+}
+
+// GetAttributeFileTime - the value of a single valued AD FILETIME attribute
+// e.g. pwdLastSet, see ParseFileTime.
+func (e *Entry) GetAttributeFileTime(attributeName string) (time.Time, error) {
+	value, err := e.getSingleValue(attributeName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ParseFileTime(value)
+}
+
+// GetAttributeFileTimes - all values of an AD FILETIME attribute, empty if
+// missing.
+func (e *Entry) GetAttributeFileTimes(attributeName string) ([]time.Time, error) {
+	return e.getTimes(attributeName, ParseFileTime)
+}
+
+func (e *Entry) getTimes(attributeName string, parse func(string) (time.Time, error)) ([]time.Time, error) {
+	values := e.GetAttributeValues(attributeName)
+	times := make([]time.Time, len(values))
+	for i, value := range values {
+		var err error
+		if times[i], err = parse(value); err != nil {
+			return nil, err
+		}
+	}
+	return times, nil
+}
+
+// GetAttributeDN - the value of a single valued DN attribute e.g. manager,
+// checked to be a valid RFC 4514 DN.
+func (e *Entry) GetAttributeDN(attributeName string) (string, error) {
+	value, err := e.getSingleValue(attributeName)
+	if err != nil {
+		return "", err
+	}
+	if err := validateDN(value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// GetAttributeDNs - all values of a DN attribute e.g. member, empty if
+// missing.
+func (e *Entry) GetAttributeDNs(attributeName string) ([]string, error) {
+	values := e.GetAttributeValues(attributeName)
+	for _, value := range values {
+		if err := validateDN(value); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// validateDN checks the RFC 4514 string representation of a DN.
+func validateDN(dn string) error {
+	if _, err := ParseDN(dn); err != nil {
+		return NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid DN: "+dn)
+	}
+	return nil
+}
+
+// AddAttributeIntValues - Add INTEGER values
+func (e *Entry) AddAttributeIntValues(attributeName string, values []int64) {
+	e.AddAttributeValues(attributeName, FormatInts(values))
+}
+
+// AddAttributeBoolValues - Add Boolean values
+func (e *Entry) AddAttributeBoolValues(attributeName string, values []bool) {
+	e.AddAttributeValues(attributeName, FormatBools(values))
+}
+
+// AddAttributeTimeValues - Add GeneralizedTime values
+func (e *Entry) AddAttributeTimeValues(attributeName string, values []time.Time) {
+	e.AddAttributeValues(attributeName, FormatGeneralizedTimes(values))
+}
+
+// AddAttributeFileTimeValues - Add AD FILETIME values
+func (e *Entry) AddAttributeFileTimeValues(attributeName string, values []time.Time) {
+	e.AddAttributeValues(attributeName, FormatFileTimes(values))
+}
+
+// NewModInt - NewMod with INTEGER values.
+func NewModInt(modType uint8, attr string, values []int64) *Mod {
+	return NewMod(modType, attr, FormatInts(values))
+}
+
+// NewModBool - NewMod with Boolean values.
+func NewModBool(modType uint8, attr string, values []bool) *Mod {
+	return NewMod(modType, attr, FormatBools(values))
+}
+
+// NewModTime - NewMod with GeneralizedTime values.
+func NewModTime(modType uint8, attr string, values []time.Time) *Mod {
+	return NewMod(modType, attr, FormatGeneralizedTimes(values))
+}
+
+// NewModFileTime - NewMod with AD FILETIME values.
+func NewModFileTime(modType uint8, attr string, values []time.Time) *Mod {
+	return NewMod(modType, attr, FormatFileTimes(values))
+}
+
+// FormatInts formats INTEGER values, for NewMod and AddRequest attributes.
+func FormatInts(values []int64) []string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = strconv.FormatInt(value, 10)
+	}
+	return formatted
+}
+
+// FormatBools formats Boolean values, for NewMod and AddRequest attributes.
+func FormatBools(values []bool) []string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = FormatBool(value)
+	}
+	return formatted
+}
+
+// FormatGeneralizedTimes formats GeneralizedTime values, for NewMod and
+// AddRequest attributes.
+func FormatGeneralizedTimes(values []time.Time) []string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = FormatGeneralizedTime(value)
+	}
+	return formatted
+}
+
+// FormatFileTimes formats AD FILETIME values, for NewMod and AddRequest
+// attributes.
+func FormatFileTimes(values []time.Time) []string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = FormatFileTime(value)
+	}
+	return formatted
+}
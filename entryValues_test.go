@@ -0,0 +1,125 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseGeneralizedTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"20130704153000Z", time.Date(2013, 7, 4, 15, 30, 0, 0, time.UTC)},
+		{"20130704153000.0Z", time.Date(2013, 7, 4, 15, 30, 0, 0, time.UTC)},
+		{"20130704153000.25Z", time.Date(2013, 7, 4, 15, 30, 0, 250000000, time.UTC)},
+		{"201307041530,5Z", time.Date(2013, 7, 4, 15, 30, 30, 0, time.UTC)},
+		{"2013070415Z", time.Date(2013, 7, 4, 15, 0, 0, 0, time.UTC)},
+		{"20130704153000+0100", time.Date(2013, 7, 4, 14, 30, 0, 0, time.UTC)},
+		{"20130704153000-05", time.Date(2013, 7, 4, 20, 30, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := ParseGeneralizedTime(test.value)
+		if err != nil {
+			t.Errorf("%s: %s", test.value, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("%s: got %s want %s", test.value, got, test.want)
+		}
+	}
+	for _, value := range []string{"", "20130704153000", "2013070415300Z", "20131304153000Z",
+		"20130230153000Z", "20130704153000.Z", "20130704153000+1", "2013-07-04T15:30:00Z"} {
+		if _, err := ParseGeneralizedTime(value); err == nil {
+			t.Errorf("%s: expected error", value)
+		}
+	}
+	ts := time.Date(2013, 7, 4, 15, 30, 0, 500000000, time.FixedZone("", 3600))
+	if s := FormatGeneralizedTime(ts); s != "20130704143000.5Z" {
+		t.Errorf("unexpected format %s", s)
+	}
+}
+
+func TestFileTime(t *testing.T) {
+	ts, err := ParseFileTime("130173696000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2013, 7, 4, 0, 0, 0, 0, time.UTC); !ts.Equal(want) {
+		t.Errorf("got %s want %s", ts, want)
+	}
+	if s := FormatFileTime(ts); s != "130173696000000000" {
+		t.Errorf("unexpected format %s", s)
+	}
+	for _, never := range []string{"0", "9223372036854775807"} {
+		if ts, err := ParseFileTime(never); err != nil || !ts.IsZero() {
+			t.Errorf("%s: expected zero time got %s %v", never, ts, err)
+		}
+	}
+	if _, err := ParseFileTime("-1"); err == nil {
+		t.Errorf("expected error for negative FILETIME")
+	}
+}
+
+func TestEntryTypedValues(t *testing.T) {
+	created := time.Date(2013, 7, 4, 15, 30, 0, 0, time.UTC)
+	e := NewEntry("cn=bob,o=example")
+	e.AddAttributeIntValues("uidNumber", []int64{1000})
+	e.AddAttributeIntValues("badPwdCount", []int64{1, 2})
+	e.AddAttributeBoolValues("isDeleted", []bool{true})
+	e.AddAttributeTimeValues("createTimestamp", []time.Time{created})
+	e.AddAttributeFileTimeValues("pwdLastSet", []time.Time{created})
+	e.AddAttributeValues("manager", []string{`cn=Smith\, J,o=example`})
+	e.AddAttributeValues("member", []string{"cn=a+uid=a,o=example", "cn=#1", "cn=b,o=exa;mple"})
+	e.AddAttributeValues("description", []string{"not a number"})
+
+	if i, err := e.GetAttributeInt("uidnumber"); err != nil || i != 1000 {
+		t.Errorf("GetAttributeInt: %d %v", i, err)
+	}
+	if ints, err := e.GetAttributeInts("badPwdCount"); err != nil || len(ints) != 2 || ints[1] != 2 {
+		t.Errorf("GetAttributeInts: %v %v", ints, err)
+	}
+	if b, err := e.GetAttributeBool("isDeleted"); err != nil || !b {
+		t.Errorf("GetAttributeBool: %t %v", b, err)
+	}
+	if ts, err := e.GetAttributeTime("createTimestamp"); err != nil || !ts.Equal(created) {
+		t.Errorf("GetAttributeTime: %s %v", ts, err)
+	}
+	if ts, err := e.GetAttributeFileTime("pwdLastSet"); err != nil || !ts.Equal(created) {
+		t.Errorf("GetAttributeFileTime: %s %v", ts, err)
+	}
+	if dn, err := e.GetAttributeDN("manager"); err != nil || dn != `cn=Smith\, J,o=example` {
+		t.Errorf("GetAttributeDN: %s %v", dn, err)
+	}
+	if _, err := e.GetAttributeDNs("member"); err == nil {
+		t.Errorf("expected invalid DN error")
+	}
+	if times, err := e.GetAttributeTimes("modifyTimestamp"); err != nil || len(times) != 0 {
+		t.Errorf("missing multi valued attribute: %v %v", times, err)
+	}
+
+	errorCodes := map[string]uint8{
+		"sn":          LDAPResultNoSuchAttribute,
+		"badPwdCount": LDAPResultConstraintViolation,
+		"description": LDAPResultInvalidAttributeSyntax,
+	}
+	for name, code := range errorCodes {
+		_, err := e.GetAttributeInt(name)
+		if lerr, ok := err.(*LDAPError); !ok || lerr.ResultCode != code {
+			t.Errorf("%s: expected result code %d got %v", name, code, err)
+		}
+	}
+
+	mod := NewModTime(ModReplace, "createTimestamp", []time.Time{created})
+	if mod.Modification.Values[0] != "20130704153000Z" {
+		t.Errorf("NewModTime: %v", mod.Modification.Values)
+	}
+	mod = NewModBool(ModReplace, "isDeleted", []bool{false})
+	if mod.Modification.Values[0] != "FALSE" {
+		t.Errorf("NewModBool: %v", mod.Modification.Values)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"bytes"
+	"github.com/mavricknz/asn1-ber"
+	"strings"
+	"testing"
+)
+
+// objectGUID like value, invalid UTF-8 with NUL, CR and LF bytes.
+var binaryValue = []byte{0x00, 0xff, 0x80, 0x0d, 0x0a, 0xc3, 0x28, 0x7f, 0xfe}
+
+func TestEntryByteValues(t *testing.T) {
+	e := NewEntry("cn=bin,o=example")
+	e.AddAttributeByteValue("objectGUID", binaryValue)
+	e.AddAttributeValue("cn", "世界")
+
+	// search result entry off the wire
+	packet := ber.DecodePacket(testResponse(newTestMessageIDPacket(), testEntry(e), nil).Bytes())
+	dsr, err := decodeSearchResponse(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dsr.Entry.GetAttributeByteValues("objectGUID"); len(got) != 1 || !bytes.Equal(got[0], binaryValue) {
+		t.Errorf("binary value not preserved by search decode: %x", got)
+	}
+	if got := dsr.Entry.GetAttributeValues("cn"); got[0] != "世界" {
+		t.Errorf("utf8 value not preserved by search decode: %q", got)
+	}
+
+	// add request encoding
+	addReq := &AddRequest{Entry: e}
+	p, err := encodeAddRequest(addReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = ber.DecodePacket(p.Bytes())
+	if got := p.Children[1].Children[0].Children[1].Children[0].Data.Bytes(); !bytes.Equal(got, binaryValue) {
+		t.Errorf("binary value not preserved by add encode: %x", got)
+	}
+
+	// modify request encoding
+	modReq := NewModifyRequest(e.DN)
+	modReq.AddMod(NewModBytes(ModReplace, "jpegPhoto", [][]byte{binaryValue}))
+	p = ber.DecodePacket(encodeModifyRequest(modReq).Bytes())
+	if got := p.Children[1].Children[0].Children[1].Children[1].Children[0].Data.Bytes(); !bytes.Equal(got, binaryValue) {
+		t.Errorf("binary value not preserved by modify encode: %x", got)
+	}
+}
+
+func TestCompareRequestValue(t *testing.T) {
+	for _, value := range []string{"*", `a\2a`, string(binaryValue)} {
+		p, err := encodeCompareRequest(NewCompareRequest("cn=a,o=example", "description", value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ava := ber.DecodePacket(p.Bytes()).Children[1]
+		if ava.ClassType != ber.ClassUniversal || ava.Tag != ber.TagSequence {
+			t.Errorf("AttributeValueAssertion is not a SEQUENCE")
+		}
+		if got := string(ava.Children[1].Data.Bytes()); got != value {
+			t.Errorf("compare value %q encoded as %q", value, got)
+		}
+	}
+}
+
+func TestLDIFByteValues(t *testing.T) {
+	e := NewEntry("cn=bin,o=example")
+	e.AddAttributeByteValue("objectGUID", binaryValue)
+	modReq := NewModifyRequest(e.DN)
+	modReq.AddMod(NewModBytes(ModReplace, "userCertificate", [][]byte{binaryValue}))
+
+	buf := new(bytes.Buffer)
+	lw, _ := NewLDIFWriter(buf)
+	if err := lw.WriteLDIFRecord(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := lw.WriteLDIFRecord(modReq); err != nil {
+		t.Fatal(err)
+	}
+
+	lr, _ := NewLDIFReader(strings.NewReader(buf.String()))
+	record, err := lr.ReadLDIFEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := record.(*Entry).GetAttributeByteValues("objectGUID"); !bytes.Equal(got[0], binaryValue) {
+		t.Errorf("binary entry value not preserved by LDIF: %x", got)
+	}
+	record, err = lr.ReadLDIFEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := record.(*ModifyRequest).Mods[0].Modification.ByteValues(); !bytes.Equal(got[0], binaryValue) {
+		t.Errorf("binary mod value not preserved by LDIF: %x", got)
+	}
+}
+
+func TestAttributeDescription(t *testing.T) {
+	ad, err := ParseAttributeDescription("userCertificate;binary;lang-en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ad.Type != "userCertificate" || len(ad.Options) != 2 || !ad.HasOption("BINARY") {
+		t.Errorf("unexpected parse %+v", ad)
+	}
+	if ad.String() != "userCertificate;binary;lang-en" {
+		t.Errorf("unexpected String %s", ad)
+	}
+	for _, desc := range []string{"member;range=0-1499", "2.5.4.3", "cn;x-custom-1"} {
+		if _, err := ParseAttributeDescription(desc); err != nil {
+			t.Errorf("%s: %s", desc, err)
+		}
+	}
+	for _, desc := range []string{"", "1cn", "cn;", "cn;lang_en", "2.5.04.3", "cn=x"} {
+		if _, err := ParseAttributeDescription(desc); err == nil {
+			t.Errorf("%s: expected error", desc)
+		}
+	}
+
+	if !AttributeDescriptionsEqual("CN;Lang-EN;binary", "cn;binary;lang-en") {
+		t.Errorf("options should be case and order insensitive")
+	}
+	if AttributeDescriptionsEqual("cn;lang-en", "cn") {
+		t.Errorf("subtype should not be equal")
+	}
+}
+
+func TestEntryAttributeLookup(t *testing.T) {
+	e := NewEntry("cn=bob,o=example")
+	e.AddAttributeValue("Mail", "bob@example.com")
+	e.AddAttributeValue("cn;lang-fr", "Robert")
+	e.AddAttributeValue("cn", "bob")
+	e.AddAttributeValue("userCertificate;binary", "\x30\x82")
+	e.AddAttributeValue("mail", "b@example.com")
+
+	if values := e.GetAttributeValues("mail"); len(values) != 2 {
+		t.Errorf("case-insensitive lookup failed: %v", values)
+	}
+	if values := e.GetAttributeValues("userCertificate"); len(values) != 1 {
+		t.Errorf("subtype lookup failed: %v", values)
+	}
+	if values := e.GetAttributeValues("userCertificate;lang-en"); len(values) != 0 {
+		t.Errorf("unexpected values for missing option: %v", values)
+	}
+	if values := e.GetAttributeValues("CN"); len(values) != 2 || values[0] != "bob" {
+		t.Errorf("exact match should be first: %v", values)
+	}
+	if values := e.GetAttributeValues("cn;LANG-FR"); len(values) != 1 || values[0] != "Robert" {
+		t.Errorf("option lookup failed: %v", values)
+	}
+	if e.GetAttributeIndex("commonName") != -1 {
+		t.Errorf("aliases should not match without SetDefaultAttributeAliases")
+	}
+
+	SetDefaultAttributeAliases(StandardAttributeAliases())
+	defer SetDefaultAttributeAliases(nil)
+	for _, name := range []string{"commonName", "2.5.4.3"} {
+		if values := e.GetAttributeValues(name); len(values) != 2 {
+			t.Errorf("%s: alias lookup failed: %v", name, values)
+		}
+	}
+	if values := e.GetAttributeValues("0.9.2342.19200300.100.1.3"); len(values) != 2 {
+		t.Errorf("OID lookup failed: %v", values)
+	}
+}
+
+func TestSetDefaultAttributeAliases(t *testing.T) {
+	aliases := AttributeAliases{}
+	aliases.Add("cn", "commonName")
+	SetDefaultAttributeAliases(aliases)
+	defer SetDefaultAttributeAliases(nil)
+	// copied when set
+	aliases.Add("sn", "surname")
+	if !AttributeDescriptionsEqual("cn", "commonName") || AttributeDescriptionsEqual("sn", "surname") {
+		t.Errorf("unexpected aliases %v", DefaultAttributeAliases())
+	}
+	SetDefaultAttributeAliases(nil)
+	if DefaultAttributeAliases() != nil || AttributeDescriptionsEqual("cn", "commonName") {
+		t.Errorf("aliases not cleared")
+	}
+}
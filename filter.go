@@ -4,7 +4,7 @@
 
 // File contains a filter compiler/decompiler
 
-// Influenced by Perl LDAP and OpenDJ, esp regex's.
+// Influenced by Perl LDAP and OpenDJ.
 
 /*
 An LDAP search filter is defined in Section 4.5.1 of [RFC4511]
@@ -58,6 +58,8 @@ import (
 	"fmt"
 	"github.com/mavricknz/asn1-ber"
 	"regexp"
+	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -119,334 +121,417 @@ var FilterComponent = map[string]uint64{
 	"~=": FilterApproxMatch,
 }
 
-var opRegex *regexp.Regexp
-var endRegex *regexp.Regexp
-var itemRegex *regexp.Regexp
-var unescapedWildCardRegex *regexp.Regexp
-var wildCardSearchRegex *regexp.Regexp
 var unescapeFilterRegex *regexp.Regexp
 var escapeFilterRegex *regexp.Regexp
 
 var FilterDebug bool = false
 
 func init() {
-	opRegex = regexp.MustCompile(`^\(\s*([&!|])\s*`)
-	endRegex = regexp.MustCompile(`^\)\s*`)
-	itemRegex = regexp.MustCompile(
-		`^\(\s*([-;.:\d\w]*[-;\d\w])\s*([:~<>]?=)((?:\\.|[^\\()]+)*)\)\s*`)
-	unescapedWildCardRegex = regexp.MustCompile(`^(\\.|[^\\*]+)*\*`)
-	wildCardSearchRegex = regexp.MustCompile(`^((\\.|[^\\*]+)*)\*`)
 	unescapeFilterRegex = regexp.MustCompile(`\\([\da-fA-F]{2}|[()\\*])`)
 	escapeFilterRegex = regexp.MustCompile(`([\\\(\)\*\0-\37\177-\377])`)
 }
 
+// Nesting deeper than this is rejected, filters come from untrusted input.
+const maxFilterDepth = 256
+
+// CompileFilter compiles an RFC 4515 filter string to the packet used in a
+// SearchRequest, see ParseFilter.
 func CompileFilter(filter string) (*ber.Packet, error) {
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return f.Encode()
+}
+
+// ParseFilter parses an RFC 4515 filter string to a Filter. Values are
+// unescaped, \XX hex escapes and the older \( \) \\ \* forms are accepted.
+// RFC 4526 absolute true (&) and false (|) are allowed. Whitespace is
+// allowed around parentheses and before the filter type.
+func ParseFilter(filter string) (Filter, error) {
 	if len(filter) == 0 {
 		return nil, NewLDAPError(ErrorFilterCompile, "Filter of zero length")
 	}
 	if filter[0] != '(' {
 		return nil, NewLDAPError(ErrorFilterCompile, "Filter does not start with '('")
 	}
-	return filterParse(filter)
+	if !utf8.ValidString(filter) {
+		pos := 0
+		for pos < len(filter) {
+			r, size := utf8.DecodeRuneInString(filter[pos:])
+			if r == utf8.RuneError && size <= 1 {
+				break
+			}
+			pos += size
+		}
+		return nil, filterCompileError(filter, pos, "invalid UTF-8")
+	}
+	p := &filterParser{filter: filter}
+	f, err := p.parseFilter(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(filter) {
+		return nil, filterCompileError(filter, p.pos, "extra characters after filter")
+	}
+	return f, nil
 }
 
-func filterParse(filter string) (*ber.Packet, error) {
-	var err error
-	var pTmp1 *ber.Packet
-	pos := 0
-	bracketCount := 0
+func filterCompileError(filter string, pos int, msg string) error {
+	return NewLDAPError(ErrorFilterCompile, fmt.Sprintf("%s at position %d: %q", msg, pos, filter))
+}
 
-	p := make([]*ber.Packet, 0, 5)
+// filterParser is a single pass recursive-descent parser for
+//
+//	filter         = LPAREN filtercomp RPAREN
+//	filtercomp     = and / or / not / item
+//	and            = AMPERSAND filterlist
+//	or             = VERTBAR filterlist
+//	not            = EXCLAMATION filter
+//	filterlist     = 1*filter
+//	item           = simple / present / substring / extensible
+//	simple         = attr filtertype assertionvalue
+//	filtertype     = equal / approx / greaterorequal / lessorequal
+//	extensible     = ( attr [dnattrs] [matchingrule] COLON EQUALS assertionvalue )
+//	                 / ( [dnattrs] matchingrule COLON EQUALS assertionvalue )
+//	present        = attr EQUALS ASTERISK
+//	substring      = attr EQUALS [initial] any [final]
+//	dnattrs        = COLON "dn"
+//	matchingrule   = COLON oid
+type filterParser struct {
+	filter string
+	pos    int
+	// template allows %s, %b and %% in values, see FilterTemplate
+	template     bool
+	itemStart    int
+	placeholders []filterPlaceholder
+}
 
-	// Simple non recursive method to create ber packets.
-	// If its an Op "&|!" then push onto the stack
-	// If its a filter expression (item) then add as a child
-	// if its an ending ) pop the stack adding as child to above.
-	// plus special cases of course.
+func (p *filterParser) error(msg string) error {
+	return filterCompileError(p.filter, p.pos, msg)
+}
 
-	for {
-		if matches := opRegex.FindStringSubmatch(filter[pos:]); len(matches) != 0 {
-			pos += len(matches[0])
-			pTmp1, err = filterEncode(FilterComponent[matches[1]], nil)
-			if err != nil {
-				return nil, err
-			}
-			p = append(p, pTmp1)
-			bracketCount++
-			continue
-		} else if matches := endRegex.FindStringSubmatch(filter[pos:]); len(matches) != 0 {
-			if bracketCount <= 0 {
-				return nil, NewLDAPError(ErrorFilterCompile,
-					"Finished compiling filter with extra at end :"+
-						fmt.Sprint(filter[pos:]))
-			}
-			bracketCount--
-			pos += len(matches[0])
-			pTmp1 = p[len(p)-1] // copy last *ber (sequence of values)
-			if len(p) > 1 {     // not root of "tree"
-				p[len(p)-2].AppendChild(pTmp1) // add as child to previous op
-				p = p[:len(p)-1]               // pop stack
-			}
-			continue
-		} else if matches := itemRegex.FindStringSubmatch(filter[pos:]); len(matches) != 0 {
-			pos += len(matches[0])
-			pTmp1, err = filterEncode(FilterItem, matches[1:4])
+func (p *filterParser) skipSpace() {
+	for p.pos < len(p.filter) && (p.filter[p.pos] == ' ' || p.filter[p.pos] == '\t' ||
+		p.filter[p.pos] == '\n' || p.filter[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+// next is 0 at the end of the filter.
+func (p *filterParser) next() byte {
+	if p.pos < len(p.filter) {
+		return p.filter[p.pos]
+	}
+	return 0
+}
+
+func (p *filterParser) parseFilter(depth int) (Filter, error) {
+	if depth > maxFilterDepth {
+		return nil, p.error("filter nested too deeply")
+	}
+	if p.next() != '(' {
+		return nil, p.error("expected '('")
+	}
+	start := p.pos
+	p.pos++
+	p.skipSpace()
+	var f Filter
+	var err error
+	switch p.next() {
+	case '&', '|':
+		op := p.next()
+		p.pos++
+		p.skipSpace()
+		filters := make([]Filter, 0, 2)
+		for p.next() == '(' {
+			child, err := p.parseFilter(depth + 1)
 			if err != nil {
 				return nil, err
 			}
-			if len(p) == 0 { // case (attr=yyyy)
-				p = append(p, pTmp1)
-			} else {
-				p[len(p)-1].AppendChild(pTmp1)
+			filters = append(filters, child)
+		}
+		if op == '&' {
+			f = &AndFilter{Filters: filters}
+		} else {
+			f = &OrFilter{Filters: filters}
+		}
+	case '!':
+		p.pos++
+		p.skipSpace()
+		child, err := p.parseFilter(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		f = &NotFilter{Filter: child}
+	default:
+		p.itemStart = start
+		n := len(p.placeholders)
+		if f, err = p.parseItem(); err != nil {
+			return nil, err
+		}
+		if p.next() == ')' {
+			for i := n; i < len(p.placeholders); i++ {
+				p.placeholders[i].itemEnd = p.pos + 1
 			}
-			continue
 		}
-		break
 	}
-	//if len(p) > 0 {
-	//	ber.PrintPacket(p[0])
-	//}
-	if len(filter[pos:]) > 0 {
-		return nil, NewLDAPError(ErrorFilterCompile, filter+" : Error compiling filter, invalid filter : "+fmt.Sprint(filter[pos:]))
+	if p.next() != ')' {
+		return nil, p.error("expected ')'")
 	}
-	return p[0], nil
+	p.pos++
+	p.skipSpace()
+	return f, nil
 }
 
-func filterEncode(opType uint64, value []string) (*ber.Packet, error) {
-	var p *ber.Packet = nil
-	var err error
-
-	// condense and/or/not into one case.
-	switch opType {
-	case FilterAnd, FilterOr, FilterNot:
-		if FilterDebug {
-			fmt.Println(FilterMap[opType])
+func (p *filterParser) parseItem() (Filter, error) {
+	var attr string
+	if p.next() != ':' {
+		var err error
+		if attr, err = p.parseAttributeDescription(); err != nil {
+			return nil, err
 		}
-		p = ber.Encode(ber.ClassContext, ber.TypeConstructed, uint8(opType), nil, FilterMap[opType])
-	case FilterItem:
-		if FilterDebug {
-			fmt.Println("FilterItem")
+		p.skipSpace()
+	}
+	switch {
+	case p.next() == ':':
+		return p.parseExtensible(attr)
+	case p.next() == '=':
+		p.pos++
+		return p.parseEqualityOrSubstrings(attr)
+	case strings.HasPrefix(p.filter[p.pos:], "~="), strings.HasPrefix(p.filter[p.pos:], ">="),
+		strings.HasPrefix(p.filter[p.pos:], "<="):
+		op := p.filter[p.pos]
+		p.pos += 2
+		value, err := p.parseValue(false)
+		if err != nil {
+			return nil, err
 		}
-		p, err = encodeItem(value)
+		switch op {
+		case '~':
+			return &ApproxFilter{Attribute: attr, Value: value}, nil
+		case '>':
+			return &GreaterOrEqualFilter{Attribute: attr, Value: value}, nil
+		}
+		return &LessOrEqualFilter{Attribute: attr, Value: value}, nil
 	}
-	return p, err
+	return nil, p.error("expected filter type")
 }
 
-func encodeItem(attrOpVal []string) (*ber.Packet, error) {
-	attr, op, val := attrOpVal[0], attrOpVal[1], attrOpVal[2]
-	if FilterDebug {
-		fmt.Println(attr, op, val)
-	}
-
-	if op == ":=" {
-		return encodeExtensibleMatch(attr, val)
+// parseAttributeDescription - RFC 4512 attributedescription, keychar also
+// allows '_' as used by some servers.
+func (p *filterParser) parseAttributeDescription() (string, error) {
+	start := p.pos
+	if err := p.parseOID(); err != nil {
+		return "", err
 	}
-
-	if op == "=" {
-		if val == "*" { // simple present
-			p := ber.NewString(ber.ClassContext, ber.TypePrimative, FilterPresent, attr, FilterMap[FilterPresent])
-			return p, nil
-		} else if unescapedWildCardRegex.Match([]byte(val)) {
-			// TODO ADD escaping.
-			return encodeSubStringMatch(attr, val)
+	for p.next() == ';' {
+		p.pos++
+		if !isKeyChar(p.next()) {
+			return "", p.error("expected attribute option")
+		}
+		for isKeyChar(p.next()) {
+			p.pos++
 		}
 	}
-
-	p, _ := AttributeValueAssertion(attr, op, val)
-	return p, nil
+	return p.filter[start:p.pos], nil
 }
 
-/*
-substrings         [4] SubstringFilter,
-
-SubstringFilter ::= SEQUENCE {
-            type    AttributeDescription,
-            -- initial and final can occur at most once
-            substrings    SEQUENCE SIZE (1..MAX) OF substring CHOICE {
-             initial        [0] AssertionValue,
-             any            [1] AssertionValue,
-             final          [2] AssertionValue } }
-*/
-
-func encodeSubStringMatch(attr, value string) (*ber.Packet, error) {
-	p := ber.Encode(ber.ClassContext, ber.TypeConstructed,
-		FilterSubstrings, nil, FilterMap[FilterSubstrings])
-	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, attr, "type"))
-	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "substrings")
-
-	pos := 0
-
-	for {
-		matches := wildCardSearchRegex.FindStringSubmatch(value[pos:])
-		if FilterDebug {
-			fmt.Println(matches)
+// parseOID - descr or numericoid
+func (p *filterParser) parseOID() error {
+	c := p.next()
+	switch {
+	case isAlpha(c):
+		for isKeyChar(p.next()) {
+			p.pos++
 		}
+	case c >= '0' && c <= '9':
+		for {
+			if !isDigit(p.next()) {
+				return p.error("expected number in OID")
+			}
+			if p.next() == '0' && isDigit(p.peek(1)) {
+				return p.error("leading zero in OID")
+			}
+			for isDigit(p.next()) {
+				p.pos++
+			}
+			if p.next() != '.' {
+				break
+			}
+			p.pos++
+		}
+	default:
+		return p.error("expected attribute description")
+	}
+	return nil
+}
 
-		// not match found return error
+func (p *filterParser) peek(n int) byte {
+	if p.pos+n < len(p.filter) {
+		return p.filter[p.pos+n]
+	}
+	return 0
+}
 
-		if matches == nil && pos == 0 {
-			if FilterDebug {
-				fmt.Println("Did not match filter")
+func (p *filterParser) parseExtensible(attr string) (Filter, error) {
+	f := &ExtensibleMatchFilter{Attribute: attr}
+	for p.next() == ':' {
+		p.pos++
+		if p.next() == '=' {
+			if len(f.Attribute) == 0 && len(f.MatchingRule) == 0 {
+				return nil, p.error("extensible match requires an attribute or matching rule")
 			}
-			return nil, NewLDAPError(ErrorFilterCompile, "Did not match filter.")
-		}
-		// attr=*XXX
-		if len(matches) == 0 {
-			break
-		}
-		// initial
-		if pos == 0 && len(matches[1]) > 0 {
-			if FilterDebug {
-				fmt.Println("initial : " + matches[1])
+			p.pos++
+			value, err := p.parseValue(false)
+			if err != nil {
+				return nil, err
 			}
-			seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, FilterSubstringsInitial, UnescapeFilterValue(matches[1]), "initial"))
+			f.Value = value
+			return f, nil
 		}
-		// past initial but not end
-		if pos > 0 && len(matches) > 1 && len(matches[1]) > 0 {
-			if FilterDebug {
-				fmt.Println("any : " + matches[1])
-			}
-			seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, FilterSubstringsAny, UnescapeFilterValue(matches[1]), "any"))
+		if len(f.MatchingRule) > 0 {
+			return nil, p.error("expected ':='")
 		}
-
-		pos += len(matches[0])
-		if pos == len(value) {
-			break
+		start := p.pos
+		if err := p.parseOID(); err != nil {
+			return nil, err
 		}
-	}
-	if len(value[pos:]) > 0 {
-		if FilterDebug {
-			fmt.Println("final : " + value[pos:])
+		token := p.filter[start:p.pos]
+		if strings.EqualFold(token, "dn") && !f.DNAttributes && p.next() == ':' {
+			f.DNAttributes = true
+		} else {
+			f.MatchingRule = token
 		}
-		seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, FilterSubstringsFinal, UnescapeFilterValue(value[pos:]), "final"))
 	}
-	p.AppendChild(seq)
-	if FilterDebug {
-		fmt.Println(hex.Dump(p.Bytes()))
-	}
-	return p, nil
+	return nil, p.error("expected ':='")
 }
 
-/*
-extensibleMatch    [9] MatchingRuleAssertion
-
-MatchingRuleAssertion ::= SEQUENCE {
-            matchingRule    [1] MatchingRuleId OPTIONAL,
-            type            [2] AttributeDescription OPTIONAL,
-            matchValue      [3] AssertionValue,
-            dnAttributes    [4] BOOLEAN DEFAULT FALSE }
-*/
-
-func encodeExtensibleMatch(attr, value string) (*ber.Packet, error) {
-	//TODO make cacheable
-	extenseRegex := regexp.MustCompile(`^([-;\d\w]*)(:dn)?(:(\w+|[.\d]+))?$`)
-	p := ber.Encode(ber.ClassContext, ber.TypeConstructed,
-		FilterExtensibleMatch, nil, FilterMap[FilterExtensibleMatch])
-	if matches := extenseRegex.FindStringSubmatch(attr); len(matches) != 0 {
-		if FilterDebug {
-			fmt.Println(matches)
-		}
-		rtype := matches[1]
-		dn := matches[2]
-		rule := matches[4]
-
-		if len(rule) > 0 {
-			prule := ber.NewString(ber.ClassContext, ber.TypePrimative, TagMatchingRule, rule, "matchingRule")
-			p.AppendChild(prule)
+func (p *filterParser) parseEqualityOrSubstrings(attr string) (Filter, error) {
+	start, placeholders := p.pos, len(p.placeholders)
+	// split on unescaped asterisks
+	parts := make([]string, 0, 1)
+	for {
+		value, err := p.parseValue(true)
+		if err != nil {
+			return nil, err
 		}
-		if len(rtype) > 0 {
-			ptype := ber.NewString(ber.ClassContext, ber.TypePrimative, TagMatchingType, rtype, "type")
-			p.AppendChild(ptype)
+		parts = append(parts, value)
+		if p.next() != '*' {
+			break
 		}
-		pval := ber.NewString(ber.ClassContext, ber.TypePrimative, TagMatchValue, UnescapeFilterValue(value), "matchValue")
-		p.AppendChild(pval)
-		if len(dn) > 0 {
-			pdn := ber.NewBoolean(ber.ClassContext, ber.TypePrimative, TagMatchDnAttributes, true, "dnAttributes")
-			p.AppendChild(pdn)
+		p.pos++
+	}
+	if len(parts) == 1 {
+		return &EqualityFilter{Attribute: attr, Value: parts[0]}, nil
+	}
+	for i := placeholders; i < len(p.placeholders); i++ {
+		p.placeholders[i].substrings = true
+	}
+	f := &SubstringsFilter{Attribute: attr, Initial: parts[0], Final: parts[len(parts)-1]}
+	for _, any := range parts[1 : len(parts)-1] {
+		// empty any values e.g. (cn=a**b) are ignored
+		if len(any) > 0 {
+			f.Any = append(f.Any, any)
 		}
-	} else {
-		return nil, NewLDAPError(ErrorFilterCompile,
-			"Invalid Extensible attr : "+attr)
 	}
-	if FilterDebug {
-		fmt.Println(hex.Dump(p.Bytes()))
+	if len(f.Initial) == 0 && len(f.Any) == 0 && len(f.Final) == 0 {
+		if len(parts) == 2 {
+			return &PresentFilter{Attribute: attr}, nil
+		}
+		// e.g. (cn=**), there are no substrings to encode
+		p.pos = start
+		return nil, p.error("substrings assertion without a value")
 	}
-	return p, nil
+	return f, nil
 }
 
-func DecompileFilter(packet *ber.Packet) (ret string, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = NewLDAPError(ErrorFilterDecompile, "Error decompiling filter")
-		}
-	}()
-	ret = "("
-	err = nil
-	child_str := ""
-
-	switch packet.Tag {
-	case FilterAnd:
-		ret += "&"
-		for _, child := range packet.Children {
-			child_str, err = DecompileFilter(child)
-			if err != nil {
-				return
+// parseValue unescapes an assertion value up to ')', or '*' if
+// stopAtAsterisk.
+func (p *filterParser) parseValue(stopAtAsterisk bool) (string, error) {
+	start := p.pos
+	var value []byte
+	for p.pos < len(p.filter) {
+		c := p.filter[p.pos]
+		switch c {
+		case ')':
+			if value == nil {
+				return p.filter[start:p.pos], nil
 			}
-			ret += child_str
-		}
-	case FilterOr:
-		ret += "|"
-		for _, child := range packet.Children {
-			child_str, err = DecompileFilter(child)
-			if err != nil {
-				return
+			return string(value), nil
+		case '*':
+			if stopAtAsterisk {
+				if value == nil {
+					return p.filter[start:p.pos], nil
+				}
+				return string(value), nil
 			}
-			ret += child_str
-		}
-	case FilterNot:
-		ret += "!"
-		child_str, err = DecompileFilter(packet.Children[0])
-		if err != nil {
-			return
-		}
-		ret += child_str
-
-	case FilterSubstrings:
-		ret += ber.DecodeString(packet.Children[0].Data.Bytes())
-		ret += "="
-		switch packet.Children[1].Children[0].Tag {
-		case FilterSubstringsInitial:
-			ret += ber.DecodeString(packet.Children[1].Children[0].Data.Bytes()) + "*"
-		case FilterSubstringsAny:
-			ret += "*" + ber.DecodeString(packet.Children[1].Children[0].Data.Bytes()) + "*"
-		case FilterSubstringsFinal:
-			ret += "*" + ber.DecodeString(packet.Children[1].Children[0].Data.Bytes())
+			return "", p.error("unescaped '*' in value")
+		case '(':
+			return "", p.error("unescaped '(' in value")
+		case 0:
+			return "", p.error("NUL in value")
+		case '%':
+			if !p.template {
+				if value != nil {
+					value = append(value, c)
+				}
+				p.pos++
+				break
+			}
+			// the value is not used for a template, only checked
+			switch p.peek(1) {
+			case 's', 'b':
+				p.placeholders = append(p.placeholders, filterPlaceholder{pos: p.pos, item: p.itemStart, verb: p.peek(1)})
+			case '%':
+			default:
+				return "", p.error("invalid placeholder in value")
+			}
+			p.pos += 2
+		case '\\':
+			if value == nil {
+				value = append(make([]byte, 0, 2*(p.pos-start)+16), p.filter[start:p.pos]...)
+			}
+			if isHexDigit(p.peek(1)) && isHexDigit(p.peek(2)) {
+				value = append(value, unhex(p.peek(1))<<4|unhex(p.peek(2)))
+				p.pos += 3
+			} else if c := p.peek(1); c == '(' || c == ')' || c == '*' || c == '\\' {
+				value = append(value, c)
+				p.pos += 2
+			} else {
+				return "", p.error("invalid escape in value")
+			}
+		default:
+			if value != nil {
+				value = append(value, c)
+			}
+			p.pos++
 		}
-	case FilterEqualityMatch:
-		ret += ber.DecodeString(packet.Children[0].Data.Bytes())
-		ret += "="
-		ret += ber.DecodeString(packet.Children[1].Data.Bytes())
-	case FilterGreaterOrEqual:
-		ret += ber.DecodeString(packet.Children[0].Data.Bytes())
-		ret += ">="
-		ret += ber.DecodeString(packet.Children[1].Data.Bytes())
-	case FilterLessOrEqual:
-		ret += ber.DecodeString(packet.Children[0].Data.Bytes())
-		ret += "<="
-		ret += ber.DecodeString(packet.Children[1].Data.Bytes())
-	case FilterPresent:
-		ret += ber.DecodeString(packet.Data.Bytes())
-		ret += "=*"
-	case FilterApproxMatch:
-		ret += ber.DecodeString(packet.Children[0].Data.Bytes())
-		ret += "~="
-		ret += ber.DecodeString(packet.Children[1].Data.Bytes())
-	case FilterExtensibleMatch:
-		// TODO
 	}
+	return "", p.error("expected ')'")
+}
 
-	ret += ")"
-	return
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isKeyChar(c byte) bool {
+	return isAlpha(c) || isDigit(c) || c == '-' || c == '_'
+}
+
+// DecompileFilter returns the RFC 4515 string form of a filter packet, all
+// filter choices are supported and values are escaped so that
+// CompileFilter(DecompileFilter(p)) encodes the same as p.
+func DecompileFilter(packet *ber.Packet) (string, error) {
+	filter, err := DecodeFilter(packet)
+	if err != nil {
+		return "", err
+	}
+	return filter.String(), nil
 }
 
 func UnescapeFilterValue(filter string) string {
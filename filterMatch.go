@@ -0,0 +1,271 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains client side evaluation of filters against entries
+package ldap
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// RFC 4511 4.5.1.7 filters evaluate to TRUE, FALSE or Undefined, an entry
+// matches only for TRUE. e.g. an ordering assertion on a value that is not
+// a valid integer for integerMatch is Undefined, so is its negation.
+const (
+	filterFalse = iota
+	filterTrue
+	filterUndefined
+)
+
+func (f *AndFilter) Matches(entry *Entry) bool             { return filterMatches(f, entry) }
+func (f *OrFilter) Matches(entry *Entry) bool              { return filterMatches(f, entry) }
+func (f *NotFilter) Matches(entry *Entry) bool             { return filterMatches(f, entry) }
+func (f *EqualityFilter) Matches(entry *Entry) bool        { return filterMatches(f, entry) }
+func (f *SubstringsFilter) Matches(entry *Entry) bool      { return filterMatches(f, entry) }
+func (f *GreaterOrEqualFilter) Matches(entry *Entry) bool  { return filterMatches(f, entry) }
+func (f *LessOrEqualFilter) Matches(entry *Entry) bool     { return filterMatches(f, entry) }
+func (f *PresentFilter) Matches(entry *Entry) bool         { return filterMatches(f, entry) }
+func (f *ApproxFilter) Matches(entry *Entry) bool          { return filterMatches(f, entry) }
+func (f *ExtensibleMatchFilter) Matches(entry *Entry) bool { return filterMatches(f, entry) }
+
+// filterMatches is Matches for every filter type, an entry matches a filter
+// that evaluates to TRUE.
+func filterMatches(f Filter, entry *Entry) bool {
+	return evaluateFilter(f, entry) == filterTrue
+}
+
+func evaluateFilter(f Filter, entry *Entry) int {
+	switch f := f.(type) {
+	case *AndFilter:
+		result := filterTrue
+		for _, child := range f.Filters {
+			switch evaluateFilter(child, entry) {
+			case filterFalse:
+				return filterFalse
+			case filterUndefined:
+				result = filterUndefined
+			}
+		}
+		return result
+	case *OrFilter:
+		result := filterFalse
+		for _, child := range f.Filters {
+			switch evaluateFilter(child, entry) {
+			case filterTrue:
+				return filterTrue
+			case filterUndefined:
+				result = filterUndefined
+			}
+		}
+		return result
+	case *NotFilter:
+		switch evaluateFilter(f.Filter, entry) {
+		case filterTrue:
+			return filterFalse
+		case filterFalse:
+			return filterTrue
+		}
+		return filterUndefined
+	case *EqualityFilter:
+		return evaluateAssertion(entry.GetAttributeValues(f.Attribute), attributeMatchingRule(f.Attribute), f.Value,
+			func(c int) bool { return c == 0 })
+	case *GreaterOrEqualFilter:
+		return evaluateAssertion(entry.GetAttributeValues(f.Attribute), attributeMatchingRule(f.Attribute), f.Value,
+			func(c int) bool { return c >= 0 })
+	case *LessOrEqualFilter:
+		return evaluateAssertion(entry.GetAttributeValues(f.Attribute), attributeMatchingRule(f.Attribute), f.Value,
+			func(c int) bool { return c <= 0 })
+	case *ApproxFilter:
+		return evaluateAssertion(entry.GetAttributeValues(f.Attribute), approxRule{}, f.Value,
+			func(c int) bool { return c == 0 })
+	case *PresentFilter:
+		if len(entry.GetAttributeValues(f.Attribute)) > 0 {
+			return filterTrue
+		}
+		return filterFalse
+	case *SubstringsFilter:
+		return evaluateSubstrings(entry.GetAttributeValues(f.Attribute), attributeMatchingRule(f.Attribute), f)
+	case *ExtensibleMatchFilter:
+		return evaluateExtensibleMatch(f, entry)
+	}
+	return filterUndefined
+}
+
+// evaluateAssertion is TRUE if match is true for the comparison of any value
+// with the assertion value.
+func evaluateAssertion(values []string, rule MatchingRule, assertion string, match func(int) bool) int {
+	if len(values) == 0 {
+		return filterFalse
+	}
+	normAssertion, err := rule.Normalize(assertion)
+	if err != nil {
+		return filterUndefined
+	}
+	result := filterFalse
+	for _, value := range values {
+		normValue, err := rule.Normalize(value)
+		if err != nil {
+			result = filterUndefined
+			continue
+		}
+		if match(rule.Compare(normValue, normAssertion)) {
+			return filterTrue
+		}
+	}
+	return result
+}
+
+// evaluateSubstrings - for an InsignificantSpaceRule pieces are prepared as
+// RFC 4518 2.6.1 substrings: spaces at the edges of a piece, or the start of
+// initial and end of final, must match a word boundary of the value rather
+// than being removed.
+func evaluateSubstrings(values []string, rule MatchingRule, f *SubstringsFilter) int {
+	if len(values) == 0 {
+		return filterFalse
+	}
+	spaces := false
+	if r, ok := rule.(InsignificantSpaceRule); ok {
+		spaces = r.RemovesInsignificantSpace()
+	}
+	normalize := func(s string, initial, final bool) (string, error) {
+		if len(s) == 0 {
+			return s, nil
+		}
+		norm, err := rule.Normalize(s)
+		if err != nil || !spaces {
+			return norm, err
+		}
+		if len(norm) == 0 {
+			return " ", nil
+		}
+		if initial || edgeSpace(s, true) {
+			norm = " " + norm
+		}
+		if final || edgeSpace(s, false) {
+			norm += " "
+		}
+		return norm, nil
+	}
+	initial, err := normalize(f.Initial, true, false)
+	if err != nil {
+		return filterUndefined
+	}
+	final, err := normalize(f.Final, false, true)
+	if err != nil {
+		return filterUndefined
+	}
+	any := make([]string, len(f.Any))
+	for i, s := range f.Any {
+		if any[i], err = normalize(s, false, false); err != nil {
+			return filterUndefined
+		}
+	}
+	result := filterFalse
+	for _, value := range values {
+		normValue, err := rule.Normalize(value)
+		if err != nil {
+			result = filterUndefined
+			continue
+		}
+		if spaces {
+			normValue = " " + normValue + " "
+		}
+		if substringsMatch(normValue, initial, any, final) {
+			return filterTrue
+		}
+	}
+	return result
+}
+
+// edgeSpace - the first (or last) rune of s is a space.
+func edgeSpace(s string, first bool) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	if !first {
+		r, _ = utf8.DecodeLastRuneInString(s)
+	}
+	return spaceRune(r)
+}
+
+func substringsMatch(value, initial string, any []string, final string) bool {
+	if !strings.HasPrefix(value, initial) {
+		return false
+	}
+	value = value[len(initial):]
+	for _, s := range any {
+		i := strings.Index(value, s)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(s):]
+	}
+	return strings.HasSuffix(value, final)
+}
+
+// evaluateExtensibleMatch - RFC 4511 4.5.1.7.7, Undefined for an unknown
+// matching rule.
+func evaluateExtensibleMatch(f *ExtensibleMatchFilter, entry *Entry) int {
+	var rule MatchingRule
+	if len(f.MatchingRule) > 0 {
+		if rule = GetMatchingRule(f.MatchingRule); rule == nil {
+			return filterUndefined
+		}
+	} else if len(f.Attribute) > 0 {
+		rule = attributeMatchingRule(f.Attribute)
+	} else {
+		return filterUndefined
+	}
+	equal := func(c int) bool { return c == 0 }
+
+	var values []string
+	if len(f.Attribute) > 0 {
+		values = entry.GetAttributeValues(f.Attribute)
+	} else {
+		// all attributes the rule applies to, values invalid for the rule
+		// are ignored rather than Undefined
+		for _, attr := range entry.Attributes {
+			for _, value := range attr.Values {
+				if _, err := rule.Normalize(value); err == nil {
+					values = append(values, value)
+				}
+			}
+		}
+	}
+	if dn, err := ParseDN(entry.DN); err == nil && f.DNAttributes {
+		for _, rdn := range dn.RDNs {
+			for _, atv := range rdn.Attributes {
+				if len(f.Attribute) == 0 || attributeTypesEqual(atv.Type, f.Attribute) {
+					values = append(values, atv.Value)
+				}
+			}
+		}
+	}
+	return evaluateAssertion(values, rule, f.Value, equal)
+}
+
+// approxRule - approximate matching is implementation defined, here
+// caseIgnoreMatch ignoring all spaces.
+type approxRule struct{}
+
+func (approxRule) Normalize(value string) (string, error) {
+	return strings.Join(strings.Fields(strings.ToLower(value)), ""), nil
+}
+
+func (approxRule) Compare(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
@@ -0,0 +1,134 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"testing"
+)
+
+func TestFilterMatches(t *testing.T) {
+	e := NewEntry(`cn=Bob  Smith+uid=bob,ou=Sales\2c EMEA,dc=corp,dc=com`)
+	e.AddAttributeValues("objectClass", []string{"top", "person"})
+	e.AddAttributeValue("cn", "Bob  Smith")
+	e.AddAttributeValue("mail", "Bob.Smith@Corp.com")
+	e.AddAttributeValue("title", "Manager")
+	e.AddAttributeValue("uidNumber", "1000")
+	e.AddAttributeValue("createTimestamp", "20130704153000Z")
+	e.AddAttributeValue("description;lang-en", "Sales")
+	e.AddAttributeValue("employeeNumber", "not a number")
+	e.AddAttributeValue("telephoneNumber", "+1 555-0100")
+
+	tests := []struct {
+		filter  string
+		matches bool
+	}{
+		{"(&(objectClass=person)(|(mail=*@corp.com)(title>=M)))", true},
+		{"(objectclass=PERSON)", true},
+		{"(cn=bob smith)", true},
+		{"(cn=b*sm*h)", true},
+		{"(cn=*x*)", false},
+		{"(cn=*b  s*)", true},
+		{"(cn=*bob *)", true},
+		{"(cn=*bo *)", false},
+		{"(cn=* smith)", true},
+		{"(cn= b*)", true},
+		{"(cn=*b*h )", true},
+		{"(cn=*bs*)", false},
+		{"(cn=*h *)", true},
+		{"(cn=*\\20*)", true},
+		{"(telephoneNumber=*5 550*)", true},
+		{"(mail=*)", true},
+		{"(sn=*)", false},
+		{"(title<=L)", false},
+		{"(uidNumber>=999)", true},
+		{"(uidNumber<=999)", false},
+		{"(uidNumber=01000)", true},
+		{"(createTimestamp>=20130704143000Z)", true},
+		{"(createTimestamp<=20130704163000+0200)", false},
+		{"(cn~=bobsmith)", true},
+		{"(description=sales)", true},
+		{"(description;lang-en=sales)", true},
+		{"(description;lang-fr=sales)", false},
+		{"(cn:caseExactMatch:=Bob Smith)", true},
+		{"(cn:caseExactMatch:=bob smith)", false},
+		{"(:caseIgnoreMatch:=MANAGER)", true},
+		{"(ou:dn:=sales, emea)", true},
+		{"(ou=sales, emea)", false},
+		{"(:dn:2.5.13.2:=bob)", true},
+		{"(cn:unknownMatch:=x)", false},
+		{"(!(cn:unknownMatch:=x))", false},
+		{"(!(sn=x))", true},
+		{"(|(cn:unknownMatch:=x)(cn=bob*))", true},
+		{"(employeeNumber:integerMatch:=1)", false},
+		{"(!(employeeNumber:integerMatch:=1))", false},
+	}
+	for _, test := range tests {
+		f, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Errorf("%s: %s", test.filter, err)
+			continue
+		}
+		if f.Matches(e) != test.matches {
+			t.Errorf("%s: expected %t", test.filter, test.matches)
+		}
+	}
+}
+
+// digitsRule compares only the digits of values.
+type digitsRule struct{}
+
+func (digitsRule) Normalize(value string) (string, error) {
+	digits := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] >= '0' && value[i] <= '9' {
+			digits = append(digits, value[i])
+		}
+	}
+	return string(digits), nil
+}
+
+func (digitsRule) Compare(a, b string) int {
+	return stringRule{prepOctetString}.Compare(a, b)
+}
+
+func TestRegisterMatchingRule(t *testing.T) {
+	const oid = "1.3.6.1.4.1.99999.4"
+	RegisterMatchingRule(oid, []string{"digitsMatch"}, digitsRule{})
+	rules := StandardAttributeMatchingRules()
+	rules["pager"] = oid
+	SetAttributeMatchingRules(rules)
+	defer func() {
+		delete(matchingRules, oid)
+		delete(matchingRuleOIDs, "digitsmatch")
+		SetAttributeMatchingRules(StandardAttributeMatchingRules())
+	}()
+	if GetMatchingRule("DIGITSMATCH") == nil || GetMatchingRule(oid) == nil {
+		t.Fatalf("registered rule not found")
+	}
+
+	e := NewEntry("cn=x")
+	e.AddAttributeValue("pager", "+1 555-1234")
+	if !NewEqualityFilter("pager", "15551234").Matches(e) {
+		t.Errorf("attribute matching rule not used for equality")
+	}
+	if !NewSubstringsFilter("pager", "1 (555)", nil, "").Matches(e) {
+		t.Errorf("attribute matching rule not used for substrings")
+	}
+	if NewEqualityFilter("pager", "5551234").Matches(e) {
+		t.Errorf("unexpected match")
+	}
+}
+
+func TestSubstringsInsignificantSpace(t *testing.T) {
+	values := []string{"Bob  Smith"}
+	f := &SubstringsFilter{Attribute: "cn", Any: []string{"bo "}}
+	if evaluateSubstrings(values, GetMatchingRule("caseIgnoreMatch"), f) != filterFalse {
+		t.Errorf("caseIgnoreMatch: space at the end of a piece not kept")
+	}
+	// a rule that does not declare it only sees the normalized pieces
+	if evaluateSubstrings(values, stringRule{prepCaseIgnore}, f) != filterTrue {
+		t.Errorf("stringRule: expected the normalized piece to match")
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains filter normalization, for comparing and caching filters
+package ldap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// NormalizeFilter returns an equivalent filter in a canonical form, so that
+// e.g. (&(b=2)(A=1)), (&(a=1)(b=2)(a=1)) and (&(&(a=1))(b=2)) are the same:
+//
+//	attribute descriptions are lower cased, with options sorted and, with
+//	SetDefaultAttributeAliases, alias names replaced by one canonical name
+//	nested AND/OR are flattened and their operands sorted and deduplicated
+//	AND/OR with a single operand and double negations are removed
+//	trivially true and false filters are collapsed
+//
+// Trivially true is (objectClass=*), which every entry matches, or the
+// RFC 4526 absolute true (&). Trivially false is (!(objectClass=*)) or (|).
+// The result only uses (objectclass=*) and (!(objectclass=*)) for these, with
+// the canonical name of objectClass with SetDefaultAttributeAliases, so it
+// can be sent to servers without RFC 4526 support. Values are unchanged.
+func NormalizeFilter(f Filter) Filter {
+	switch f := f.(type) {
+	case *AndFilter:
+		return normalizeFilterSet(true, f.Filters)
+	case *OrFilter:
+		return normalizeFilterSet(false, f.Filters)
+	case *NotFilter:
+		child := NormalizeFilter(f.Filter)
+		if not, ok := child.(*NotFilter); ok {
+			return not.Filter
+		}
+		return &NotFilter{Filter: child}
+	case *EqualityFilter:
+		return &EqualityFilter{Attribute: normalizeAttributeDescription(f.Attribute), Value: f.Value}
+	case *GreaterOrEqualFilter:
+		return &GreaterOrEqualFilter{Attribute: normalizeAttributeDescription(f.Attribute), Value: f.Value}
+	case *LessOrEqualFilter:
+		return &LessOrEqualFilter{Attribute: normalizeAttributeDescription(f.Attribute), Value: f.Value}
+	case *ApproxFilter:
+		return &ApproxFilter{Attribute: normalizeAttributeDescription(f.Attribute), Value: f.Value}
+	case *PresentFilter:
+		return &PresentFilter{Attribute: normalizeAttributeDescription(f.Attribute)}
+	case *SubstringsFilter:
+		n := &SubstringsFilter{Attribute: normalizeAttributeDescription(f.Attribute), Initial: f.Initial, Final: f.Final}
+		for _, any := range f.Any {
+			if len(any) > 0 {
+				n.Any = append(n.Any, any)
+			}
+		}
+		return n
+	case *ExtensibleMatchFilter:
+		n := *f
+		n.MatchingRule = strings.ToLower(f.MatchingRule)
+		if len(f.Attribute) > 0 {
+			n.Attribute = normalizeAttributeDescription(f.Attribute)
+		}
+		return &n
+	}
+	return f
+}
+
+// NormalizeFilterString parses filter and returns its canonical string form,
+// see NormalizeFilter.
+func NormalizeFilterString(filter string) (string, error) {
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return "", err
+	}
+	return NormalizeFilter(f).String(), nil
+}
+
+// FilterHash returns the SHA-256 of the canonical string form of f, as hex.
+// Equivalent filters (by NormalizeFilter) have the same hash, for use as a
+// cache key.
+func FilterHash(f Filter) string {
+	sum := sha256.Sum256([]byte(NormalizeFilter(f).String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func trueFilter() Filter {
+	return &PresentFilter{Attribute: normalizeAttributeDescription("objectClass")}
+}
+
+func falseFilter() Filter {
+	return &NotFilter{Filter: trueFilter()}
+}
+
+func isTrueFilter(f Filter) bool {
+	switch f := f.(type) {
+	case *AndFilter:
+		return len(f.Filters) == 0
+	case *PresentFilter:
+		return AttributeDescriptionsEqual(f.Attribute, "objectClass")
+	}
+	return false
+}
+
+func isFalseFilter(f Filter) bool {
+	switch f := f.(type) {
+	case *OrFilter:
+		return len(f.Filters) == 0
+	case *NotFilter:
+		return isTrueFilter(f.Filter)
+	}
+	return false
+}
+
+type keyedFilter struct {
+	key    string
+	filter Filter
+}
+
+type keyedFilters []keyedFilter
+
+func (k keyedFilters) Len() int           { return len(k) }
+func (k keyedFilters) Less(i, j int) bool { return k[i].key < k[j].key }
+func (k keyedFilters) Swap(i, j int)      { k[i], k[j] = k[j], k[i] }
+
+func normalizeFilterSet(isAnd bool, filters []Filter) Filter {
+	children := make(keyedFilters, 0, len(filters))
+	seen := make(map[string]bool)
+	// for AND a false operand makes the set false, for OR a true one true
+	absorbed := false
+	var add func(f Filter)
+	add = func(f Filter) {
+		switch {
+		case isAnd && isTrueFilter(f), !isAnd && isFalseFilter(f):
+			return
+		case isAnd && isFalseFilter(f), !isAnd && isTrueFilter(f):
+			absorbed = true
+			return
+		}
+		if and, ok := f.(*AndFilter); ok && isAnd {
+			for _, child := range and.Filters {
+				add(child)
+			}
+			return
+		}
+		if or, ok := f.(*OrFilter); ok && !isAnd {
+			for _, child := range or.Filters {
+				add(child)
+			}
+			return
+		}
+		key := f.String()
+		if !seen[key] {
+			seen[key] = true
+			children = append(children, keyedFilter{key, f})
+		}
+	}
+	for _, f := range filters {
+		add(NormalizeFilter(f))
+	}
+	switch {
+	case absorbed && isAnd, len(children) == 0 && !isAnd:
+		return falseFilter()
+	case absorbed && !isAnd, len(children) == 0 && isAnd:
+		return trueFilter()
+	case len(children) == 1:
+		return children[0].filter
+	}
+	sort.Sort(children)
+	normalized := make([]Filter, len(children))
+	for i, child := range children {
+		normalized[i] = child.filter
+	}
+	if isAnd {
+		return &AndFilter{Filters: normalized}
+	}
+	return &OrFilter{Filters: normalized}
+}
+
+// normalizeAttributeDescription - lower case, options sorted.
+func normalizeAttributeDescription(attr string) string {
+	ad := splitAttributeDescription(strings.ToLower(attr))
+	if aliases := DefaultAttributeAliases(); aliases != nil {
+		ad.Type = aliases.Canonical(ad.Type)
+	}
+	sort.Strings(ad.Options)
+	return ad.String()
+}
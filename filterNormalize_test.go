@@ -0,0 +1,91 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"testing"
+)
+
+func TestNormalizeFilter(t *testing.T) {
+	tests := []struct {
+		filter, normalized string
+	}{
+		{"(&(b=2)(a=1))", "(&(a=1)(b=2))"},
+		{"(&(a=1))", "(a=1)"},
+		{"(&(a=1)(&(b=2)(a=1)))", "(&(a=1)(b=2))"},
+		{"(|(B=2)(|(a=1)(c=3)))", "(|(a=1)(b=2)(c=3))"},
+		{"(&(|(b=2)(a=1))(c=3))", "(&(c=3)(|(a=1)(b=2)))"},
+		{"(!(!(cn=x)))", "(cn=x)"},
+		{"(&(objectClass=*)(cn=x))", "(cn=x)"},
+		{"(|(objectClass=*)(cn=x))", "(objectclass=*)"},
+		{"(&(!(objectClass=*))(cn=x))", "(!(objectclass=*))"},
+		{"(|(!(objectClass=*))(cn=x))", "(cn=x)"},
+		{"(&)", "(objectclass=*)"},
+		{"(|)", "(!(objectclass=*))"},
+		{"(&(cn=x)(|))", "(!(objectclass=*))"},
+		{"(!(&))", "(!(objectclass=*))"},
+		{"(CN;Lang-EN;binary=Bob)", "(cn;binary;lang-en=Bob)"},
+		{"(cn:DN:caseExactMatch:=Bob)", "(cn:dn:caseexactmatch:=Bob)"},
+	}
+	for _, test := range tests {
+		got, err := NormalizeFilterString(test.filter)
+		if err != nil {
+			t.Errorf("%s: %s", test.filter, err)
+			continue
+		}
+		if got != test.normalized {
+			t.Errorf("%s: expected %s got %s", test.filter, test.normalized, got)
+		}
+	}
+}
+
+func TestNormalizeFilterAliases(t *testing.T) {
+	SetDefaultAttributeAliases(StandardAttributeAliases())
+	defer SetDefaultAttributeAliases(nil)
+	tests := []struct {
+		filter, normalized string
+	}{
+		{"(&(objectClass=*)(cn=x))", "(2.5.4.3=x)"},
+		{"(&(2.5.4.0=*)(commonName=x))", "(2.5.4.3=x)"},
+		{"(|(objectClass=*)(cn=x))", "(2.5.4.0=*)"},
+		{"(&(!(objectClass=*))(cn=x))", "(!(2.5.4.0=*))"},
+		{"(&)", "(2.5.4.0=*)"},
+		{"(objectClass=*)", "(2.5.4.0=*)"},
+		{"(|)", "(!(2.5.4.0=*))"},
+	}
+	for _, test := range tests {
+		got, err := NormalizeFilterString(test.filter)
+		if err != nil {
+			t.Errorf("%s: %s", test.filter, err)
+			continue
+		}
+		if got != test.normalized {
+			t.Errorf("%s: expected %s got %s", test.filter, test.normalized, got)
+		}
+	}
+	a, _ := ParseFilter("(&)")
+	b, _ := ParseFilter("(objectClass=*)")
+	if FilterHash(a) != FilterHash(b) {
+		t.Errorf("(&) and (objectClass=*) have different hashes")
+	}
+}
+
+func TestFilterHash(t *testing.T) {
+	a, _ := ParseFilter("(&(a=1)(b=2))")
+	b, _ := ParseFilter("(&(B=2)(&(a=1)))")
+	c, _ := ParseFilter("(&(a=1)(b=3))")
+	if FilterHash(a) != FilterHash(b) {
+		t.Errorf("equivalent filters have different hashes")
+	}
+	if FilterHash(a) == FilterHash(c) {
+		t.Errorf("different filters have the same hash")
+	}
+
+	SetDefaultAttributeAliases(StandardAttributeAliases())
+	defer SetDefaultAttributeAliases(nil)
+	if FilterHash(NewEqualityFilter("cn", "x")) != FilterHash(NewEqualityFilter("commonName", "x")) {
+		t.Errorf("aliases not normalized")
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+// The regex based filter compiler replaced by filterParser, kept only as the
+// baseline for the CompileFilter benchmarks.
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/mavricknz/asn1-ber"
+	"regexp"
+	"testing"
+)
+
+var opRegex *regexp.Regexp
+var endRegex *regexp.Regexp
+var itemRegex *regexp.Regexp
+var unescapedWildCardRegex *regexp.Regexp
+var wildCardSearchRegex *regexp.Regexp
+var extensibleRegex *regexp.Regexp
+
+func init() {
+	opRegex = regexp.MustCompile(`^\(\s*([&!|])\s*`)
+	endRegex = regexp.MustCompile(`^\)\s*`)
+	itemRegex = regexp.MustCompile(
+		`^\(\s*([-;.:\d\w]*[-;\d\w])\s*([:~<>]?=)((?:\\.|[^\\()]+)*)\)\s*`)
+	unescapedWildCardRegex = regexp.MustCompile(`^(\\.|[^\\*]+)*\*`)
+	wildCardSearchRegex = regexp.MustCompile(`^((\\.|[^\\*]+)*)\*`)
+	extensibleRegex = regexp.MustCompile(`^([-;.\w]*)(:(?i:dn))?(:([-.\w]+))?$`)
+}
+
+func legacyFilterParse(filter string) (*ber.Packet, error) {
+	var err error
+	var pTmp1 *ber.Packet
+	pos := 0
+	bracketCount := 0
+
+	p := make([]*ber.Packet, 0, 5)
+
+	// Simple non recursive method to create ber packets.
+	// If its an Op "&|!" then push onto the stack
+	// If its a filter expression (item) then add as a child
+	// if its an ending ) pop the stack adding as child to above.
+	// plus special cases of course.
+
+	for {
+		if matches := opRegex.FindStringSubmatch(filter[pos:]); len(matches) != 0 {
+			pos += len(matches[0])
+			pTmp1, err = legacyFilterEncode(FilterComponent[matches[1]], nil)
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, pTmp1)
+			bracketCount++
+			continue
+		} else if matches := endRegex.FindStringSubmatch(filter[pos:]); len(matches) != 0 {
+			if bracketCount <= 0 {
+				return nil, NewLDAPError(ErrorFilterCompile,
+					"Finished compiling filter with extra at end :"+
+						fmt.Sprint(filter[pos:]))
+			}
+			bracketCount--
+			pos += len(matches[0])
+			pTmp1 = p[len(p)-1] // copy last *ber (sequence of values)
+			if len(p) > 1 {     // not root of "tree"
+				p[len(p)-2].AppendChild(pTmp1) // add as child to previous op
+				p = p[:len(p)-1]               // pop stack
+			}
+			continue
+		} else if matches := itemRegex.FindStringSubmatch(filter[pos:]); len(matches) != 0 {
+			pos += len(matches[0])
+			pTmp1, err = legacyFilterEncode(FilterItem, matches[1:4])
+			if err != nil {
+				return nil, err
+			}
+			if len(p) == 0 { // case (attr=yyyy)
+				p = append(p, pTmp1)
+			} else {
+				p[len(p)-1].AppendChild(pTmp1)
+			}
+			continue
+		}
+		break
+	}
+	//if len(p) > 0 {
+	//	ber.PrintPacket(p[0])
+	//}
+	if len(filter[pos:]) > 0 {
+		return nil, NewLDAPError(ErrorFilterCompile, filter+" : Error compiling filter, invalid filter : "+fmt.Sprint(filter[pos:]))
+	}
+	return p[0], nil
+}
+
+func legacyFilterEncode(opType uint64, value []string) (*ber.Packet, error) {
+	var p *ber.Packet = nil
+	var err error
+
+	// condense and/or/not into one case.
+	switch opType {
+	case FilterAnd, FilterOr, FilterNot:
+		if FilterDebug {
+			fmt.Println(FilterMap[opType])
+		}
+		p = ber.Encode(ber.ClassContext, ber.TypeConstructed, uint8(opType), nil, FilterMap[opType])
+	case FilterItem:
+		if FilterDebug {
+			fmt.Println("FilterItem")
+		}
+		p, err = legacyEncodeItem(value)
+	}
+	return p, err
+}
+
+func legacyEncodeItem(attrOpVal []string) (*ber.Packet, error) {
+	attr, op, val := attrOpVal[0], attrOpVal[1], attrOpVal[2]
+	if FilterDebug {
+		fmt.Println(attr, op, val)
+	}
+
+	if op == ":=" {
+		return legacyEncodeExtensibleMatch(attr, val)
+	}
+
+	if op == "=" {
+		if val == "*" { // simple present
+			p := ber.NewString(ber.ClassContext, ber.TypePrimative, FilterPresent, attr, FilterMap[FilterPresent])
+			return p, nil
+		} else if unescapedWildCardRegex.Match([]byte(val)) {
+			// TODO ADD escaping.
+			return legacyEncodeSubStringMatch(attr, val)
+		}
+	}
+
+	p, _ := AttributeValueAssertion(attr, op, val)
+	return p, nil
+}
+
+/*
+substrings         [4] SubstringFilter,
+
+SubstringFilter ::= SEQUENCE {
+            type    AttributeDescription,
+            -- initial and final can occur at most once
+            substrings    SEQUENCE SIZE (1..MAX) OF substring CHOICE {
+             initial        [0] AssertionValue,
+             any            [1] AssertionValue,
+             final          [2] AssertionValue } }
+*/
+
+func legacyEncodeSubStringMatch(attr, value string) (*ber.Packet, error) {
+	p := ber.Encode(ber.ClassContext, ber.TypeConstructed,
+		FilterSubstrings, nil, FilterMap[FilterSubstrings])
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, attr, "type"))
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "substrings")
+
+	pos := 0
+
+	for {
+		matches := wildCardSearchRegex.FindStringSubmatch(value[pos:])
+		if FilterDebug {
+			fmt.Println(matches)
+		}
+
+		// not match found return error
+
+		if matches == nil && pos == 0 {
+			if FilterDebug {
+				fmt.Println("Did not match filter")
+			}
+			return nil, NewLDAPError(ErrorFilterCompile, "Did not match filter.")
+		}
+		// attr=*XXX
+		if len(matches) == 0 {
+			break
+		}
+		// initial
+		if pos == 0 && len(matches[1]) > 0 {
+			if FilterDebug {
+				fmt.Println("initial : " + matches[1])
+			}
+			seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, FilterSubstringsInitial, UnescapeFilterValue(matches[1]), "initial"))
+		}
+		// past initial but not end
+		if pos > 0 && len(matches) > 1 && len(matches[1]) > 0 {
+			if FilterDebug {
+				fmt.Println("any : " + matches[1])
+			}
+			seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, FilterSubstringsAny, UnescapeFilterValue(matches[1]), "any"))
+		}
+
+		pos += len(matches[0])
+		if pos == len(value) {
+			break
+		}
+	}
+	if len(value[pos:]) > 0 {
+		if FilterDebug {
+			fmt.Println("final : " + value[pos:])
+		}
+		seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, FilterSubstringsFinal, UnescapeFilterValue(value[pos:]), "final"))
+	}
+	p.AppendChild(seq)
+	if FilterDebug {
+		fmt.Println(hex.Dump(p.Bytes()))
+	}
+	return p, nil
+}
+
+/*
+extensibleMatch    [9] MatchingRuleAssertion
+
+MatchingRuleAssertion ::= SEQUENCE {
+            matchingRule    [1] MatchingRuleId OPTIONAL,
+            type            [2] AttributeDescription OPTIONAL,
+            matchValue      [3] AssertionValue,
+            dnAttributes    [4] BOOLEAN DEFAULT FALSE }
+*/
+
+func legacyEncodeExtensibleMatch(attr, value string) (*ber.Packet, error) {
+	p := ber.Encode(ber.ClassContext, ber.TypeConstructed,
+		FilterExtensibleMatch, nil, FilterMap[FilterExtensibleMatch])
+	if matches := extensibleRegex.FindStringSubmatch(attr); len(matches) != 0 {
+		if FilterDebug {
+			fmt.Println(matches)
+		}
+		rtype := matches[1]
+		dn := matches[2]
+		rule := matches[4]
+
+		if len(rule) > 0 {
+			prule := ber.NewString(ber.ClassContext, ber.TypePrimative, TagMatchingRule, rule, "matchingRule")
+			p.AppendChild(prule)
+		}
+		if len(rtype) > 0 {
+			ptype := ber.NewString(ber.ClassContext, ber.TypePrimative, TagMatchingType, rtype, "type")
+			p.AppendChild(ptype)
+		}
+		pval := ber.NewString(ber.ClassContext, ber.TypePrimative, TagMatchValue, UnescapeFilterValue(value), "matchValue")
+		p.AppendChild(pval)
+		if len(dn) > 0 {
+			pdn := ber.NewBoolean(ber.ClassContext, ber.TypePrimative, TagMatchDnAttributes, true, "dnAttributes")
+			p.AppendChild(pdn)
+		}
+	} else {
+		return nil, NewLDAPError(ErrorFilterCompile,
+			"Invalid Extensible attr : "+attr)
+	}
+	if FilterDebug {
+		fmt.Println(hex.Dump(p.Bytes()))
+	}
+	return p, nil
+}
+
+func BenchmarkFilterCompileRegex(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		legacyFilterParse(test_filters[i%len(test_filters)].filter_str)
+	}
+}
+
+func BenchmarkFilterCompileLongOrRegex(b *testing.B) {
+	filter := longOrFilter(500)
+	b.SetBytes(int64(len(filter)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := legacyFilterParse(filter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
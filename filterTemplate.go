@@ -0,0 +1,221 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains filter templates, building filters from values without
+// having to escape them
+package ldap
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FilterTemplate is a filter string with placeholders in assertion values,
+// e.g. "(&(uid=%s)(memberOf=%s))". Values bound to placeholders are always
+// escaped:
+//
+//	%s  the value as a string, characters special in filters, NUL and
+//	    invalid UTF-8 are escaped as \xx
+//	%b  the value as binary, every byte is escaped as \xx e.g. objectGUID
+//	%%  a literal %
+//
+// A slice value (other than []byte) expands the filter item holding the
+// placeholder into an OR of the item for each element, e.g. "(uid=%s)" with
+// []string{"a", "b"} gives "(|(uid=a)(uid=b))". An empty slice gives a filter
+// that matches nothing, (!(objectClass=*)).
+//
+// An empty value for a placeholder in a substrings assertion is an error,
+// e.g. "(cn=*%s*)" would give (cn=**), which is not a valid filter, and
+// "(cn=%s*)" would give the present filter (cn=*).
+//
+// The template is checked when compiled: it must be a valid filter and
+// placeholders may only be used in assertion values.
+type FilterTemplate struct {
+	template     string
+	placeholders []filterPlaceholder
+}
+
+type filterPlaceholder struct {
+	pos  int  // of the %
+	verb byte // s or b
+	// in a substrings assertion, the value must not be empty
+	substrings bool
+	// the item holding the placeholder is template[item:itemEnd]
+	item    int
+	itemEnd int
+}
+
+// matches nothing, for an empty list without relying on RFC 4526 (|)
+const filterTemplateFalse = "(!(objectClass=*))"
+
+// CompileFilterTemplate checks template and returns a FilterTemplate for it.
+func CompileFilterTemplate(template string) (*FilterTemplate, error) {
+	if len(template) == 0 {
+		return nil, NewLDAPError(ErrorFilterCompile, "Filter of zero length")
+	}
+	if template[0] != '(' {
+		return nil, NewLDAPError(ErrorFilterCompile, "Filter does not start with '('")
+	}
+	p := &filterParser{filter: template, template: true}
+	if _, err := p.parseFilter(0); err != nil {
+		return nil, err
+	}
+	if p.pos < len(template) {
+		return nil, p.error("extra characters after filter")
+	}
+	return &FilterTemplate{template: template, placeholders: p.placeholders}, nil
+}
+
+// MustCompileFilterTemplate is like CompileFilterTemplate but panics if the
+// template is invalid, for templates in package variables.
+func MustCompileFilterTemplate(template string) *FilterTemplate {
+	t, err := CompileFilterTemplate(template)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// FormatFilter compiles template and executes it with args.
+func FormatFilter(template string, args ...interface{}) (string, error) {
+	t, err := CompileFilterTemplate(template)
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(args...)
+}
+
+func (t *FilterTemplate) String() string {
+	return t.template
+}
+
+// Execute returns the filter string with the placeholders replaced by args,
+// in order.
+func (t *FilterTemplate) Execute(args ...interface{}) (string, error) {
+	if len(args) != len(t.placeholders) {
+		return "", NewLDAPError(ErrorFilterCompile,
+			fmt.Sprintf("Filter template %q has %d placeholders, got %d values", t.template, len(t.placeholders), len(args)))
+	}
+	buf := new(bytes.Buffer)
+	last := 0
+	for i := 0; i < len(t.placeholders); {
+		// placeholders of the same item
+		item := t.placeholders[i].item
+		j := i + 1
+		for j < len(t.placeholders) && t.placeholders[j].item == item {
+			j++
+		}
+		list := -1
+		for k := i; k < j; k++ {
+			if isFilterValueList(args[k]) {
+				if list != -1 {
+					return "", NewLDAPError(ErrorFilterCompile,
+						fmt.Sprintf("Filter template %q: only one list value per filter item", t.template))
+				}
+				list = k
+			}
+		}
+		if list == -1 {
+			if err := t.expand(buf, last, t.placeholders[i:j], args[i:j]); err != nil {
+				return "", err
+			}
+			last = t.placeholders[j-1].pos + 2
+			i = j
+			continue
+		}
+		buf.WriteString(unescapeFilterPercent(t.template[last:item]))
+		values := reflect.ValueOf(args[list])
+		if values.Len() == 0 {
+			buf.WriteString(filterTemplateFalse)
+		}
+		if values.Len() > 1 {
+			buf.WriteString("(|")
+		}
+		itemArgs := make([]interface{}, j-i)
+		copy(itemArgs, args[i:j])
+		for n := 0; n < values.Len(); n++ {
+			itemArgs[list-i] = values.Index(n).Interface()
+			if err := t.expand(buf, item, t.placeholders[i:j], itemArgs); err != nil {
+				return "", err
+			}
+			buf.WriteString(unescapeFilterPercent(t.template[t.placeholders[j-1].pos+2 : t.placeholders[i].itemEnd]))
+		}
+		if values.Len() > 1 {
+			buf.WriteString(")")
+		}
+		last = t.placeholders[i].itemEnd
+		i = j
+	}
+	buf.WriteString(unescapeFilterPercent(t.template[last:]))
+	return buf.String(), nil
+}
+
+// ExecuteFilter is like Execute but returns the parsed Filter.
+func (t *FilterTemplate) ExecuteFilter(args ...interface{}) (Filter, error) {
+	filter, err := t.Execute(args...)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFilter(filter)
+}
+
+// expand writes the template from start up to the end of the last
+// placeholder, with the placeholders replaced by args.
+func (t *FilterTemplate) expand(buf *bytes.Buffer, start int, placeholders []filterPlaceholder, args []interface{}) error {
+	for k, ph := range placeholders {
+		buf.WriteString(unescapeFilterPercent(t.template[start:ph.pos]))
+		value, err := formatFilterValue(ph.verb, args[k])
+		if err == nil && ph.substrings && len(value) == 0 {
+			err = fmt.Errorf("empty value for %%%c in a substrings assertion", ph.verb)
+		}
+		if err != nil {
+			return NewLDAPError(ErrorFilterCompile, fmt.Sprintf("Filter template %q: %s", t.template, err.Error()))
+		}
+		buf.WriteString(value)
+		start = ph.pos + 2
+	}
+	return nil
+}
+
+// formatFilterValue returns value escaped for use in a filter.
+func formatFilterValue(verb byte, value interface{}) (string, error) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return "", fmt.Errorf("nil value for %%%c", verb)
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		if verb == 'b' {
+			return "", fmt.Errorf("%T value for %%b, want []byte or string", value)
+		}
+		s = fmt.Sprint(v)
+	}
+	if verb == 's' {
+		return escapeFilterAssertion(s), nil
+	}
+	buf := make([]byte, 0, 3*len(s))
+	for i := 0; i < len(s); i++ {
+		buf = append(buf, '\\', hexDigits[s[i]>>4], hexDigits[s[i]&0xf])
+	}
+	return string(buf), nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+// isFilterValueList - slices and arrays other than []byte are lists.
+func isFilterValueList(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	return (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+func unescapeFilterPercent(s string) string {
+	return strings.Replace(s, "%%", "%", -1)
+}
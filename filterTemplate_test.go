@@ -0,0 +1,101 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"testing"
+)
+
+func TestFilterTemplate(t *testing.T) {
+	guid := []byte{0x01, 0x2a, 0x00, 'A', 0xff}
+	tests := []struct {
+		template string
+		args     []interface{}
+		want     string
+	}{
+		{"(uid=%s)", []interface{}{"bob"}, "(uid=bob)"},
+		{"(&(uid=%s)(memberOf=%s))", []interface{}{"b*b", "cn=a (b),dc=x"},
+			`(&(uid=b\2ab)(memberOf=cn=a \28b\29,dc=x))`},
+		{"(cn=%s)", []interface{}{"\\\x00é\xff"}, `(cn=\5c\00é\ff)`},
+		{"(cn=*%s*)", []interface{}{"a"}, "(cn=*a*)"},
+		{"(cn=%s)", []interface{}{""}, "(cn=)"},
+		{"(cn=a%sb%sc)", []interface{}{"*", 1}, `(cn=a\2ab1c)`},
+		{"(objectGUID=%b)", []interface{}{guid}, `(objectGUID=\01\2a\00\41\ff)`},
+		{"(cn=%s)", []interface{}{guid}, `(cn=\01\2a\00A\ff)`},
+		{"(cn=100%%%s)", []interface{}{"%"}, "(cn=100%%)"},
+		{"(&(objectClass=user)(uid=%s))", []interface{}{[]string{"a", "b*"}},
+			`(&(objectClass=user)(|(uid=a)(uid=b\2a)))`},
+		{"(&(uid=%s)(cn=x))", []interface{}{[]string{"a"}}, "(&(uid=a)(cn=x))"},
+		{"(&(uid=%s)(cn=%s))", []interface{}{[]string{}, "x"}, "(&(!(objectClass=*))(cn=x))"},
+		{"(|(objectGUID=%b)(cn=%s))", []interface{}{[][]byte{{1}, {2}}, []string{"a", "b"}},
+			`(|(|(objectGUID=\01)(objectGUID=\02))(|(cn=a)(cn=b)))`},
+		{"(cn=%s*%s)", []interface{}{[]int{1, 2}, "z"}, "(|(cn=1*z)(cn=2*z))"},
+		{"(cn:dn:caseExactMatch:=%s)", []interface{}{"x)"}, `(cn:dn:caseExactMatch:=x\29)`},
+	}
+	for _, test := range tests {
+		ft, err := CompileFilterTemplate(test.template)
+		if err != nil {
+			t.Errorf("Problem compiling %q - %s", test.template, err)
+			continue
+		}
+		got, err := ft.Execute(test.args...)
+		if err != nil {
+			t.Errorf("Problem executing %q - %s", test.template, err)
+		} else if got != test.want {
+			t.Errorf("%q expected %q, got %q", test.template, test.want, got)
+		} else if _, err := CompileFilter(got); err != nil {
+			t.Errorf("%q gave an invalid filter %q - %s", test.template, got, err)
+		}
+	}
+}
+
+func TestFilterTemplateExecuteFilter(t *testing.T) {
+	ft := MustCompileFilterTemplate("(objectGUID=%b)")
+	f, err := ft.ExecuteFilter([]byte("\x00(*)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eq, ok := f.(*EqualityFilter); !ok || eq.Value != "\x00(*)" {
+		t.Errorf("expected the value unescaped, got %#v", f)
+	}
+}
+
+func TestFilterTemplateErrors(t *testing.T) {
+	for _, template := range []string{"", "uid=%s", "(%s=x)", "(uid%s=x)", "(uid=%d)", "(uid=%)", "(&(uid=%s)", "(cn=%s)x"} {
+		if _, err := CompileFilterTemplate(template); err == nil {
+			t.Errorf("%q expected a compile error", template)
+		}
+	}
+	tests := []struct {
+		template string
+		args     []interface{}
+	}{
+		{"(uid=%s)", nil},
+		{"(uid=%s)", []interface{}{"a", "b"}},
+		{"(uid=%s)", []interface{}{nil}},
+		{"(uid=%b)", []interface{}{1}},
+		{"(cn=%s*%s)", []interface{}{[]string{"a"}, []string{"b"}}},
+		// empty substrings values
+		{"(cn=*%s*)", []interface{}{""}},
+		{"(cn=%s*)", []interface{}{""}},
+		{"(cn=*%b)", []interface{}{[]byte{}}},
+		{"(cn=*%s*)", []interface{}{[]string{"a", ""}}},
+	}
+	for _, test := range tests {
+		if _, err := MustCompileFilterTemplate(test.template).Execute(test.args...); err == nil {
+			t.Errorf("%q %v expected an error", test.template, test.args)
+		}
+	}
+}
+
+func TestFormatFilter(t *testing.T) {
+	got, err := FormatFilter("(&(uid=%s)(memberOf=%s))", "*", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `(&(uid=\2a)(|(memberOf=a)(memberOf=b)))`; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
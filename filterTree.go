@@ -0,0 +1,396 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains the Filter tree types, an alternative to filter strings
+package ldap
+
+import (
+	"fmt"
+	"github.com/mavricknz/asn1-ber"
+	"strings"
+	"unicode/utf8"
+)
+
+// Filter is a search filter built from the types below. Values are held
+// unescaped, String escapes them to give the RFC 4515 string form and
+// Encode gives the packet used by a SearchRequest. Matches evaluates the
+// filter against an Entry client side, see MatchingRule.
+//
+//	f := NewAndFilter(
+//		NewEqualityFilter("objectClass", "person"),
+//		NewSubstringsFilter("cn", userInput, nil, ""))
+//	req := NewSimpleSearchRequest(baseDN, ScopeWholeSubtree, "", nil)
+//	req.FilterTree = f
+type Filter interface {
+	String() string
+	Encode() (*ber.Packet, error)
+	Matches(entry *Entry) bool
+}
+
+type AndFilter struct {
+	Filters []Filter
+}
+
+type OrFilter struct {
+	Filters []Filter
+}
+
+type NotFilter struct {
+	Filter Filter
+}
+
+type EqualityFilter struct {
+	Attribute string
+	Value     string
+}
+
+// SubstringsFilter - Initial and Final are optional, empty if not used.
+// Empty Any values are ignored, and a filter without any substrings is the
+// Present filter for Attribute, in String and Encode.
+type SubstringsFilter struct {
+	Attribute string
+	Initial   string
+	Any       []string
+	Final     string
+}
+
+type GreaterOrEqualFilter struct {
+	Attribute string
+	Value     string
+}
+
+type LessOrEqualFilter struct {
+	Attribute string
+	Value     string
+}
+
+type PresentFilter struct {
+	Attribute string
+}
+
+type ApproxFilter struct {
+	Attribute string
+	Value     string
+}
+
+// ExtensibleMatchFilter - at least one of MatchingRule and Attribute is
+// required.
+type ExtensibleMatchFilter struct {
+	MatchingRule string
+	Attribute    string
+	Value        string
+	DNAttributes bool
+}
+
+func NewAndFilter(filters ...Filter) *AndFilter {
+	return &AndFilter{Filters: filters}
+}
+
+func NewOrFilter(filters ...Filter) *OrFilter {
+	return &OrFilter{Filters: filters}
+}
+
+func NewNotFilter(filter Filter) *NotFilter {
+	return &NotFilter{Filter: filter}
+}
+
+func NewEqualityFilter(attribute, value string) *EqualityFilter {
+	return &EqualityFilter{Attribute: attribute, Value: value}
+}
+
+func NewSubstringsFilter(attribute, initial string, any []string, final string) *SubstringsFilter {
+	return &SubstringsFilter{Attribute: attribute, Initial: initial, Any: any, Final: final}
+}
+
+func NewGreaterOrEqualFilter(attribute, value string) *GreaterOrEqualFilter {
+	return &GreaterOrEqualFilter{Attribute: attribute, Value: value}
+}
+
+func NewLessOrEqualFilter(attribute, value string) *LessOrEqualFilter {
+	return &LessOrEqualFilter{Attribute: attribute, Value: value}
+}
+
+func NewPresentFilter(attribute string) *PresentFilter {
+	return &PresentFilter{Attribute: attribute}
+}
+
+func NewApproxFilter(attribute, value string) *ApproxFilter {
+	return &ApproxFilter{Attribute: attribute, Value: value}
+}
+
+func NewExtensibleMatchFilter(matchingRule, attribute, value string, dnAttributes bool) *ExtensibleMatchFilter {
+	return &ExtensibleMatchFilter{MatchingRule: matchingRule, Attribute: attribute, Value: value, DNAttributes: dnAttributes}
+}
+
+func (f *AndFilter) String() string {
+	return "(&" + filterStrings(f.Filters) + ")"
+}
+
+func (f *OrFilter) String() string {
+	return "(|" + filterStrings(f.Filters) + ")"
+}
+
+func filterStrings(filters []Filter) string {
+	s := ""
+	for _, filter := range filters {
+		s += filter.String()
+	}
+	return s
+}
+
+func (f *NotFilter) String() string {
+	return "(!" + f.Filter.String() + ")"
+}
+
+func (f *EqualityFilter) String() string {
+	return "(" + f.Attribute + "=" + escapeFilterAssertion(f.Value) + ")"
+}
+
+func (f *SubstringsFilter) String() string {
+	s := "(" + f.Attribute + "=" + escapeFilterAssertion(f.Initial) + "*"
+	for _, any := range f.Any {
+		if len(any) > 0 {
+			s += escapeFilterAssertion(any) + "*"
+		}
+	}
+	return s + escapeFilterAssertion(f.Final) + ")"
+}
+
+func (f *GreaterOrEqualFilter) String() string {
+	return "(" + f.Attribute + ">=" + escapeFilterAssertion(f.Value) + ")"
+}
+
+func (f *LessOrEqualFilter) String() string {
+	return "(" + f.Attribute + "<=" + escapeFilterAssertion(f.Value) + ")"
+}
+
+func (f *PresentFilter) String() string {
+	return "(" + f.Attribute + "=*)"
+}
+
+func (f *ApproxFilter) String() string {
+	return "(" + f.Attribute + "~=" + escapeFilterAssertion(f.Value) + ")"
+}
+
+func (f *ExtensibleMatchFilter) String() string {
+	s := "(" + f.Attribute
+	if f.DNAttributes {
+		s += ":dn"
+	}
+	if len(f.MatchingRule) > 0 {
+		s += ":" + f.MatchingRule
+	}
+	return s + ":=" + escapeFilterAssertion(f.Value) + ")"
+}
+
+func (f *AndFilter) Encode() (*ber.Packet, error) {
+	return encodeFilterSet(FilterAnd, f.Filters)
+}
+
+func (f *OrFilter) Encode() (*ber.Packet, error) {
+	return encodeFilterSet(FilterOr, f.Filters)
+}
+
+func encodeFilterSet(tag uint8, filters []Filter) (*ber.Packet, error) {
+	p := ber.Encode(ber.ClassContext, ber.TypeConstructed, tag, nil, FilterMap[uint64(tag)])
+	for _, filter := range filters {
+		child, err := filter.Encode()
+		if err != nil {
+			return nil, err
+		}
+		p.AppendChild(child)
+	}
+	return p, nil
+}
+
+func (f *NotFilter) Encode() (*ber.Packet, error) {
+	if f.Filter == nil {
+		return nil, NewLDAPError(ErrorEncoding, "Not filter without a filter")
+	}
+	p := ber.Encode(ber.ClassContext, ber.TypeConstructed, FilterNot, nil, FilterMap[FilterNot])
+	child, err := f.Filter.Encode()
+	if err != nil {
+		return nil, err
+	}
+	p.AppendChild(child)
+	return p, nil
+}
+
+func (f *EqualityFilter) Encode() (*ber.Packet, error) {
+	return encodeAttributeValueAssertion(FilterEqualityMatch, f.Attribute, f.Value)
+}
+
+func (f *GreaterOrEqualFilter) Encode() (*ber.Packet, error) {
+	return encodeAttributeValueAssertion(FilterGreaterOrEqual, f.Attribute, f.Value)
+}
+
+func (f *LessOrEqualFilter) Encode() (*ber.Packet, error) {
+	return encodeAttributeValueAssertion(FilterLessOrEqual, f.Attribute, f.Value)
+}
+
+func (f *ApproxFilter) Encode() (*ber.Packet, error) {
+	return encodeAttributeValueAssertion(FilterApproxMatch, f.Attribute, f.Value)
+}
+
+// encodeAttributeValueAssertion - like AttributeValueAssertion but value is
+// not escaped.
+func encodeAttributeValueAssertion(tag uint8, attribute, value string) (*ber.Packet, error) {
+	if len(attribute) == 0 {
+		return nil, NewLDAPError(ErrorEncoding, FilterMap[uint64(tag)]+" filter without an attribute")
+	}
+	p := ber.Encode(ber.ClassContext, ber.TypeConstructed, tag, nil, FilterMap[uint64(tag)])
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, attribute, "Attribute"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, value, "Value"))
+	return p, nil
+}
+
+func (f *SubstringsFilter) Encode() (*ber.Packet, error) {
+	if len(f.Attribute) == 0 {
+		return nil, NewLDAPError(ErrorEncoding, "Substrings filter without an attribute")
+	}
+	p := ber.Encode(ber.ClassContext, ber.TypeConstructed, FilterSubstrings, nil, FilterMap[FilterSubstrings])
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, f.Attribute, "type"))
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "substrings")
+	if len(f.Initial) > 0 {
+		seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, FilterSubstringsInitial, f.Initial, "initial"))
+	}
+	for _, any := range f.Any {
+		if len(any) == 0 {
+			continue
+		}
+		seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, FilterSubstringsAny, any, "any"))
+	}
+	if len(f.Final) > 0 {
+		seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, FilterSubstringsFinal, f.Final, "final"))
+	}
+	if len(seq.Children) == 0 {
+		return NewPresentFilter(f.Attribute).Encode()
+	}
+	p.AppendChild(seq)
+	return p, nil
+}
+
+func (f *PresentFilter) Encode() (*ber.Packet, error) {
+	if len(f.Attribute) == 0 {
+		return nil, NewLDAPError(ErrorEncoding, "Present filter without an attribute")
+	}
+	return ber.NewString(ber.ClassContext, ber.TypePrimative, FilterPresent, f.Attribute, FilterMap[FilterPresent]), nil
+}
+
+func (f *ExtensibleMatchFilter) Encode() (*ber.Packet, error) {
+	if len(f.MatchingRule) == 0 && len(f.Attribute) == 0 {
+		return nil, NewLDAPError(ErrorEncoding, "Extensible match filter without a matching rule or attribute")
+	}
+	p := ber.Encode(ber.ClassContext, ber.TypeConstructed, FilterExtensibleMatch, nil, FilterMap[FilterExtensibleMatch])
+	if len(f.MatchingRule) > 0 {
+		p.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, TagMatchingRule, f.MatchingRule, "matchingRule"))
+	}
+	if len(f.Attribute) > 0 {
+		p.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, TagMatchingType, f.Attribute, "type"))
+	}
+	p.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, TagMatchValue, f.Value, "matchValue"))
+	if f.DNAttributes {
+		p.AppendChild(ber.NewBoolean(ber.ClassContext, ber.TypePrimative, TagMatchDnAttributes, true, "dnAttributes"))
+	}
+	return p, nil
+}
+
+// DecodeFilter converts a filter packet e.g. from CompileFilter, or a
+// received SearchRequest, to a Filter.
+func DecodeFilter(packet *ber.Packet) (filter Filter, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			filter, err = nil, NewLDAPError(ErrorFilterDecompile, "Error decoding filter")
+		}
+	}()
+	if packet.ClassType != ber.ClassContext {
+		return nil, NewLDAPError(ErrorFilterDecompile, "Filter is not context specific")
+	}
+	switch packet.Tag {
+	case FilterAnd, FilterOr:
+		filters := make([]Filter, len(packet.Children))
+		for i, child := range packet.Children {
+			if filters[i], err = DecodeFilter(child); err != nil {
+				return nil, err
+			}
+		}
+		if packet.Tag == FilterAnd {
+			return &AndFilter{Filters: filters}, nil
+		}
+		return &OrFilter{Filters: filters}, nil
+	case FilterNot:
+		if len(packet.Children) != 1 {
+			return nil, NewLDAPError(ErrorFilterDecompile, "Not filter must have one filter")
+		}
+		child, err := DecodeFilter(packet.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		return &NotFilter{Filter: child}, nil
+	case FilterEqualityMatch:
+		return &EqualityFilter{Attribute: packetString(packet.Children[0]), Value: packetString(packet.Children[1])}, nil
+	case FilterGreaterOrEqual:
+		return &GreaterOrEqualFilter{Attribute: packetString(packet.Children[0]), Value: packetString(packet.Children[1])}, nil
+	case FilterLessOrEqual:
+		return &LessOrEqualFilter{Attribute: packetString(packet.Children[0]), Value: packetString(packet.Children[1])}, nil
+	case FilterApproxMatch:
+		return &ApproxFilter{Attribute: packetString(packet.Children[0]), Value: packetString(packet.Children[1])}, nil
+	case FilterPresent:
+		return &PresentFilter{Attribute: packetString(packet)}, nil
+	case FilterSubstrings:
+		f := &SubstringsFilter{Attribute: packetString(packet.Children[0])}
+		for _, child := range packet.Children[1].Children {
+			switch child.Tag {
+			case FilterSubstringsInitial:
+				f.Initial = packetString(child)
+			case FilterSubstringsAny:
+				f.Any = append(f.Any, packetString(child))
+			case FilterSubstringsFinal:
+				f.Final = packetString(child)
+			}
+		}
+		return f, nil
+	case FilterExtensibleMatch:
+		f := &ExtensibleMatchFilter{}
+		for _, child := range packet.Children {
+			switch child.Tag {
+			case TagMatchingRule:
+				f.MatchingRule = packetString(child)
+			case TagMatchingType:
+				f.Attribute = packetString(child)
+			case TagMatchValue:
+				f.Value = packetString(child)
+			case TagMatchDnAttributes:
+				f.DNAttributes = strings.Trim(packetString(child), "\x00") != ""
+			}
+		}
+		return f, nil
+	}
+	return nil, NewLDAPError(ErrorFilterDecompile, "Unknown filter choice")
+}
+
+// escapeFilterAssertion escapes an assertion value per RFC 4515, the special
+// characters NUL ( ) * \ plus control characters and bytes that are not
+// UTF-8. Unlike EscapeFilterValue, other UTF-8 characters are kept as is.
+func escapeFilterAssertion(value string) string {
+	escaped := make([]byte, 0, len(value))
+	for i := 0; i < len(value); {
+		r, size := utf8.DecodeRuneInString(value[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1,
+			r < 0x20, r == 0x7f, r == '(', r == ')', r == '*', r == '\\':
+			escaped = append(escaped, fmt.Sprintf("\\%02x", value[i])...)
+			i++
+		default:
+			escaped = append(escaped, value[i:i+size]...)
+			i += size
+		}
+	}
+	return string(escaped)
+}
+
+// packetString - the raw bytes of a primitive packet, values may be binary.
+func packetString(p *ber.Packet) string {
+	return string(p.Data.Bytes())
+}
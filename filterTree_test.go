@@ -0,0 +1,98 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"bytes"
+	"github.com/mavricknz/asn1-ber"
+	"testing"
+)
+
+func TestFilterTree(t *testing.T) {
+	userInput := "a*b)(uid=*"
+	f := NewAndFilter(
+		NewEqualityFilter("objectClass", "person"),
+		NewOrFilter(
+			NewSubstringsFilter("cn", userInput, []string{"x"}, "é"),
+			NewNotFilter(NewPresentFilter("mail")),
+			NewGreaterOrEqualFilter("uidNumber", "1000"),
+			NewLessOrEqualFilter("uidNumber", "2000"),
+			NewApproxFilter("sn", "smith"),
+			NewExtensibleMatchFilter("caseExactMatch", "ou", "Sales", true),
+			NewExtensibleMatchFilter("2.5.13.5", "", "x", false),
+		),
+	)
+	expected := `(&(objectClass=person)(|(cn=a\2ab\29\28uid=\2a*x*é)(!(mail=*))(uidNumber>=1000)` +
+		`(uidNumber<=2000)(sn~=smith)(ou:dn:caseExactMatch:=Sales)(:2.5.13.5:=x)))`
+	if f.String() != expected {
+		t.Errorf("expected %s got %s", expected, f)
+	}
+
+	p, err := f.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileFilter(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Bytes(), compiled.Bytes()) {
+		t.Errorf("Encode and CompileFilter differ")
+	}
+
+	decoded, err := DecodeFilter(ber.DecodePacket(p.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != expected {
+		t.Errorf("decoded filter %s", decoded)
+	}
+	sub := decoded.(*AndFilter).Filters[1].(*OrFilter).Filters[0].(*SubstringsFilter)
+	if sub.Initial != userInput || sub.Final != "é" {
+		t.Errorf("substrings not decoded raw: %+v", sub)
+	}
+
+	binary := NewEqualityFilter("objectGUID", string(binaryValue))
+	if s := binary.String(); s != `(objectGUID=\00\ff\80\0d\0a\c3\28\7f\fe)` {
+		t.Errorf("binary value not escaped: %s", s)
+	}
+	// String and Encode agree on empty substrings
+	for _, test := range []struct {
+		filter *SubstringsFilter
+		want   string
+	}{
+		{NewSubstringsFilter("cn", "", nil, ""), "(cn=*)"},
+		{NewSubstringsFilter("cn", "", []string{"", ""}, ""), "(cn=*)"},
+		{NewSubstringsFilter("cn", "a", []string{""}, "b"), "(cn=a*b)"},
+	} {
+		if s := test.filter.String(); s != test.want {
+			t.Errorf("%+v: expected %s, got %s", test.filter, test.want, s)
+		}
+		p, err := test.filter.Encode()
+		if err != nil {
+			t.Errorf("%+v: %s", test.filter, err)
+			continue
+		}
+		if decoded, err := DecodeFilter(ber.DecodePacket(p.Bytes())); err != nil || decoded.String() != test.want {
+			t.Errorf("%+v: encoded as %v %v", test.filter, decoded, err)
+		}
+	}
+}
+
+func TestSearchRequestFilterTree(t *testing.T) {
+	req := NewSimpleSearchRequest("o=example", ScopeWholeSubtree, "(invalid", nil)
+	req.FilterTree = NewEqualityFilter("cn", "a(b)")
+	p, err := encodeSearchRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := DecodeFilter(p.Children[6])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eq, ok := f.(*EqualityFilter); !ok || eq.Value != "a(b)" {
+		t.Errorf("FilterTree not used: %s", f)
+	}
+}
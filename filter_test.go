@@ -5,6 +5,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/mavricknz/asn1-ber"
+	"math/rand"
+	"strings"
 	"testing"
 )
 
@@ -25,7 +27,12 @@ var test_filters = []compile_test{
 	compile_test{filter_str: "(sn<=Miller)", filter_type: FilterLessOrEqual},
 	compile_test{filter_str: "(sn=*)", filter_type: FilterPresent},
 	compile_test{filter_str: "(sn~=Miller)", filter_type: FilterApproxMatch},
-	// compile_test{ filter_str: "(cn:dn:=People)", filter_type: FilterExtensibleMatch },
+	compile_test{filter_str: "(cn:dn:=People)", filter_type: FilterExtensibleMatch},
+	compile_test{filter_str: "(cn=a*b*c)", filter_type: FilterSubstrings},
+	compile_test{filter_str: "(cn=*a*b*)", filter_type: FilterSubstrings},
+	compile_test{filter_str: `(cn=\28x\29\2a\5c\00)`, filter_type: FilterEqualityMatch},
+	compile_test{filter_str: "(2.5.4.3;lang-en:caseExactMatch:=Bob)", filter_type: FilterExtensibleMatch},
+	compile_test{filter_str: "(:dn:2.5.13.5:=x)", filter_type: FilterExtensibleMatch},
 }
 
 type encoded_test struct {
@@ -39,6 +46,78 @@ var encode_filters = []encoded_test{
 		"(|(cn:dn:=people)(cn=xxx*yyy*zzz)(cn=*)(phones>=1))",
 		"a139a90f8202636e830670656f706c658401ffa4150402636e300f8003787878810379797982037a7a7a8702636ea50b040670686f6e6573040131",
 	},
+	encoded_test{
+		"(|(uid=user0000)(member=cn=user0000\\2cou=people\\2cdc=example\\2cdc=com))",
+		"a144a30f040375696404087573657230303030a33104066d656d6265720427636e3d75736572303030302c6f753d70656f706c652c64633d6578616d706c652c64633d636f6d",
+	},
+	encoded_test{
+		"(&(sn=Miller)(givenName=Bob))",
+		"a020a30c0402736e04064d696c6c6572a3100409676976656e4e616d650403426f62",
+	},
+	encoded_test{
+		"(|(sn=Miller)(givenName=Bob))",
+		"a120a30c0402736e04064d696c6c6572a3100409676976656e4e616d650403426f62",
+	},
+	encoded_test{
+		"(!(sn=Miller))",
+		"a20ea30c0402736e04064d696c6c6572",
+	},
+	encoded_test{
+		"(sn=Miller)",
+		"a30c0402736e04064d696c6c6572",
+	},
+	encoded_test{
+		"(sn=Mill*)",
+		"a40c0402736e300680044d696c6c",
+	},
+	encoded_test{
+		"(sn=*Mill)",
+		"a40c0402736e300682044d696c6c",
+	},
+	encoded_test{
+		"(sn=*Mill*)",
+		"a40c0402736e300681044d696c6c",
+	},
+	encoded_test{
+		"(sn>=Miller)",
+		"a50c0402736e04064d696c6c6572",
+	},
+	encoded_test{
+		"(sn<=Miller)",
+		"a60c0402736e04064d696c6c6572",
+	},
+	encoded_test{
+		"(sn=*)",
+		"8702736e",
+	},
+	encoded_test{
+		"(sn~=Miller)",
+		"a80c0402736e04064d696c6c6572",
+	},
+	encoded_test{
+		"(cn:dn:=People)",
+		"a90f8202636e830650656f706c658401ff",
+	},
+	encoded_test{
+		"(cn=a*b*c)",
+		"a40f0402636e3009800161810162820163",
+	},
+	encoded_test{
+		"(cn=*a*b*)",
+		"a40c0402636e3006810161810162",
+	},
+	encoded_test{
+		"(cn=\\28x\\29\\2a\\5c\\00)",
+		"a30c0402636e04062878292a5c00",
+	},
+	encoded_test{
+		"(2.5.4.3;lang-en:caseExactMatch:=Bob)",
+		"a926810e6361736545786163744d61746368820f322e352e342e333b6c616e672d656e8303426f62",
+	},
+	encoded_test{
+		"(:dn:2.5.13.5:=x)",
+		"a9108108322e352e31332e358301788401ff",
+	},
 }
 
 func TestFilter(t *testing.T) {
@@ -60,6 +139,89 @@ func TestFilter(t *testing.T) {
 	}
 }
 
+// randomFilter builds a random filter tree of at most depth levels.
+func randomFilter(r *rand.Rand, depth int) Filter {
+	attrs := []string{"cn", "sn", "objectClass", "userCertificate;binary", "2.5.4.3", "x-attr;lang-en"}
+	attr := attrs[r.Intn(len(attrs))]
+	value := func() string {
+		// mostly printable, with specials, UTF-8 and binary
+		alphabet := []string{"a", "b", "Z", "0", " ", "(", ")", "*", "\\", "\x00", "=", ":", "é", "世", "\xff", "\x80"}
+		v := ""
+		for i := 1 + r.Intn(6); i > 0; i-- {
+			v += alphabet[r.Intn(len(alphabet))]
+		}
+		return v
+	}
+	choice := r.Intn(10)
+	if depth <= 0 {
+		choice = 3 + r.Intn(7)
+	}
+	switch choice {
+	case 0, 1:
+		filters := make([]Filter, 1+r.Intn(3))
+		for i := range filters {
+			filters[i] = randomFilter(r, depth-1)
+		}
+		if choice == 0 {
+			return NewAndFilter(filters...)
+		}
+		return NewOrFilter(filters...)
+	case 2:
+		return NewNotFilter(randomFilter(r, depth-1))
+	case 3:
+		return NewEqualityFilter(attr, value())
+	case 4:
+		f := NewSubstringsFilter(attr, "", nil, "")
+		if r.Intn(2) == 0 {
+			f.Initial = value()
+		}
+		for i := r.Intn(3); i > 0; i-- {
+			f.Any = append(f.Any, value())
+		}
+		if r.Intn(2) == 0 || (f.Initial == "" && len(f.Any) == 0) {
+			f.Final = value()
+		}
+		return f
+	case 5:
+		return NewGreaterOrEqualFilter(attr, value())
+	case 6:
+		return NewLessOrEqualFilter(attr, value())
+	case 7:
+		return NewPresentFilter(attr)
+	case 8:
+		return NewApproxFilter(attr, value())
+	}
+	rules := []string{"", "caseExactMatch", "2.5.13.5", "x-rule-1"}
+	f := NewExtensibleMatchFilter(rules[r.Intn(len(rules))], attr, value(), r.Intn(2) == 0)
+	if r.Intn(4) == 0 && f.MatchingRule != "" {
+		f.Attribute = ""
+	}
+	return f
+}
+
+func TestFilterRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		p, err := randomFilter(r, 3).Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// as received off the wire
+		p = ber.DecodePacket(p.Bytes())
+		s, err := DecompileFilter(p)
+		if err != nil {
+			t.Fatalf("Problem decompiling %x - %s", p.Bytes(), err)
+		}
+		compiled, err := CompileFilter(s)
+		if err != nil {
+			t.Fatalf("Problem compiling %q - %s", s, err)
+		}
+		if !bytes.Equal(compiled.Bytes(), p.Bytes()) {
+			t.Fatalf("%q did not round trip\n%s\n%s", s, hex.Dump(p.Bytes()), hex.Dump(compiled.Bytes()))
+		}
+	}
+}
+
 func TestFilterEncode(t *testing.T) {
 	for _, i := range encode_filters {
 		p, err := CompileFilter(i.filter_str)
@@ -88,6 +250,93 @@ func TestFilterEncode(t *testing.T) {
 	}
 }
 
+func TestFilterParse(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   Filter
+	}{
+		{"(cn;Lang-EN=Bob)", NewEqualityFilter("cn;Lang-EN", "Bob")},
+		{"(x_attr=1)", NewEqualityFilter("x_attr", "1")},
+		{"( & ( cn =Bob) (!( sn>=a)) ) ", NewAndFilter(NewEqualityFilter("cn", "Bob"),
+			NewNotFilter(NewGreaterOrEqualFilter("sn", "a")))},
+		{"(cn= Bob )", NewEqualityFilter("cn", " Bob ")},
+		{"(&)", NewAndFilter()},
+		{"(|)", NewOrFilter()},
+		{"(cn=)", NewEqualityFilter("cn", "")},
+		{"(cn=a**b)", NewSubstringsFilter("cn", "a", nil, "b")},
+		{`(cn=\2A\(\)\\\*)`, NewEqualityFilter("cn", `*()\*`)},
+		{"(cn=é世)", NewEqualityFilter("cn", "é世")},
+		{"(cn:DN:=x)", NewExtensibleMatchFilter("", "cn", "x", true)},
+		{"(cn:dn:caseExactMatch:=x)", NewExtensibleMatchFilter("caseExactMatch", "cn", "x", true)},
+		{"(cn:dn:dn:=x)", NewExtensibleMatchFilter("dn", "cn", "x", true)},
+		{"(dn:dn:=x)", NewExtensibleMatchFilter("", "dn", "x", true)},
+		{"(cn:dn:=x)", NewExtensibleMatchFilter("", "cn", "x", true)},
+		{"(:dn:2.5.13.5:=x)", NewExtensibleMatchFilter("2.5.13.5", "", "x", true)},
+		{"(:caseExactMatch:=x)", NewExtensibleMatchFilter("caseExactMatch", "", "x", false)},
+		{"(2.5.4.3;x-a;B:1.2.3:=x)", NewExtensibleMatchFilter("1.2.3", "2.5.4.3;x-a;B", "x", false)},
+	}
+	for _, test := range tests {
+		f, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Errorf("Problem parsing %q - %s", test.filter, err)
+		} else if f.String() != test.want.String() {
+			t.Errorf("%q expected %s, got %s", test.filter, test.want, f)
+		} else if _, err := CompileFilter(test.filter); err != nil {
+			t.Errorf("%q parses but does not compile - %s", test.filter, err)
+		}
+	}
+}
+
+func TestFilterParseErrors(t *testing.T) {
+	tests := []struct {
+		filter string
+		pos    int
+	}{
+		{"(cn=a", 5},
+		{"(cn=a)x", 6},
+		{"(cn=a(b)", 5},
+		{"(cn=\\zz)", 4},
+		{"(cn=\x00)", 4},
+		{"(cn=\xff)", 4},
+		{"(cn=é\xe9)", 6},
+		{"(&(cn=a)(sn))", 11},
+		{"(cn>=a*)", 6},
+		{"(=a)", 1},
+		{"(cn;=a)", 4},
+		{"(1.=a)", 3},
+		{"(01.2=a)", 1},
+		{"(:=a)", 2},
+		{"(cn:1.2:1.3:=a)", 8},
+		{"(cn:caseExactMatch:dn:=a)", 19},
+		{"(cn:=a", 6},
+		{"(!(cn=a)(sn=b))", 8},
+		{"(cn~a)", 3},
+		{"(cn=**)", 4},
+		{"(cn=***)", 4},
+	}
+	for _, test := range tests {
+		_, err := CompileFilter(test.filter)
+		if err == nil {
+			t.Errorf("%q expected an error", test.filter)
+			continue
+		}
+		if e, ok := err.(*LDAPError); !ok || e.ResultCode != ErrorFilterCompile {
+			t.Errorf("%q expected ErrorFilterCompile, got %v", test.filter, err)
+		} else if !strings.Contains(err.Error(), fmt.Sprintf("at position %d:", test.pos)) {
+			t.Errorf("%q expected error at position %d, got %s", test.filter, test.pos, err)
+		}
+	}
+	for _, filter := range []string{"", "cn=a", " (cn=a)"} {
+		if _, err := CompileFilter(filter); err == nil {
+			t.Errorf("%q expected an error", filter)
+		}
+	}
+	deep := strings.Repeat("(!", maxFilterDepth+1) + "(cn=a)" + strings.Repeat(")", maxFilterDepth+1)
+	if _, err := CompileFilter(deep); err == nil {
+		t.Error("expected an error for a deeply nested filter")
+	}
+}
+
 func TestFilterValueUnescape(t *testing.T) {
 	filter := `cn=abc \(123\) \28bob\29 \\\\ \*`
 	filterStandard := `cn=abc (123) (bob) \\ *`
@@ -125,6 +374,26 @@ func BenchmarkFilterCompile(b *testing.B) {
 	}
 }
 
+// longOrFilter is like the filters generated for group membership sync.
+func longOrFilter(n int) string {
+	filter := "(|"
+	for i := 0; i < n; i++ {
+		filter += fmt.Sprintf("(uid=user%04d)(member=cn=user%04d\\2cou=people\\2cdc=example\\2cdc=com)", i, i)
+	}
+	return filter + ")"
+}
+
+func BenchmarkFilterCompileLongOr(b *testing.B) {
+	filter := longOrFilter(500)
+	b.SetBytes(int64(len(filter)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := CompileFilter(filter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkFilterDecompile(b *testing.B) {
 	b.StopTimer()
 	filters := make([]*ber.Packet, len(test_filters))
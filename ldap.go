@@ -113,6 +113,7 @@ const (
 	ErrorLDIFWrite       = 210
 	ErrorClosing         = 211
 	ErrorUnknown         = 212
+	ErrorReferralLimit   = 213
 )
 
 const (
@@ -171,6 +172,7 @@ var LDAPResultCodeMap = map[uint8]string{
 	ErrorInvalidArgument: "ErrorInvalidArgument",
 	ErrorLDIFRead:        "ErrorLDIFRead",
 	ErrorClosing:         "ErrorClosing",
+	ErrorReferralLimit:   "ErrorReferralLimit",
 }
 
 // Adds descriptions to an LDAP Response packet for debugging
@@ -241,7 +243,7 @@ func addControlDescriptions(packet *ber.Packet) {
 	packet.Description = "Controls"
 	for _, child := range packet.Children {
 		child.Description = "Control"
-		child.Children[0].Description = "Control Type (" + ControlTypeMap[child.Children[0].Value.(string)] + ")"
+		child.Children[0].Description = "Control Type (" + controlTypeName(child.Children[0].Value.(string)) + ")"
 		value := child.Children[1]
 		if len(child.Children) == 3 {
 			child.Children[1].Description = "Criticality"
@@ -304,6 +306,7 @@ func DebugBinaryFile(FileName string) error {
 type LDAPError struct {
 	sText      string
 	ResultCode uint8
+	Referrals  []string // set for LDAPResultReferral
 }
 
 func (e *LDAPError) Error() string {
@@ -317,7 +320,7 @@ func NewLDAPError(resultCode uint8, sText string) error {
 func getLDAPResultCode(p *ber.Packet) (code uint8, description string) {
 	if len(p.Children) >= 2 {
 		response := p.Children[1]
-		if response.ClassType == ber.ClassApplication && response.TagType == ber.TypeConstructed && len(response.Children) == 3 {
+		if response.ClassType == ber.ClassApplication && response.TagType == ber.TypeConstructed && len(response.Children) >= 3 {
 			code = uint8(response.Children[0].Value.(uint64))
 			description = response.Children[2].Value.(string)
 			return
@@ -328,3 +331,29 @@ func getLDAPResultCode(p *ber.Packet) (code uint8, description string) {
 	description = "Invalid packet format"
 	return
 }
+
+// getLDAPResultReferrals returns the URIs of the optional [3] Referral of an
+// LDAPResult.
+func getLDAPResultReferrals(p *ber.Packet) (referrals []string) {
+	if len(p.Children) < 2 || len(p.Children[1].Children) < 4 {
+		return nil
+	}
+	referral := p.Children[1].Children[3]
+	if referral.ClassType != ber.ClassContext || referral.Tag != 3 {
+		return nil
+	}
+	for _, uri := range referral.Children {
+		referrals = append(referrals, string(uri.Data.Bytes()))
+	}
+	return
+}
+
+// getLDAPResultError returns nil for a successful LDAPResult, else an
+// *LDAPError including any referrals.
+func getLDAPResultError(p *ber.Packet) error {
+	code, description := getLDAPResultCode(p)
+	if code == LDAPResultSuccess {
+		return nil
+	}
+	return &LDAPError{ResultCode: code, sText: description, Referrals: getLDAPResultReferrals(p)}
+}
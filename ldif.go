@@ -78,7 +78,7 @@ func (lr *LDIFReader) ReadLDIFEntry() (LDIFRecord, error) {
 
 func sliceToLDIFRecord(lines [][]byte) (LDIFRecord, error) {
 	var dn string
-	var dataLineStart int // better name, after dn/controls/changetype
+	dataLineStart := len(lines) // better name, after dn/controls/changetype
 	controls := make([]Control, 0)
 	recordtype := EntryRecord
 LINES:
@@ -110,14 +110,16 @@ LINES:
 			}
 			continue LINES
 		case bytes.EqualFold(attrName, []byte("control")):
-			//TODO handle controls
+			control, err := parseLDIFControl(value)
+			if err != nil {
+				return nil, err
+			}
+			controls = append(controls, control)
 			continue LINES
 		}
 		dataLineStart = i
 		break
 	}
-	// TODO - add the missing record types
-	unsupportedError := NewLDAPError(ErrorLDIFRead, "Unsupported LDIF record type")
 	switch recordtype {
 	case AddRecord:
 		addEntry, err := ldifLinesToEntryRecord(dn, lines[dataLineStart:])
@@ -139,16 +141,16 @@ LINES:
 		}
 		modRequest.Controls = controls
 		return modRequest, nil
-	case ModDnRecord:
+	case ModDnRecord, ModRdnRecord:
 		if LDIFDebug {
-			log.Printf("dn: %s, changetype: %d, datastart: %d\n", dn, ModDnRecord, dataLineStart)
+			log.Printf("dn: %s, changetype: %d, datastart: %d\n", dn, recordtype, dataLineStart)
 		}
-		return nil, unsupportedError
-	case ModRdnRecord:
-		if LDIFDebug {
-			log.Printf("dn: %s, changetype: %d, datastart: %d\n", dn, ModRdnRecord, dataLineStart)
+		modDnRequest, err := ldifLinesToModDnRecord(dn, lines[dataLineStart:])
+		if err != nil {
+			return nil, err
 		}
-		return nil, unsupportedError
+		modDnRequest.Controls = controls
+		return modDnRequest, nil
 	case DeleteRecord:
 		if LDIFDebug {
 			log.Printf("dn: %s, changetype: %d, datastart: %d\n", dn, DeleteRecord, dataLineStart)
@@ -167,6 +169,49 @@ LINES:
 	return nil, NewLDAPError(ErrorLDIFRead, "Unkown LDIF record type")
 }
 
+// parseLDIFControl parses the value of a control line, RFC 2849:
+//
+//	control: <OID> [true|false] [: value | :: base64 value]
+//
+// The control is returned as a *ControlString holding the raw value, so it
+// does not depend on registered decoders and is written back unchanged.
+func parseLDIFControl(line []byte) (Control, error) {
+	s := string(line)
+	end := strings.IndexAny(s, " :")
+	if end == -1 {
+		end = len(s)
+	}
+	oid := s[:end]
+	if len(oid) == 0 {
+		return nil, NewLDAPError(ErrorLDIFRead, "control: line without an OID.")
+	}
+	s = strings.TrimLeft(s[end:], " ")
+	criticality := false
+	switch {
+	case strings.HasPrefix(s, "true"):
+		criticality, s = true, s[4:]
+	case strings.HasPrefix(s, "false"):
+		s = s[5:]
+	}
+	var value string
+	switch {
+	case len(s) == 0:
+	case strings.HasPrefix(s, "::"):
+		decoded, err := decodeBase64([]byte(strings.TrimLeft(s[2:], " ")))
+		if err != nil {
+			return nil, err
+		}
+		value = string(decoded)
+	case strings.HasPrefix(s, ":<"):
+		return nil, NewLDAPError(ErrorLDIFRead, "URL control values are not supported.")
+	case s[0] == ':':
+		value = strings.TrimLeft(s[1:], " ")
+	default:
+		return nil, NewLDAPError(ErrorLDIFRead, "Invalid control line: "+string(line))
+	}
+	return NewControlString(oid, criticality, value), nil
+}
+
 func ldifLinesToModifyRecord(dn string, lines [][]byte) (*ModifyRequest, error) {
 	modReq := NewModifyRequest(dn)
 	var currentModType uint8
@@ -207,7 +252,7 @@ func ldifLinesToModifyRecord(dn string, lines [][]byte) (*ModifyRequest, error)
 			newMod = NewMod(currentModType, currentAttrName, nil)
 		} else {
 			attrName := string(bAttr)
-			if currentAttrName != attrName {
+			if !AttributeDescriptionsEqual(currentAttrName, attrName) {
 				return nil, NewLDAPError(ErrorLDIFRead,
 					fmt.Sprintf("AttrName mismatch %s != %s", currentAttrName, attrName))
 			}
@@ -222,6 +267,42 @@ func ldifLinesToModifyRecord(dn string, lines [][]byte) (*ModifyRequest, error)
 	return modReq, nil
 }
 
+// ldifLinesToModDnRecord parses the newrdn, deleteoldrdn and optional
+// newsuperior lines of a moddn/modrdn record, in that order.
+func ldifLinesToModDnRecord(dn string, lines [][]byte) (*ModDnRequest, error) {
+	modDnReq := &ModDnRequest{DN: dn}
+	for i, line := range lines {
+		bAttr, bValue, sep, err := findAttrAndValue(line)
+		if err != nil {
+			return nil, err
+		}
+		if sep {
+			return nil, NewLDAPError(ErrorLDIFRead, "Misplaced '-' in moddn record.")
+		}
+		switch attrLower := strings.ToLower(string(bAttr)); {
+		case i == 0 && attrLower == "newrdn":
+			modDnReq.NewRDN = string(bValue)
+		case i == 1 && attrLower == "deleteoldrdn":
+			switch string(bValue) {
+			case "0":
+			case "1":
+				modDnReq.DeleteOldDn = true
+			default:
+				return nil, NewLDAPError(ErrorLDIFRead, "deleteoldrdn must be 0 or 1, not "+string(bValue))
+			}
+		case i == 2 && attrLower == "newsuperior":
+			modDnReq.NewSuperiorDN = string(bValue)
+		default:
+			return nil, NewLDAPError(ErrorLDIFRead,
+				fmt.Sprintf("Unexpected %s in moddn record, expecting newrdn, deleteoldrdn and newsuperior.", bAttr))
+		}
+	}
+	if len(lines) < 2 || len(modDnReq.NewRDN) == 0 {
+		return nil, NewLDAPError(ErrorLDIFRead, "moddn record requires newrdn and deleteoldrdn.")
+	}
+	return modDnReq, nil
+}
+
 func ldifLinesToEntryRecord(dn string, lines [][]byte) (*Entry, error) {
 	entry := NewEntry(dn)
 	for _, line := range lines {
@@ -251,9 +332,11 @@ func findAttrAndValue(line []byte) (attr []byte, value []byte, separator bool, e
 	// find the location of first ':'
 	if colonLoc == -1 {
 		return nil, nil, false, NewLDAPError(ErrorLDIFRead, ": not found in LDIF attr line.")
+	} else if colonLoc+1 == len(line) { // attr: with no value
+		return line[:colonLoc], []byte{}, false, nil
 	} else if line[colonLoc+1] == ':' { // base64 attr
 		valueStart = colonLoc + 2
-		if line[colonLoc+2] == ' ' {
+		if valueStart < len(line) && line[colonLoc+2] == ' ' {
 			valueStart = colonLoc + 3
 		}
 		base64 = true
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/base64"
+	"github.com/mavricknz/asn1-ber"
 	"io"
 	"strings"
 )
@@ -28,7 +29,6 @@ func NewLDIFWriter(writer io.Writer) (*LDIFWriter, error) {
 }
 
 func (lw *LDIFWriter) WriteLDIFRecord(record LDIFRecord) error {
-	// TODO: Controls for all.
 	if record == nil {
 		return NewLDAPError(ErrorLDIFWrite, "nil record")
 	}
@@ -38,6 +38,9 @@ func (lw *LDIFWriter) WriteLDIFRecord(record LDIFRecord) error {
 		if err := lw.writeDN(rec.Entry.DN); err != nil {
 			return err
 		}
+		if err := lw.writeControls(rec.Controls); err != nil {
+			return err
+		}
 		if err := lw.writeAttrLine(changetype, "add"); err != nil {
 			return err
 		}
@@ -50,6 +53,9 @@ func (lw *LDIFWriter) WriteLDIFRecord(record LDIFRecord) error {
 		if err := lw.writeDN(rec.DN); err != nil {
 			return err
 		}
+		if err := lw.writeControls(rec.Controls); err != nil {
+			return err
+		}
 		if err := lw.writeAttrLine(changetype, "modify"); err != nil {
 			return err
 		}
@@ -57,16 +63,30 @@ func (lw *LDIFWriter) WriteLDIFRecord(record LDIFRecord) error {
 			return err
 		}
 
-	case ModDnRecord:
-		//TODO
-	case ModRdnRecord:
-		//TODO
+	case ModDnRecord, ModRdnRecord:
+		rec := record.(*ModDnRequest)
+		if err := lw.writeDN(rec.DN); err != nil {
+			return err
+		}
+		if err := lw.writeControls(rec.Controls); err != nil {
+			return err
+		}
+		if err := lw.writeAttrLine(changetype, "modrdn"); err != nil {
+			return err
+		}
+		if err := lw.writeModDn(rec); err != nil {
+			return err
+		}
+
 	case DeleteRecord:
 		rec := record.(*DeleteRequest)
 
 		if err := lw.writeDN(rec.DN); err != nil {
 			return err
 		}
+		if err := lw.writeControls(rec.Controls); err != nil {
+			return err
+		}
 		if err := lw.writeAttrLine(changetype, "delete"); err != nil {
 			return err
 		}
@@ -95,23 +115,22 @@ func (lw *LDIFWriter) writeDN(DN string) (err error) {
 	if len(DN) == 0 {
 		return NewLDAPError(ErrorLDIFWrite, "DN has zero length.")
 	}
-	if err := lw.writeAttrLine("dn", DN); err != nil {
-		return err
+	return lw.writeValue("dn", DN)
+}
+
+// writeValue writes an attr line, base64 encoding the value if required.
+func (lw *LDIFWriter) writeValue(attrName, val string) error {
+	if lw.EncAsBinary(attrName) || NeedsBase64Encoding(val) {
+		return lw.writeEncAttr(attrName, val)
 	}
-	return
+	return lw.writeAttrLine(attrName, val)
 }
 
 func (lw *LDIFWriter) writeEntry(e *Entry) error {
 	for _, attr := range e.Attributes {
 		for _, val := range attr.Values {
-			if lw.EncAsBinary(attr.Name) || NeedsBase64Encoding(val) {
-				if err := lw.writeEncAttr(attr.Name, val); err != nil {
-					return err
-				}
-			} else {
-				if err := lw.writeAttrLine(attr.Name, val); err != nil {
-					return err
-				}
+			if err := lw.writeValue(attr.Name, val); err != nil {
+				return err
 			}
 		}
 	}
@@ -155,7 +174,7 @@ func NeedsBase64Encoding(val string) bool {
 			return true
 		}
 		switch val[i] {
-		case 0, 10, 14: // null, new line, carriage return
+		case 0, 10, 13: // null, new line, carriage return
 			return true
 		}
 	}
@@ -168,7 +187,7 @@ func (lw *LDIFWriter) writeMods(mods []Mod) error {
 			return err
 		}
 		for _, val := range mod.Modification.Values {
-			if err := lw.writeAttrLine(mod.Modification.Name, val); err != nil {
+			if err := lw.writeValue(mod.Modification.Name, val); err != nil {
 				return err
 			}
 		}
@@ -180,6 +199,63 @@ func (lw *LDIFWriter) writeMods(mods []Mod) error {
 	return nil
 }
 
+// writeControls writes a control line for each control, the OID, true if
+// critical and the value, base64 encoded if required or if it is binary,
+// as BER encoded values usually are.
+func (lw *LDIFWriter) writeControls(controls []Control) error {
+	for _, control := range controls {
+		p, err := control.Encode()
+		if err != nil {
+			return err
+		}
+		controlType, criticality, value := decodeControlTypeAndCrit(ber.DecodePacket(p.Bytes()))
+		line := controlType
+		if criticality {
+			line += " true"
+		}
+		if value != nil && value.Data.Len() > 0 {
+			if controlValue := value.Data.String(); NeedsBase64Encoding(controlValue) || !isPrintable(controlValue) {
+				line += ":: " + toBase64(controlValue)
+			} else {
+				line += ": " + controlValue
+			}
+		}
+		if err := lw.writeAttrLine("control", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isPrintable(val string) bool {
+	for i := 0; i < len(val); i++ {
+		if val[i] < ' ' || val[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func (lw *LDIFWriter) writeModDn(req *ModDnRequest) error {
+	if len(req.NewRDN) == 0 {
+		return NewLDAPError(ErrorLDIFWrite, "NewRDN has zero length.")
+	}
+	if err := lw.writeValue("newrdn", req.NewRDN); err != nil {
+		return err
+	}
+	deleteOldRDN := "0"
+	if req.DeleteOldDn {
+		deleteOldRDN = "1"
+	}
+	if err := lw.writeAttrLine("deleteoldrdn", deleteOldRDN); err != nil {
+		return err
+	}
+	if len(req.NewSuperiorDN) > 0 {
+		return lw.writeValue("newsuperior", req.NewSuperiorDN)
+	}
+	return nil
+}
+
 func (lw *LDIFWriter) writeAttrLine(attrName, value string) error {
 	_, werr := lw.Writer.WriteString(attrName)
 	if werr != nil {
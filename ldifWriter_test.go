@@ -41,3 +41,95 @@ func TestLdifWriter(t *testing.T) {
 	}
 	fmt.Printf("TestLdifWriter: ended.\n")
 }
+
+func TestLdifWriterModDn(t *testing.T) {
+	buf := new(bytes.Buffer)
+	lw, _ := NewLDIFWriter(buf)
+	lr, _ := NewLDIFReader(strings.NewReader(modDnLDIF))
+	for {
+		record, err := lr.ReadLDIFEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record == nil {
+			break
+		}
+		if err := lw.WriteLDIFRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "dn: cn=joe,ou=people,o=example.com\nchangetype: modrdn\nnewrdn: cn=joe blogs\ndeleteoldrdn: 1\n\n" +
+		"dn: cn=joe blogs,ou=people,o=example.com\nchangetype: modrdn\nnewrdn:: Y249am9lIGLDuGdz\ndeleteoldrdn: 0\n" +
+		"newsuperior: ou=staff,o=example.com\n\n"
+	if buf.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, buf.String())
+	}
+
+	if err := lw.WriteLDIFRecord(&ModDnRequest{DN: "cn=a"}); err == nil {
+		t.Errorf("expected an error writing a ModDnRequest without NewRDN")
+	}
+}
+
+func TestLdifWriterControls(t *testing.T) {
+	entry := NewEntry("cn=joe,o=example.com")
+	entry.AddAttributeValue("cn", "joe")
+	modRequest := NewModifyRequest("cn=joe,o=example.com")
+	modRequest.AddMod(NewMod(ModReplace, "sn", []string{"blogs"}))
+	modRequest.AddControl(NewControlPermissiveModifyRequest(false))
+	modRequest.AddControl(NewControlServerSideSortRequest([]ServerSideSortAttrRuleOrder{{AttributeName: "cn"}}, true))
+	modRequest.AddControl(&ControlMatchedValuesRequest{Filter: "(cn=a)", Filters: []string{"(sn=b)"}})
+	records := []LDIFRecord{
+		&AddRequest{Entry: entry, Controls: []Control{NewControlRelaxRulesRequest(true)}},
+		modRequest,
+		&ModDnRequest{DN: "cn=joe,o=example.com", NewRDN: "cn=joe2", Controls: []Control{NewControlManageDsaITRequest(true)}},
+		&DeleteRequest{DN: "cn=joe2,o=example.com", Controls: []Control{NewControlString("1.3.6.1.4.1.99999.5", false, "value")}},
+	}
+	buf := new(bytes.Buffer)
+	lw, _ := NewLDIFWriter(buf)
+	for _, record := range records {
+		if err := lw.WriteLDIFRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, line := range []string{
+		"control: 1.3.6.1.4.1.4203.666.5.12 true\n",
+		"control: 1.2.840.113556.1.4.1413\n",
+		"control: 1.2.840.113556.1.4.473 true:: MAYwBAQCY24=\n",
+		"control: 2.16.840.1.113730.3.4.2 true\n",
+		"control: 1.3.6.1.4.1.99999.5: value\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("%q not written", line)
+		}
+	}
+
+	lr, _ := NewLDIFReader(strings.NewReader(buf.String()))
+	for i, record := range records {
+		read, err := lr.ReadLDIFEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var written, got []Control
+		switch record := record.(type) {
+		case *AddRequest:
+			written, got = record.Controls, read.(*AddRequest).Controls
+		case *ModifyRequest:
+			written, got = record.Controls, read.(*ModifyRequest).Controls
+		case *ModDnRequest:
+			written, got = record.Controls, read.(*ModDnRequest).Controls
+		case *DeleteRequest:
+			written, got = record.Controls, read.(*DeleteRequest).Controls
+		}
+		// read back raw, with the same encoding
+		if len(written) != len(got) {
+			t.Errorf("record %d: expected controls %v, got %v", i, written, got)
+			continue
+		}
+		for j := range written {
+			if _, ok := got[j].(*ControlString); !ok ||
+				!bytes.Equal(mustEncode(t, written[j]).Bytes(), mustEncode(t, got[j]).Bytes()) {
+				t.Errorf("record %d: expected control %s, got %s", i, written[j], got[j])
+			}
+		}
+	}
+}
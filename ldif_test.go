@@ -6,6 +6,7 @@ import (
 	"fmt"
 	//"io"
 	//"os"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -188,3 +189,110 @@ func TestLDIFOpenAndRead(t *testing.T) {
 	//	fmt.Println(entry.GetAttributeValue("entryUUID"))
 	//}
 }
+
+var modDnLDIF string = `
+dn: cn=joe,ou=people,o=example.com
+changetype: modrdn
+newrdn: cn=joe blogs
+deleteoldrdn: 1
+
+dn: cn=joe blogs,ou=people,o=example.com
+changetype: moddn
+newrdn:: Y249am9lIGLDuGdz
+deleteoldrdn: 0
+newsuperior: ou=staff,o=example.com
+`
+
+func TestLDIFModDn(t *testing.T) {
+	lr, _ := NewLDIFReader(strings.NewReader(modDnLDIF))
+	for _, want := range []ModDnRequest{
+		{DN: "cn=joe,ou=people,o=example.com", NewRDN: "cn=joe blogs", DeleteOldDn: true},
+		{DN: "cn=joe blogs,ou=people,o=example.com", NewRDN: "cn=joe bøgs", NewSuperiorDN: "ou=staff,o=example.com"},
+	} {
+		record, err := lr.ReadLDIFEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, ok := record.(*ModDnRequest)
+		if !ok || record.RecordType() != ModDnRecord {
+			t.Fatalf("expected a ModDnRequest, got %T", record)
+		}
+		if req.DN != want.DN || req.NewRDN != want.NewRDN || req.DeleteOldDn != want.DeleteOldDn ||
+			req.NewSuperiorDN != want.NewSuperiorDN {
+			t.Errorf("expected %+v, got %+v", want, req)
+		}
+	}
+
+	for _, invalid := range []string{
+		"dn: cn=a\nchangetype: modrdn\n",
+		"dn: cn=a\nchangetype: modrdn\nnewrdn: cn=b\n",
+		"dn: cn=a\nchangetype: modrdn\nnewrdn: cn=b\ndeleteoldrdn: yes\n",
+		"dn: cn=a\nchangetype: modrdn\ndeleteoldrdn: 1\nnewrdn: cn=b\n",
+		"dn: cn=a\nchangetype: modrdn\nnewrdn: cn=b\ndeleteoldrdn: 1\nnewsuperior: o=x\ncn: b\n",
+		"dn: cn=a\nchangetype: modrdn\nnewrdn:\ndeleteoldrdn: 1\n",
+	} {
+		lr, _ := NewLDIFReader(strings.NewReader(invalid))
+		if record, err := lr.ReadLDIFEntry(); err == nil {
+			t.Errorf("%q expected an error, got %+v", invalid, record)
+		}
+	}
+}
+
+var controlLDIF string = `
+dn: ou=old,o=example.com
+control: 1.2.840.113556.1.4.805 true
+control: 2.16.840.1.113730.3.4.2
+changetype: delete
+
+dn: cn=joe,ou=people,o=example.com
+control: 1.3.6.1.4.1.4203.666.5.12 false
+control: 1.3.6.1.4.1.99999.5 false: plain value
+control: 1.3.6.1.4.1.99999.6 true:: AAE=
+control: 1.2.840.113556.1.4.319 true
+changetype: modify
+replace: sn
+sn: blogs
+-
+`
+
+func TestLDIFControls(t *testing.T) {
+	lr, _ := NewLDIFReader(strings.NewReader(controlLDIF))
+	record, err := lr.ReadLDIFEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteRequest := record.(*DeleteRequest)
+	if len(deleteRequest.Controls) != 2 ||
+		!reflect.DeepEqual(deleteRequest.Controls[0], NewControlSubtreeDeleteRequest(true)) ||
+		!reflect.DeepEqual(deleteRequest.Controls[1], NewControlManageDsaITRequest(false)) {
+		t.Errorf("unexpected delete controls %v", deleteRequest.Controls)
+	}
+
+	record, err = lr.ReadLDIFEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	modRequest := record.(*ModifyRequest)
+	want := []Control{
+		NewControlRelaxRulesRequest(false),
+		NewControlString("1.3.6.1.4.1.99999.5", false, "plain value"),
+		NewControlString("1.3.6.1.4.1.99999.6", true, "\x00\x01"),
+		// not decoded, a paging control without a value is kept
+		NewControlString(ControlTypePaging, true, ""),
+	}
+	if !reflect.DeepEqual(modRequest.Controls, want) || len(modRequest.Mods) != 1 {
+		t.Errorf("expected controls %v, got %v", want, modRequest.Controls)
+	}
+
+	for _, invalid := range []string{
+		"dn: cn=a\ncontrol:\nchangetype: delete\n",
+		"dn: cn=a\ncontrol: 1.2.3 maybe\nchangetype: delete\n",
+		"dn: cn=a\ncontrol: 1.2.3 true:< file:///tmp/value\nchangetype: delete\n",
+		"dn: cn=a\ncontrol: 1.2.3 true:: !!\nchangetype: delete\n",
+	} {
+		lr, _ := NewLDIFReader(strings.NewReader(invalid))
+		if record, err := lr.ReadLDIFEntry(); err == nil {
+			t.Errorf("%q expected an error, got %+v", invalid, record)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains mapping of entries to and from tagged structs
+package ldap
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Struct fields are mapped to attributes by their ldap tag, or the field name if
+there is no tag. "-" skips a field and the tag name "dn" maps the Entry DN.
+
+	type User struct {
+		DN         string    `ldap:"dn"`
+		Uid        string    `ldap:"uid"`
+		Mail       []string  `ldap:"mail,omitempty"`
+		Photo      []byte    `ldap:"jpegPhoto,omitempty"`
+		Created    time.Time `ldap:"createTimestamp,omitempty"`
+		PwdLastSet time.Time `ldap:"pwdLastSet,filetime,omitempty"`
+	}
+
+Supported field types are string, []byte, bool, integers, time.Time
+(GeneralizedTime, or AD FILETIME with the filetime option), slices and
+pointers of these, and types implementing Marshaler/Unmarshaler.
+Scalar fields are an error for attributes with more than one value.
+*/
+
+// Marshaler is implemented by field types that format their own values.
+type Marshaler interface {
+	MarshalLDAP() ([]string, error)
+}
+
+// Unmarshaler is implemented by field types that parse their own values.
+type Unmarshaler interface {
+	UnmarshalLDAP(values []string) error
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	byteSliceType   = reflect.TypeOf([]byte(nil))
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+type structField struct {
+	index     []int
+	name      string
+	omitEmpty bool
+	fileTime  bool
+}
+
+// structFields - the mapped fields of struct type t, including fields of
+// embedded structs.
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("ldap")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for _, embedded := range structFields(f.Type) {
+				embedded.index = append([]int{i}, embedded.index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		options := strings.Split(tag, ",")
+		field := structField{index: []int{i}, name: options[0]}
+		if field.name == "" {
+			field.name = f.Name
+		}
+		for _, option := range options[1:] {
+			switch option {
+			case "omitempty":
+				field.omitEmpty = true
+			case "filetime":
+				field.fileTime = true
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return rv, NewLDAPError(ErrorInvalidArgument, fmt.Sprintf("Expected a struct or pointer to a struct, got %T", v))
+	}
+	return addressable(rv), nil
+}
+
+// addressable returns v, or a copy of v if it is not addressable e.g. a
+// struct passed by value, so that pointer receiver methods can be used.
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v
+	}
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+	return copied
+}
+
+// Unmarshal sets the fields of the struct pointed to by v from entry.
+// Fields for attributes not in entry are left unchanged.
+func Unmarshal(entry *Entry, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return NewLDAPError(ErrorInvalidArgument, fmt.Sprintf("Unmarshal expects a pointer to a struct, got %T", v))
+	}
+	rv = rv.Elem()
+	for _, field := range structFields(rv.Type()) {
+		fv := rv.FieldByIndex(field.index)
+		var values []string
+		if strings.EqualFold(field.name, "dn") {
+			values = []string{entry.DN}
+		} else {
+			values = entry.GetAttributeValues(field.name)
+			if len(values) == 0 {
+				continue
+			}
+		}
+		if err := unmarshalValues(fv, field, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalEntries unmarshals entries e.g. SearchResult.Entries into the
+// slice of structs, or pointers to structs, pointed to by v.
+func UnmarshalEntries(entries []*Entry, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return NewLDAPError(ErrorInvalidArgument, fmt.Sprintf("UnmarshalEntries expects a pointer to a slice, got %T", v))
+	}
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return NewLDAPError(ErrorInvalidArgument, fmt.Sprintf("UnmarshalEntries expects a slice of structs, got %T", v))
+	}
+	result := reflect.MakeSlice(slice.Type(), 0, len(entries))
+	for _, entry := range entries {
+		elem := reflect.New(elemType)
+		if err := Unmarshal(entry, elem.Interface()); err != nil {
+			return err
+		}
+		if isPtr {
+			result = reflect.Append(result, elem)
+		} else {
+			result = reflect.Append(result, elem.Elem())
+		}
+	}
+	slice.Set(result)
+	return nil
+}
+
+func unmarshalValues(fv reflect.Value, field structField, values []string) error {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return unmarshalValues(fv.Elem(), field, values)
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(unmarshalerType) {
+		return fv.Addr().Interface().(Unmarshaler).UnmarshalLDAP(values)
+	}
+	if fv.Kind() == reflect.Slice && fv.Type() != byteSliceType {
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := unmarshalValues(slice.Index(i), field, []string{value}); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	if len(values) != 1 {
+		return NewLDAPError(LDAPResultConstraintViolation,
+			fmt.Sprintf("Expected a single value for attribute %s, got %d", field.name, len(values)))
+	}
+	return unmarshalValue(fv, field, values[0])
+}
+
+func unmarshalValue(fv reflect.Value, field structField, value string) error {
+	switch {
+	case fv.Type() == timeType:
+		var t time.Time
+		var err error
+		if field.fileTime {
+			t, err = ParseFileTime(value)
+		} else {
+			t, err = ParseGeneralizedTime(value)
+		}
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	case fv.Type() == byteSliceType:
+		fv.SetBytes([]byte(value))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || fv.OverflowInt(i) {
+			return NewLDAPError(LDAPResultInvalidAttributeSyntax,
+				fmt.Sprintf("Invalid integer for attribute %s: %s", field.name, value))
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || fv.OverflowUint(u) {
+			return NewLDAPError(LDAPResultInvalidAttributeSyntax,
+				fmt.Sprintf("Invalid integer for attribute %s: %s", field.name, value))
+		}
+		fv.SetUint(u)
+	default:
+		return NewLDAPError(ErrorInvalidArgument,
+			fmt.Sprintf("Unsupported field type %s for attribute %s", fv.Type(), field.name))
+	}
+	return nil
+}
+
+// Marshal returns an AddRequest for the struct, or pointer to a struct, v.
+// The DN is taken from the field tagged "dn", which must be set.
+func Marshal(v interface{}) (*AddRequest, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	entry := NewEntry("")
+	for _, field := range structFields(rv.Type()) {
+		fv := rv.FieldByIndex(field.index)
+		if strings.EqualFold(field.name, "dn") {
+			if fv.Kind() != reflect.String {
+				return nil, NewLDAPError(ErrorInvalidArgument, "The dn field must be a string")
+			}
+			entry.DN = fv.String()
+			continue
+		}
+		if field.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		values, err := marshalValues(fv, field)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 0 {
+			entry.AddAttributeValues(field.name, values)
+		}
+	}
+	if entry.DN == "" {
+		return nil, NewLDAPError(ErrorInvalidArgument, fmt.Sprintf("No dn set for %T", v))
+	}
+	return &AddRequest{Entry: entry, Controls: make([]Control, 0)}, nil
+}
+
+func marshalValues(fv reflect.Value, field structField) ([]string, error) {
+	if fv.Type().Implements(marshalerType) {
+		if fv.Kind() == reflect.Ptr && fv.IsNil() {
+			return nil, nil
+		}
+		return fv.Interface().(Marshaler).MarshalLDAP()
+	}
+	if reflect.PtrTo(fv.Type()).Implements(marshalerType) {
+		return addressable(fv).Addr().Interface().(Marshaler).MarshalLDAP()
+	}
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil, nil
+		}
+		return marshalValues(fv.Elem(), field)
+	}
+	if fv.Kind() == reflect.Slice && fv.Type() != byteSliceType {
+		values := make([]string, 0, fv.Len())
+		for i := 0; i < fv.Len(); i++ {
+			elemValues, err := marshalValues(fv.Index(i), field)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, elemValues...)
+		}
+		return values, nil
+	}
+	value, err := marshalValue(fv, field)
+	if err != nil {
+		return nil, err
+	}
+	return []string{value}, nil
+}
+
+func marshalValue(fv reflect.Value, field structField) (string, error) {
+	switch {
+	case fv.Type() == timeType:
+		t := fv.Interface().(time.Time)
+		if field.fileTime {
+			return FormatFileTime(t), nil
+		}
+		return FormatGeneralizedTime(t), nil
+	case fv.Type() == byteSliceType:
+		return string(fv.Bytes()), nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		return FormatBool(fv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	}
+	return "", NewLDAPError(ErrorInvalidArgument,
+		fmt.Sprintf("Unsupported field type %s for attribute %s", fv.Type(), field.name))
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+	return false
+}
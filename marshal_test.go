@@ -0,0 +1,158 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPostalAddress is stored as '$' separated lines.
+type testPostalAddress struct {
+	Lines []string
+}
+
+func (a *testPostalAddress) UnmarshalLDAP(values []string) error {
+	a.Lines = strings.Split(values[0], "$")
+	return nil
+}
+
+func (a testPostalAddress) MarshalLDAP() ([]string, error) {
+	return []string{strings.Join(a.Lines, "$")}, nil
+}
+
+type testAccount struct {
+	PwdLastSet time.Time `ldap:"pwdLastSet,filetime,omitempty"`
+}
+
+type testUser struct {
+	DN        string `ldap:"dn"`
+	Uid       string `ldap:"uid"`
+	Mail      []string
+	UidNumber int                `ldap:"uidNumber,omitempty"`
+	Disabled  bool               `ldap:"nsAccountLock,omitempty"`
+	Photo     []byte             `ldap:"jpegPhoto,omitempty"`
+	Created   time.Time          `ldap:"createTimestamp,omitempty"`
+	Manager   *string            `ldap:"manager,omitempty"`
+	Address   *testPostalAddress `ldap:"postalAddress,omitempty"`
+	Internal  string             `ldap:"-"`
+	testAccount
+}
+
+func TestUnmarshal(t *testing.T) {
+	e := NewEntry("uid=bob,o=example")
+	e.AddAttributeValue("UID", "bob")
+	e.AddAttributeValues("mail", []string{"bob@example.com", "b@example.com"})
+	e.AddAttributeValue("uidNumber", "1000")
+	e.AddAttributeValue("nsAccountLock", "TRUE")
+	e.AddAttributeByteValue("jpegPhoto", binaryValue)
+	e.AddAttributeValue("createTimestamp", "20130704153000Z")
+	e.AddAttributeValue("manager", "uid=alice,o=example")
+	e.AddAttributeValue("postalAddress", "1 Main St$Springfield")
+	e.AddAttributeValue("pwdLastSet", "130173696000000000")
+	e.AddAttributeValue("Internal", "ignored")
+
+	var u testUser
+	if err := Unmarshal(e, &u); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2013, 7, 4, 15, 30, 0, 0, time.UTC)
+	if u.DN != e.DN || u.Uid != "bob" || len(u.Mail) != 2 || u.UidNumber != 1000 || !u.Disabled ||
+		!bytes.Equal(u.Photo, binaryValue) || !u.Created.Equal(created) || u.Internal != "" {
+		t.Errorf("unexpected unmarshal %+v", u)
+	}
+	if u.Manager == nil || *u.Manager != "uid=alice,o=example" {
+		t.Errorf("pointer field not set: %v", u.Manager)
+	}
+	if u.Address == nil || len(u.Address.Lines) != 2 || u.Address.Lines[1] != "Springfield" {
+		t.Errorf("custom unmarshaler not used: %v", u.Address)
+	}
+	if !u.PwdLastSet.Equal(time.Date(2013, 7, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("embedded filetime field not set: %s", u.PwdLastSet)
+	}
+
+	var users []*testUser
+	if err := UnmarshalEntries([]*Entry{e, NewEntry("uid=carol,o=example")}, &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[1].DN != "uid=carol,o=example" {
+		t.Errorf("unexpected UnmarshalEntries %v", users)
+	}
+
+	e.AddAttributeValue("uid", "robert")
+	if err := Unmarshal(e, &u); err == nil {
+		t.Errorf("expected error for multiple values in a string field")
+	}
+	if err := Unmarshal(e, u); err == nil {
+		t.Errorf("expected error for non pointer")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	manager := "uid=alice,o=example"
+	u := testUser{
+		DN:       "uid=bob,o=example",
+		Uid:      "bob",
+		Mail:     []string{"bob@example.com"},
+		Photo:    binaryValue,
+		Manager:  &manager,
+		Address:  &testPostalAddress{Lines: []string{"1 Main St", "Springfield"}},
+		Internal: "secret",
+	}
+	addReq, err := Marshal(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := addReq.Entry
+	if e.DN != u.DN || len(e.Attributes) != 5 {
+		t.Fatalf("unexpected marshal %s", addReq)
+	}
+	if got := e.GetAttributeValues("postalAddress"); len(got) != 1 || got[0] != "1 Main St$Springfield" {
+		t.Errorf("custom marshaler not used: %v", got)
+	}
+	if got := e.GetAttributeByteValues("jpegPhoto"); len(got) != 1 || !bytes.Equal(got[0], binaryValue) {
+		t.Errorf("binary field not marshalled: %v", got)
+	}
+
+	var round testUser
+	if err := Unmarshal(e, &round); err != nil {
+		t.Fatal(err)
+	}
+	if round.Uid != u.Uid || *round.Manager != manager {
+		t.Errorf("round trip failed %+v", round)
+	}
+
+	u.DN = ""
+	if _, err := Marshal(u); err == nil {
+		t.Errorf("expected error for empty dn")
+	}
+}
+
+// testEmployeeNumber has a pointer receiver MarshalLDAP.
+type testEmployeeNumber int
+
+func (n *testEmployeeNumber) MarshalLDAP() ([]string, error) {
+	return []string{fmt.Sprintf("E%05d", int(*n))}, nil
+}
+
+func TestMarshalByValue(t *testing.T) {
+	v := struct {
+		DN     string             `ldap:"dn"`
+		Number testEmployeeNumber `ldap:"employeeNumber"`
+	}{"uid=bob,o=example", 42}
+	for _, arg := range []interface{}{v, &v} {
+		addReq, err := Marshal(arg)
+		if err != nil {
+			t.Errorf("%T: %s", arg, err)
+			continue
+		}
+		if got := addReq.Entry.GetAttributeValues("employeeNumber"); len(got) != 1 || got[0] != "E00042" {
+			t.Errorf("%T: pointer receiver marshaler not used: %v", arg, got)
+		}
+	}
+}
@@ -5,7 +5,18 @@
 // This package provides LDAP MatchingRule functions.
 package ldap
 
-// At the moment just helper values for ServerSideSorting.
+import (
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Matching rule OIDs, for ServerSideSorting, extensible match filters and
+// the client side MatchingRule implementations.
 const (
 	MatchingRule_numericStringOrderingMatch          = "2.5.13.9"                   // 1.3.6.1.4.1.1466.115.121.1.36
 	MatchingRule_numericStringMatch                  = "2.5.13.8"                   // 1.3.6.1.4.1.1466.115.121.1.36
@@ -55,3 +66,484 @@ const (
 	MatchingRule_uuidOrderingMatch                   = "1.3.6.1.1.16.3"             // 1.3.6.1.1.16.1
 	MatchingRule_uuidMatch                           = "1.3.6.1.1.16.2"             // 1.3.6.1.1.16.1
 )
+
+// MatchingRule is a client side implementation of a matching rule, used by
+// Filter.Matches. Values are compared after being normalized, so the same
+// implementation serves equality, ordering and substrings rules.
+type MatchingRule interface {
+	// Normalize returns the form of value used by Compare, an error if
+	// value is not valid for the syntax of the rule.
+	Normalize(value string) (string, error)
+	// Compare two normalized values, returns -1, 0 or 1.
+	Compare(a, b string) int
+}
+
+// InsignificantSpaceRule is optionally implemented by a MatchingRule whose
+// Normalize applies the insignificant space handling of RFC 4518 2.6.1, as
+// caseIgnoreMatch does, leaving one space between words and none at either
+// end. Substrings assertions with such a rule prepare their pieces as 2.6.1
+// substrings, keeping a space at the edge of a piece as a word boundary.
+type InsignificantSpaceRule interface {
+	MatchingRule
+	RemovesInsignificantSpace() bool
+}
+
+var matchingRuleLock sync.RWMutex
+var matchingRules = map[string]MatchingRule{}
+var matchingRuleOIDs = map[string]string{} // lower case name to OID
+
+// RegisterMatchingRule adds or replaces the implementation of the matching
+// rule oid, names are alternatives for the OID e.g. caseIgnoreMatch.
+func RegisterMatchingRule(oid string, names []string, rule MatchingRule) {
+	matchingRuleLock.Lock()
+	defer matchingRuleLock.Unlock()
+	matchingRules[oid] = rule
+	for _, name := range names {
+		matchingRuleOIDs[strings.ToLower(name)] = oid
+	}
+}
+
+// GetMatchingRule returns the implementation of a matching rule by OID or
+// name, nil if there is none.
+func GetMatchingRule(oidOrName string) MatchingRule {
+	matchingRuleLock.RLock()
+	defer matchingRuleLock.RUnlock()
+	if oid, ok := matchingRuleOIDs[strings.ToLower(oidOrName)]; ok {
+		oidOrName = oid
+	}
+	return matchingRules[oidOrName]
+}
+
+// StandardAttributeMatchingRules returns the matching rules of common
+// attribute types (lower case) used by default by Filter.Matches, see
+// SetAttributeMatchingRules.
+func StandardAttributeMatchingRules() map[string]string {
+	return map[string]string{
+		"createtimestamp":    MatchingRule_generalizedTimeMatch,
+		"modifytimestamp":    MatchingRule_generalizedTimeMatch,
+		"whencreated":        MatchingRule_generalizedTimeMatch,
+		"whenchanged":        MatchingRule_generalizedTimeMatch,
+		"uidnumber":          MatchingRule_integerMatch,
+		"gidnumber":          MatchingRule_integerMatch,
+		"useraccountcontrol": MatchingRule_integerMatch,
+		"objectguid":         MatchingRule_octetStringMatch,
+		"objectsid":          MatchingRule_octetStringMatch,
+		"userpassword":       MatchingRule_octetStringMatch,
+		"jpegphoto":          MatchingRule_octetStringMatch,
+		"usercertificate":    MatchingRule_octetStringMatch,
+		"member":             MatchingRule_distinguishedNameMatch,
+		"memberof":           MatchingRule_distinguishedNameMatch,
+		"manager":            MatchingRule_distinguishedNameMatch,
+		"owner":              MatchingRule_distinguishedNameMatch,
+		"seealso":            MatchingRule_distinguishedNameMatch,
+		"telephonenumber":    MatchingRule_telephoneNumberMatch,
+		"mobile":             MatchingRule_telephoneNumberMatch,
+		"homephone":          MatchingRule_telephoneNumberMatch,
+		"entryuuid":          MatchingRule_uuidMatch,
+	}
+}
+
+var (
+	attributeMatchingRules     = StandardAttributeMatchingRules()
+	attributeMatchingRulesLock sync.RWMutex
+)
+
+// SetAttributeMatchingRules sets the matching rule OID or name of attribute
+// types, used by Filter.Matches for equality, ordering and substrings
+// assertions and by SortEntries. Attributes not listed use caseIgnoreMatch,
+// nil for none. The default is StandardAttributeMatchingRules, the rules of
+// a server can be read with GetSchema and Schema.AttributeMatchingRules. The
+// setting is shared by all connections, so set it once before use. rules is
+// copied, later changes to it have no effect.
+func SetAttributeMatchingRules(rules map[string]string) {
+	var copied map[string]string
+	if rules != nil {
+		copied = make(map[string]string, len(rules))
+		for attr, rule := range rules {
+			copied[strings.ToLower(attr)] = rule
+		}
+	}
+	attributeMatchingRulesLock.Lock()
+	attributeMatchingRules = copied
+	attributeMatchingRulesLock.Unlock()
+}
+
+// AttributeMatchingRules returns the rules set by SetAttributeMatchingRules,
+// by lower case attribute type. It must not be modified.
+func AttributeMatchingRules() map[string]string {
+	attributeMatchingRulesLock.RLock()
+	defer attributeMatchingRulesLock.RUnlock()
+	return attributeMatchingRules
+}
+
+// attributeMatchingRule - the matching rule for an attribute description.
+func attributeMatchingRule(attr string) MatchingRule {
+	attrType := splitAttributeDescription(attr).Type
+	rules := AttributeMatchingRules()
+	oid, ok := rules[strings.ToLower(attrType)]
+	if !ok && DefaultAttributeAliases() != nil {
+		for name, ruleOID := range rules {
+			if attributeTypesEqual(name, attrType) {
+				oid, ok = ruleOID, true
+				break
+			}
+		}
+	}
+	if ok {
+		if rule := GetMatchingRule(oid); rule != nil {
+			return rule
+		}
+	}
+	return GetMatchingRule(MatchingRule_caseIgnoreMatch)
+}
+
+// stringRule compares strings byte by byte after prep.
+type stringRule struct {
+	prep func(string) (string, error)
+}
+
+func (r stringRule) Normalize(value string) (string, error) {
+	return r.prep(value)
+}
+
+func (r stringRule) Compare(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+// spaceStringRule is a stringRule whose prep is prepareString.
+type spaceStringRule struct {
+	stringRule
+}
+
+func (spaceStringRule) RemovesInsignificantSpace() bool {
+	return true
+}
+
+// integerRule orders normalized decimal integers numerically.
+type integerRule struct{}
+
+func (integerRule) Normalize(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	digits := strings.TrimLeft(strings.TrimPrefix(value, "-"), "0")
+	if strings.Trim(strings.TrimPrefix(value, "-"), "0123456789") != "" || value == "" || value == "-" {
+		return "", NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid integer: "+value)
+	}
+	if digits == "" {
+		return "0", nil
+	}
+	if negative {
+		return "-" + digits, nil
+	}
+	return digits, nil
+}
+
+func (integerRule) Compare(a, b string) int {
+	aNeg, bNeg := strings.HasPrefix(a, "-"), strings.HasPrefix(b, "-")
+	if aNeg != bNeg {
+		if aNeg {
+			return -1
+		}
+		return 1
+	}
+	c := len(a) - len(b)
+	if c == 0 {
+		c = strings.Compare(a, b)
+	}
+	switch {
+	case c < 0 && aNeg, c > 0 && !aNeg:
+		return 1
+	case c > 0 && aNeg, c < 0 && !aNeg:
+		return -1
+	}
+	return 0
+}
+
+// CompareValues compares two values with rule, returns -1, 0 or 1, an error
+// if either value is not valid for the rule.
+func CompareValues(rule MatchingRule, a, b string) (int, error) {
+	normA, err := rule.Normalize(a)
+	if err != nil {
+		return 0, err
+	}
+	normB, err := rule.Normalize(b)
+	if err != nil {
+		return 0, err
+	}
+	return rule.Compare(normA, normB), nil
+}
+
+// ValuesEqual is true if a and b are equal under rule. Values that are not
+// valid for the rule, or all values if rule is nil, are compared byte by
+// byte.
+func ValuesEqual(rule MatchingRule, a, b string) bool {
+	if rule == nil {
+		return a == b
+	}
+	c, err := CompareValues(rule, a, b)
+	if err != nil {
+		return a == b
+	}
+	return c == 0
+}
+
+// SortValues sorts values in place in the order of rule. Values that are
+// not valid for the rule sort last, in their original order.
+func SortValues(rule MatchingRule, values []string) {
+	normalized := make([]string, len(values))
+	valid := make([]bool, len(values))
+	for i, value := range values {
+		norm, err := rule.Normalize(value)
+		normalized[i], valid[i] = norm, err == nil
+	}
+	sort.Stable(valueSorter{rule, values, normalized, valid})
+}
+
+type valueSorter struct {
+	rule       MatchingRule
+	values     []string
+	normalized []string
+	valid      []bool
+}
+
+func (s valueSorter) Len() int {
+	return len(s.values)
+}
+
+func (s valueSorter) Less(i, j int) bool {
+	if !s.valid[i] || !s.valid[j] {
+		return s.valid[i] && !s.valid[j]
+	}
+	return s.rule.Compare(s.normalized[i], s.normalized[j]) < 0
+}
+
+func (s valueSorter) Swap(i, j int) {
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+	s.normalized[i], s.normalized[j] = s.normalized[j], s.normalized[i]
+	s.valid[i], s.valid[j] = s.valid[j], s.valid[i]
+}
+
+// DedupeValues returns values without those equal under rule to an earlier
+// value, see ValuesEqual. values is not modified.
+func DedupeValues(rule MatchingRule, values []string) []string {
+	deduped := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		key := "\x00" + value // invalid values only equal themselves
+		if rule != nil {
+			if norm, err := rule.Normalize(value); err == nil {
+				key = norm
+			}
+		}
+		if !seen[key] {
+			seen[key] = true
+			deduped = append(deduped, value)
+		}
+	}
+	return deduped
+}
+
+// prepareString is the string preparation of RFC 4518, without the bidi
+// step. Control and format characters are removed, other spaces become
+// U+0020 and case is folded if fold is set, the result is normalized to NFKC
+// (and folded again, as compatibility characters may decompose to upper
+// case), prohibited characters are an error and insignificant spaces are
+// removed, leaving a single space between words.
+func prepareString(value string, fold bool) (string, error) {
+	mapped := make([]rune, 0, len(value))
+	for i, r := range value {
+		switch {
+		case prohibitedRune(r):
+			// NFKC does not produce prohibited characters, so they are
+			// found here with their position in value
+			return "", NewLDAPError(LDAPResultInvalidAttributeSyntax,
+				fmt.Sprintf("Prohibited character %U at position %d", r, i))
+		case spaceRune(r):
+			mapped = append(mapped, ' ')
+		case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Variation_Selector),
+			r == '\u1806' || r == '\u034f' || r == '\ufffc':
+			// mapped to nothing
+		default:
+			if fold {
+				r = foldRune(r)
+			}
+			mapped = append(mapped, r)
+		}
+	}
+	normalized := norm.NFKC.String(string(mapped))
+	prepared := make([]rune, 0, len(normalized))
+	space := false
+	for _, r := range normalized {
+		if spaceRune(r) {
+			space = len(prepared) > 0
+			continue
+		}
+		if space {
+			prepared = append(prepared, ' ')
+			space = false
+		}
+		if fold {
+			r = foldRune(r)
+		}
+		prepared = append(prepared, r)
+	}
+	return string(prepared), nil
+}
+
+func foldRune(r rune) rune {
+	return unicode.ToLower(unicode.ToUpper(r))
+}
+
+// spaceRune - mapped to U+0020 by the string preparation.
+func spaceRune(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\v' || r == '\f' || r == '\r' || r == '\u0085' ||
+		unicode.In(r, unicode.Zs, unicode.Zl, unicode.Zp)
+}
+
+// prohibitedRune - private use, non-characters and the replacement
+// character, which is also how invalid UTF-8 is decoded.
+func prohibitedRune(r rune) bool {
+	return r == utf8.RuneError || unicode.Is(unicode.Co, r) ||
+		(r >= 0xfdd0 && r <= 0xfdef) || r&0xfffe == 0xfffe
+}
+
+func prepCaseIgnore(value string) (string, error) {
+	return prepareString(value, true)
+}
+
+func prepCaseExact(value string) (string, error) {
+	return prepareString(value, false)
+}
+
+// prepTelephoneNumber - as caseIgnoreMatch, ignoring spaces and hyphens.
+func prepTelephoneNumber(value string) (string, error) {
+	value, err := prepCaseIgnore(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\u2212' || unicode.Is(unicode.Pd, r) {
+			return -1
+		}
+		return r
+	}, value), nil
+}
+
+func prepOctetString(value string) (string, error) {
+	return value, nil
+}
+
+func prepNumericString(value string) (string, error) {
+	value, err := prepareString(value, false)
+	if err != nil {
+		return "", err
+	}
+	value = strings.Replace(value, " ", "", -1)
+	if strings.Trim(value, "0123456789") != "" {
+		return "", NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid numeric string: "+value)
+	}
+	return value, nil
+}
+
+func prepBoolean(value string) (string, error) {
+	b, err := ParseBool(value)
+	if err != nil {
+		return "", err
+	}
+	return FormatBool(b), nil
+}
+
+// prepGeneralizedTime - UTC with a fixed width fraction, so normalized
+// values order as strings.
+func prepGeneralizedTime(value string) (string, error) {
+	t, err := ParseGeneralizedTime(value)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format("20060102150405.000000000Z"), nil
+}
+
+// prepDN - the DN with attribute types in their canonical form, see
+// SetDefaultAttributeAliases, values prepared as for caseIgnoreMatch and the
+// parts of multi valued RDNs sorted, so equal DNs have equal forms.
+func prepDN(value string) (string, error) {
+	dn, err := ParseDN(value)
+	if err != nil {
+		return "", NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid DN: "+value)
+	}
+	aliases := DefaultAttributeAliases()
+	rdns := make([]string, len(dn.RDNs))
+	for i, rdn := range dn.RDNs {
+		atvs := make([]string, len(rdn.Attributes))
+		for j, atv := range rdn.Attributes {
+			attrType := strings.ToLower(atv.Type)
+			if aliases != nil {
+				attrType = aliases.Canonical(atv.Type)
+			}
+			atvValue, err := prepCaseIgnore(atv.Value)
+			if err != nil {
+				return "", err
+			}
+			atvs[j] = attrType + "=" + EscapeDNValue(atvValue)
+		}
+		sort.Strings(atvs)
+		rdns[i] = strings.Join(atvs, "+")
+	}
+	return strings.Join(rdns, ","), nil
+}
+
+// prepUUID - the lower case RFC 4122 string form, RFC 4530.
+func prepUUID(value string) (string, error) {
+	if len(value) != 36 {
+		return "", NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid UUID: "+value)
+	}
+	for i := 0; i < len(value); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if value[i] != '-' {
+				return "", NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid UUID: "+value)
+			}
+		default:
+			if !isHexDigit(value[i]) {
+				return "", NewLDAPError(LDAPResultInvalidAttributeSyntax, "Invalid UUID: "+value)
+			}
+		}
+	}
+	return strings.ToLower(value), nil
+}
+
+func init() {
+	caseIgnore := spaceStringRule{stringRule{prepCaseIgnore}}
+	RegisterMatchingRule(MatchingRule_caseIgnoreMatch, []string{"caseIgnoreMatch"}, caseIgnore)
+	RegisterMatchingRule(MatchingRule_caseIgnoreOrderingMatch, []string{"caseIgnoreOrderingMatch"}, caseIgnore)
+	RegisterMatchingRule(MatchingRule_caseIgnoreSubstringsMatch, []string{"caseIgnoreSubstringsMatch"}, caseIgnore)
+	RegisterMatchingRule(MatchingRule_caseIgnoreIA5Match, []string{"caseIgnoreIA5Match"}, caseIgnore)
+	RegisterMatchingRule(MatchingRule_caseIgnoreIA5SubstringsMatch, []string{"caseIgnoreIA5SubstringsMatch"}, caseIgnore)
+	caseExact := spaceStringRule{stringRule{prepCaseExact}}
+	RegisterMatchingRule(MatchingRule_caseExactMatch, []string{"caseExactMatch"}, caseExact)
+	RegisterMatchingRule(MatchingRule_caseExactOrderingMatch, []string{"caseExactOrderingMatch"}, caseExact)
+	RegisterMatchingRule(MatchingRule_caseExactSubstringsMatch, []string{"caseExactSubstringsMatch"}, caseExact)
+	RegisterMatchingRule(MatchingRule_caseExactIA5Match, []string{"caseExactIA5Match"}, caseExact)
+	RegisterMatchingRule(MatchingRule_caseExactIA5SubstringsMatch, []string{"caseExactIA5SubstringsMatch"}, caseExact)
+	octetString := stringRule{prepOctetString}
+	RegisterMatchingRule(MatchingRule_octetStringMatch, []string{"octetStringMatch"}, octetString)
+	RegisterMatchingRule(MatchingRule_octetStringOrderingMatch, []string{"octetStringOrderingMatch"}, octetString)
+	RegisterMatchingRule(MatchingRule_octetStringSubstringsMatch, []string{"octetStringSubstringsMatch"}, octetString)
+	numericString := stringRule{prepNumericString}
+	RegisterMatchingRule(MatchingRule_numericStringMatch, []string{"numericStringMatch"}, numericString)
+	RegisterMatchingRule(MatchingRule_numericStringOrderingMatch, []string{"numericStringOrderingMatch"}, numericString)
+	RegisterMatchingRule(MatchingRule_numericStringSubstringsMatch, []string{"numericStringSubstringsMatch"}, numericString)
+	RegisterMatchingRule(MatchingRule_integerMatch, []string{"integerMatch"}, integerRule{})
+	RegisterMatchingRule(MatchingRule_integerOrderingMatch, []string{"integerOrderingMatch"}, integerRule{})
+	RegisterMatchingRule(MatchingRule_booleanMatch, []string{"booleanMatch"}, stringRule{prepBoolean})
+	generalizedTime := stringRule{prepGeneralizedTime}
+	RegisterMatchingRule(MatchingRule_generalizedTimeMatch, []string{"generalizedTimeMatch"}, generalizedTime)
+	RegisterMatchingRule(MatchingRule_generalizedTimeOrderingMatch, []string{"generalizedTimeOrderingMatch"}, generalizedTime)
+	telephoneNumber := stringRule{prepTelephoneNumber}
+	RegisterMatchingRule(MatchingRule_telephoneNumberMatch, []string{"telephoneNumberMatch"}, telephoneNumber)
+	RegisterMatchingRule(MatchingRule_telephoneNumberSubstringsMatch, []string{"telephoneNumberSubstringsMatch"}, telephoneNumber)
+	RegisterMatchingRule(MatchingRule_distinguishedNameMatch, []string{"distinguishedNameMatch"}, stringRule{prepDN})
+	uuid := stringRule{prepUUID}
+	RegisterMatchingRule(MatchingRule_uuidMatch, []string{"uuidMatch"}, uuid)
+	RegisterMatchingRule(MatchingRule_uuidOrderingMatch, []string{"uuidOrderingMatch"}, uuid)
+}
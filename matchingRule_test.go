@@ -0,0 +1,123 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchingRules(t *testing.T) {
+	for _, test := range []struct {
+		rule  string
+		a, b  string
+		equal bool
+	}{
+		{"caseIgnoreMatch", "  Bob\tSMITH ", "bob smith", true},
+		{"caseIgnoreMatch", "Straße", "STRASSE", false},
+		{"caseIgnoreMatch", "soft\u00adhyphen", "SOFTHYPHEN", true},
+		{"caseIgnoreMatch", "no\u00a0break", "no break", true},
+		{"caseIgnoreMatch", "Σος", "σοσ", true},
+		{"caseIgnoreMatch", "caf\u00e9", "CAFE\u0301", true},
+		{"caseIgnoreMatch", "\ufb01le", "FILE", true},
+		{"caseIgnoreMatch", "\u210cello", "hello", true},
+		{"caseIgnoreMatch", "\uff22ob", "bob", true},
+		{"caseExactMatch", "Bob  Smith", " Bob Smith", true},
+		{"caseExactMatch", "Jos\u00e9", "Jose\u0301", true},
+		{"caseExactMatch", "\u2460", "1", true},
+		{"caseExactMatch", "Bob", "bob", false},
+		{"numericStringMatch", "1 234", "1234", true},
+		{"telephoneNumberMatch", "+1 555-1234", "+15551234", true},
+		{"telephoneNumberMatch", "+1 555 1234", "+1 555 1235", false},
+		{"2.5.13.14", "007", "7", true},
+		{"integerMatch", "-0", "0", true},
+		{"generalizedTimeMatch", "20130704153000Z", "201307041730+0200", true},
+		{"distinguishedNameMatch", "CN=Bob  Smith+UID=bob, DC=Example", "uid=BOB+cn=bob smith,dc=example", true},
+		{"distinguishedNameMatch", "cn=a\\,b,dc=example", "cn=a,b=,dc=example", false},
+		{"distinguishedNameMatch", "cn=a,dc=example", "cn=a", false},
+		{"octetStringMatch", "a", "A", false},
+		{"booleanMatch", "TRUE", "FALSE", false},
+		{"uuidMatch", "597AE2F6-16A6-1027-98F4-ABCDEFABCDEF", "597ae2f6-16a6-1027-98f4-abcdefabcdef", true},
+	} {
+		rule := GetMatchingRule(test.rule)
+		if rule == nil {
+			t.Errorf("%s not registered", test.rule)
+			continue
+		}
+		c, err := CompareValues(rule, test.a, test.b)
+		if err != nil {
+			if test.equal {
+				t.Errorf("%s %q %q: %s", test.rule, test.a, test.b, err)
+			}
+			continue
+		}
+		if (c == 0) != test.equal {
+			t.Errorf("%s %q %q: expected equal %t", test.rule, test.a, test.b, test.equal)
+		}
+	}
+
+	for rule, value := range map[string]string{
+		"caseIgnoreMatch":        "private \ue000",
+		"caseExactMatch":         "invalid \xff",
+		"numericStringMatch":     "12a",
+		"telephoneNumberMatch":   "\ufffe",
+		"distinguishedNameMatch": "cn=a,",
+		"booleanMatch":           "yes",
+		"uuidMatch":              "597ae2f6-16a6-1027-98f4abcdefabcdef0",
+	} {
+		if _, err := GetMatchingRule(rule).Normalize(value); err == nil {
+			t.Errorf("%s %q expected an error", rule, value)
+		}
+	}
+}
+
+func TestSetAttributeMatchingRules(t *testing.T) {
+	defer SetAttributeMatchingRules(StandardAttributeMatchingRules())
+	e := NewEntry("cn=x")
+	e.AddAttributeValue("uidNumber", "1000")
+	e.AddAttributeValue("x-count", "0100")
+	rules := map[string]string{"X-Count": MatchingRule_integerMatch}
+	SetAttributeMatchingRules(rules)
+	// copied when set
+	rules["uidnumber"] = MatchingRule_integerMatch
+	if !NewEqualityFilter("x-count", "100").Matches(e) {
+		t.Errorf("rule for x-count not used")
+	}
+	if NewEqualityFilter("uidNumber", "01000").Matches(e) {
+		t.Errorf("integerMatch used for uidNumber after the rules were replaced")
+	}
+	SetAttributeMatchingRules(nil)
+	if AttributeMatchingRules() != nil || NewEqualityFilter("x-count", "100").Matches(e) {
+		t.Errorf("rules not cleared")
+	}
+}
+
+func TestSortValues(t *testing.T) {
+	values := []string{"10", "x", "9", "-1", "y", "010"}
+	SortValues(GetMatchingRule(MatchingRule_integerOrderingMatch), values)
+	if want := []string{"-1", "9", "10", "010", "x", "y"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+	values = []string{"b", "A", "a", "B"}
+	SortValues(GetMatchingRule(MatchingRule_caseIgnoreOrderingMatch), values)
+	if want := []string{"A", "a", "b", "B"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+}
+
+func TestDedupeValues(t *testing.T) {
+	values := []string{"cn=A,dc=com", "CN=a, DC=com", "cn=b,dc=com", "cn=", "cn=", "bad,", "bad,"}
+	deduped := DedupeValues(GetMatchingRule(MatchingRule_distinguishedNameMatch), values)
+	if want := []string{"cn=A,dc=com", "cn=b,dc=com", "cn=", "bad,"}; !reflect.DeepEqual(deduped, want) {
+		t.Errorf("expected %v, got %v", want, deduped)
+	}
+	if deduped := DedupeValues(nil, []string{"a", "A", "a"}); !reflect.DeepEqual(deduped, []string{"a", "A"}) {
+		t.Errorf("unexpected %v", deduped)
+	}
+	if !ValuesEqual(GetMatchingRule(MatchingRule_telephoneNumberMatch), "555 1234", "555-1234") ||
+		ValuesEqual(GetMatchingRule(MatchingRule_integerMatch), "x", "X") {
+		t.Errorf("ValuesEqual")
+	}
+}
@@ -22,6 +22,12 @@ type ModDnRequest struct {
 	DeleteOldDn   bool
 	NewSuperiorDN string
 	Controls      []Control
+	// ResponseControls are set by ModDn from the ModifyDNResponse.
+	ResponseControls []Control
+}
+
+func (req *ModDnRequest) RecordType() uint8 {
+	return ModDnRecord
 }
 
 //Untested.
@@ -38,7 +44,17 @@ func (l *LDAPConnection) ModDn(req *ModDnRequest) error {
 		return err
 	}
 
-	return l.sendReqRespPacket(messageID, packet)
+	req.ResponseControls, err = l.sendReqRespPacket(messageID, packet)
+	if referrals, ok := l.isReferral(err); ok {
+		return l.chaseReferrals(referrals, func(conn *LDAPConnection, lu *LDAPURL) error {
+			referred := *req
+			referred.DN = referralDN(req.DN, lu)
+			err := conn.ModDn(&referred)
+			req.ResponseControls = referred.ResponseControls
+			return err
+		})
+	}
+	return err
 }
 
 func encodeModDnRequest(req *ModDnRequest) (p *ber.Packet) {
@@ -48,8 +64,7 @@ func encodeModDnRequest(req *ModDnRequest) (p *ber.Packet) {
 	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, req.NewRDN, "NewRDN"))
 	p.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimative, ber.TagBoolean, req.DeleteOldDn, "deleteoldrdn"))
 	if len(req.NewSuperiorDN) > 0 {
-		p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative,
-			ber.TagOctetString, req.NewSuperiorDN, "NewSuperiorDN"))
+		p.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimative, 0, req.NewSuperiorDN, "NewSuperiorDN"))
 	}
 	return
 }
@@ -38,6 +38,8 @@ type ModifyRequest struct {
 	DN       string
 	Mods     []Mod
 	Controls []Control
+	// ResponseControls are set by Modify from the ModifyResponse.
+	ResponseControls []Control
 }
 
 func (req *ModifyRequest) RecordType() uint8 {
@@ -82,7 +84,17 @@ func (l *LDAPConnection) Modify(modReq *ModifyRequest) error {
 		return err
 	}
 
-	return l.sendReqRespPacket(messageID, packet)
+	modReq.ResponseControls, err = l.sendReqRespPacket(messageID, packet)
+	if referrals, ok := l.isReferral(err); ok {
+		return l.chaseReferrals(referrals, func(conn *LDAPConnection, lu *LDAPURL) error {
+			referred := *modReq
+			referred.DN = referralDN(modReq.DN, lu)
+			err := conn.Modify(&referred)
+			modReq.ResponseControls = referred.ResponseControls
+			return err
+		})
+	}
+	return err
 }
 
 func (req *ModifyRequest) Bytes() []byte {
@@ -152,6 +164,11 @@ func NewMod(modType uint8, attr string, values []string) (mod *Mod) {
 	return
 }
 
+// NewModBytes - NewMod with binary values.
+func NewModBytes(modType uint8, attr string, values [][]byte) (mod *Mod) {
+	return NewMod(modType, attr, bytesToStrings(values))
+}
+
 func (req *ModifyRequest) AddMod(mod *Mod) {
 	req.Mods = append(req.Mods, *mod)
 }
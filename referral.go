@@ -0,0 +1,303 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains referral and search continuation reference chasing
+package ldap
+
+import (
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const DefaultReferralHopLimit = 10
+
+// ReferralConfig is the policy for following referrals, set it on
+// LDAPConnection.ReferralConfig to enable chasing. When nil (the default)
+// referrals are returned as SearchResult.Referrals and LDAPError.Referrals.
+//
+// Chased operations are sent on a new connection to the referred server
+// using the TlsConfig and timeouts of the original connection.
+type ReferralConfig struct {
+	// HopLimit is the maximum number of referrals followed for one
+	// operation, 0 means DefaultReferralHopLimit.
+	HopLimit int
+	// BindCallback returns the credentials used to bind to the referred
+	// server. If nil, or username is empty, no bind is done (anonymous).
+	BindCallback func(referral *LDAPURL) (username, password string, err error)
+	// IgnoreSearchReferenceErrors - if a search continuation reference can't
+	// be followed, pass it on as a normal referral instead of failing the search.
+	IgnoreSearchReferenceErrors bool
+}
+
+// LDAPURL is a parsed RFC 4516 LDAP URL.
+//
+//	ldap://host:port/dn?attributes?scope?filter
+type LDAPURL struct {
+	Scheme     string // "ldap" or "ldaps"
+	Addr       string // host:port, empty if the URL has no host
+	DN         string
+	Attributes []string
+	Scope      int // -1 if not present
+	Filter     string
+}
+
+// ParseLDAPURL parses an ldap:// or ldaps:// URL.
+func ParseLDAPURL(rawurl string) (*LDAPURL, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, NewLDAPError(ErrorInvalidArgument, "Invalid LDAP URL: "+err.Error())
+	}
+	lu := &LDAPURL{Scheme: strings.ToLower(u.Scheme), Scope: -1}
+	port := "389"
+	switch lu.Scheme {
+	case "ldap":
+	case "ldaps":
+		port = "636"
+	default:
+		return nil, NewLDAPError(ErrorInvalidArgument, "Unsupported LDAP URL scheme: "+rawurl)
+	}
+	if len(u.Host) > 0 {
+		if len(u.Port()) > 0 {
+			port = u.Port()
+		}
+		lu.Addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	lu.DN = strings.TrimPrefix(u.Path, "/")
+
+	if len(u.RawQuery) == 0 {
+		return lu, nil
+	}
+	parts := strings.Split(u.RawQuery, "?")
+	for i, part := range parts {
+		if i > 2 {
+			break // extensions
+		}
+		part, err = url.PathUnescape(part)
+		if err != nil {
+			return nil, NewLDAPError(ErrorInvalidArgument, "Invalid LDAP URL: "+err.Error())
+		}
+		if len(part) == 0 {
+			continue
+		}
+		switch i {
+		case 0:
+			lu.Attributes = strings.Split(part, ",")
+		case 1:
+			switch strings.ToLower(part) {
+			case "base":
+				lu.Scope = ScopeBaseObject
+			case "one":
+				lu.Scope = ScopeSingleLevel
+			case "sub":
+				lu.Scope = ScopeWholeSubtree
+			default:
+				return nil, NewLDAPError(ErrorInvalidArgument, "Invalid LDAP URL scope: "+part)
+			}
+		case 2:
+			lu.Filter = part
+		}
+	}
+	return lu, nil
+}
+
+func (lu *LDAPURL) String() string {
+	u := url.URL{Scheme: lu.Scheme, Host: lu.Addr, Path: "/" + lu.DN}
+	return u.String()
+}
+
+// isReferral returns the referrals of err if it is a referral result and
+// chasing is enabled.
+func (l *LDAPConnection) isReferral(err error) ([]string, bool) {
+	if l.ReferralConfig == nil {
+		return nil, false
+	}
+	lerr, ok := err.(*LDAPError)
+	if !ok || lerr.ResultCode != LDAPResultReferral || len(lerr.Referrals) == 0 {
+		return nil, false
+	}
+	return lerr.Referrals, true
+}
+
+// chaseReferrals calls op with a connection to each referral in turn until
+// one succeeds or returns an LDAP result (not a connection) error.
+func (l *LDAPConnection) chaseReferrals(referrals []string, op func(conn *LDAPConnection, referral *LDAPURL) error) (err error) {
+	for _, referral := range referrals {
+		var conn *LDAPConnection
+		var lu *LDAPURL
+		conn, lu, err = l.referralConnection(referral)
+		if err != nil {
+			if lerr, ok := err.(*LDAPError); ok && lerr.ResultCode != ErrorNetwork {
+				return err
+			}
+			continue
+		}
+		err = op(conn, lu)
+		conn.Close()
+		if lerr, ok := err.(*LDAPError); !ok || lerr.ResultCode != ErrorNetwork {
+			return err
+		}
+	}
+	return err
+}
+
+// referralConnection returns a connected and bound connection for a referral.
+func (l *LDAPConnection) referralConnection(referral string) (*LDAPConnection, *LDAPURL, error) {
+	lu, err := ParseLDAPURL(referral)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(lu.Addr) == 0 {
+		lu.Addr = l.Addr
+	}
+
+	hopLimit := l.ReferralConfig.HopLimit
+	if hopLimit <= 0 {
+		hopLimit = DefaultReferralHopLimit
+	}
+	// the chain starts with the server the operation was sent to, with an
+	// empty DN as a referral back to it without a DN repeats the operation.
+	// Other DNs on the same server are followed, e.g. AD continuation
+	// references to the DomainDnsZones partition of the same DC.
+	chain := l.referralChain
+	if len(chain) == 0 {
+		scheme := "ldap"
+		if l.IsSSL {
+			scheme = "ldaps"
+		}
+		chain = []string{scheme + "://" + strings.ToLower(l.Addr) + "/"}
+	}
+	if len(chain)-1 >= hopLimit {
+		return nil, nil, NewLDAPError(ErrorReferralLimit, "Referral hop limit reached: "+referral)
+	}
+	chainKey := lu.Scheme + "://" + strings.ToLower(lu.Addr) + "/" + strings.ToLower(lu.DN)
+	for _, visited := range chain {
+		if visited == chainKey {
+			return nil, nil, NewLDAPError(LDAPResultLoopDetect, "Referral loop detected: "+referral)
+		}
+	}
+
+	conn := &LDAPConnection{
+		Addr:                        lu.Addr,
+		IsSSL:                       lu.Scheme == "ldaps",
+		IsTLS:                       lu.Scheme == "ldap" && l.IsTLS,
+		Debug:                       l.Debug,
+		NetworkConnectTimeout:       l.NetworkConnectTimeout,
+		ReadTimeout:                 l.ReadTimeout,
+		AbandonMessageOnReadTimeout: l.AbandonMessageOnReadTimeout,
+		ReferralConfig:              l.ReferralConfig,
+		referralChain:               append(append([]string{}, chain...), chainKey),
+	}
+	if conn.IsSSL || conn.IsTLS {
+		if l.TlsConfig != nil {
+			conn.TlsConfig = l.TlsConfig.Clone()
+		} else {
+			conn.TlsConfig = new(tls.Config)
+		}
+		host, _, _ := net.SplitHostPort(lu.Addr)
+		conn.TlsConfig.ServerName = host
+	}
+
+	if err := conn.Connect(); err != nil {
+		conn.Close()
+		if _, ok := err.(*LDAPError); !ok {
+			err = NewLDAPError(ErrorNetwork, "Referral connect failed: "+referral+": "+err.Error())
+		}
+		return nil, nil, err
+	}
+
+	if l.ReferralConfig.BindCallback != nil {
+		username, password, err := l.ReferralConfig.BindCallback(lu)
+		if err == nil && len(username) > 0 {
+			err = conn.Bind(username, password)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, lu, nil
+}
+
+// referralDN returns the DN from the referral if it has one, else dn.
+func referralDN(dn string, lu *LDAPURL) string {
+	if len(lu.DN) > 0 {
+		return lu.DN
+	}
+	return dn
+}
+
+// referralSearchRequest copies searchRequest for a referral or continuation
+// reference. The paging control is removed as its cookie belongs to the
+// original server.
+func referralSearchRequest(searchRequest *SearchRequest, lu *LDAPURL) *SearchRequest {
+	req := *searchRequest
+	req.Controls = make([]Control, 0, len(searchRequest.Controls))
+	for _, c := range searchRequest.Controls {
+		if c.GetControlType() != ControlTypePaging {
+			req.Controls = append(req.Controls, c)
+		}
+	}
+	if len(lu.DN) > 0 {
+		req.BaseDN = lu.DN
+	}
+	if lu.Scope >= 0 {
+		req.Scope = lu.Scope
+	}
+	if len(lu.Filter) > 0 {
+		req.Filter = lu.Filter
+		req.FilterTree = nil
+	}
+	return &req
+}
+
+// chaseSearchReferences follows each continuation reference, entries are
+// passed to resultHandler as they arrive from the referred server. stop is
+// true if resultHandler asked to stop processing.
+func (l *LDAPConnection) chaseSearchReferences(
+	searchRequest *SearchRequest, dsr *DiscreteSearchResult, resultHandler SearchResultHandler, connInfo *ConnectionInfo,
+) (stop bool, err error) {
+	for _, reference := range dsr.Referrals {
+		referred := &referredResultHandler{handler: resultHandler}
+		err := l.chaseReferrals([]string{reference}, func(conn *LDAPConnection, lu *LDAPURL) error {
+			return conn.SearchWithHandler(referralSearchRequest(searchRequest, lu), referred, nil)
+		})
+		if referred.stop {
+			return true, err
+		}
+		if err == nil {
+			continue
+		}
+		if !l.ReferralConfig.IgnoreSearchReferenceErrors {
+			return false, err
+		}
+		unfollowed := &DiscreteSearchResult{
+			SearchResultType: SearchResultReference,
+			Referrals:        []string{reference},
+			Controls:         dsr.Controls,
+		}
+		if stop, err := resultHandler.ProcessDiscreteResult(unfollowed, connInfo); stop || err != nil {
+			return stop, err
+		}
+	}
+	return false, nil
+}
+
+// referredResultHandler passes the results of a search for a continuation
+// reference to handler, except the SearchResultDone, which belongs to the
+// referred server's search not the original one.
+type referredResultHandler struct {
+	handler SearchResultHandler
+	stop    bool
+}
+
+func (h *referredResultHandler) ProcessDiscreteResult(dsr *DiscreteSearchResult, connInfo *ConnectionInfo) (bool, error) {
+	if dsr.SearchResultType == SearchResultDone {
+		return false, nil
+	}
+	stop, err := h.handler.ProcessDiscreteResult(dsr, connInfo)
+	h.stop = h.stop || stop
+	return stop, err
+}
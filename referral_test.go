@@ -0,0 +1,252 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"github.com/mavricknz/asn1-ber"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseLDAPURL(t *testing.T) {
+	lu, err := ParseLDAPURL("ldap://dc1.example.com/ou=people,dc=example,dc=com??one?(cn=a%20b)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lu.Addr != "dc1.example.com:389" || lu.DN != "ou=people,dc=example,dc=com" ||
+		lu.Scope != ScopeSingleLevel || lu.Filter != "(cn=a b)" || lu.Attributes != nil {
+		t.Errorf("unexpected parse %+v", lu)
+	}
+
+	lu, err = ParseLDAPURL("LDAPS://[::1]:1636/dc=example%2cdc=com?cn,mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lu.Scheme != "ldaps" || lu.Addr != "[::1]:1636" || lu.DN != "dc=example,dc=com" ||
+		lu.Scope != -1 || len(lu.Attributes) != 2 {
+		t.Errorf("unexpected parse %+v", lu)
+	}
+
+	if _, err = ParseLDAPURL("http://example.com/"); err == nil {
+		t.Errorf("expected error for http scheme")
+	}
+	if _, err = ParseLDAPURL("ldap://example.com/??subtree"); err == nil {
+		t.Errorf("expected error for invalid scope")
+	}
+}
+
+// referredServer answers searches with one entry per search and modifies
+// with success. The base and scope of the last search are recorded.
+func referredServer(lastSearch *SearchRequest, binds *int) testHandler {
+	return func(request *ber.Packet) []*ber.Packet {
+		switch request.Children[1].Tag {
+		case ApplicationBindRequest:
+			*binds++
+			return []*ber.Packet{testResponse(request, testResult(ApplicationBindResponse, LDAPResultSuccess, ""), nil)}
+		case ApplicationSearchRequest:
+			lastSearch.BaseDN = request.Children[1].Children[0].Value.(string)
+			lastSearch.Scope = int(request.Children[1].Children[1].Value.(uint64))
+			e := NewEntry("cn=b," + lastSearch.BaseDN)
+			e.AddAttributeValue("cn", "b")
+			return []*ber.Packet{
+				testResponse(request, testEntry(e), nil),
+				testResponse(request, testResult(ApplicationSearchResultDone, LDAPResultSuccess, ""), nil),
+			}
+		case ApplicationModifyRequest:
+			return []*ber.Packet{testResponse(request, testResult(ApplicationModifyResponse, LDAPResultSuccess, ""), nil)}
+		}
+		return nil
+	}
+}
+
+func TestSearchContinuationReference(t *testing.T) {
+	lastSearch := new(SearchRequest)
+	binds := 0
+	addr, listener := newTestListener(t, referredServer(lastSearch, &binds))
+	defer listener.Close()
+
+	reference := "ldap://" + addr + "/ou=b,o=example??one"
+	l := newTestConnection(t, func(request *ber.Packet) []*ber.Packet {
+		if request.Children[1].Tag != ApplicationSearchRequest {
+			return nil
+		}
+		e := NewEntry("cn=a,o=example")
+		e.AddAttributeValue("cn", "a")
+		ref := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationSearchResultReference, nil, "Search Result Reference")
+		ref.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, reference, "URI"))
+		return []*ber.Packet{
+			testResponse(request, testEntry(e), nil),
+			testResponse(request, ref, nil),
+			testResponse(request, testResult(ApplicationSearchResultDone, LDAPResultSuccess, ""), nil),
+		}
+	})
+	defer l.Close()
+	l.Addr = "server-a:389"
+
+	req := NewSimpleSearchRequest("o=example", ScopeWholeSubtree, "(cn=*)", nil)
+	sr, err := l.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sr.Entries) != 1 || len(sr.Referrals) != 1 || sr.Referrals[0] != reference {
+		t.Errorf("without chasing expected 1 entry and 1 referral, got %d %v", len(sr.Entries), sr.Referrals)
+	}
+
+	l.ReferralConfig = &ReferralConfig{
+		BindCallback: func(lu *LDAPURL) (string, string, error) {
+			return "cn=admin", "secret", nil
+		},
+	}
+	sr, err = l.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sr.Entries) != 2 || len(sr.Referrals) != 0 {
+		t.Fatalf("with chasing expected 2 entries and no referrals, got %d %v", len(sr.Entries), sr.Referrals)
+	}
+	if sr.Entries[0].Server != "server-a:389" || sr.Entries[1].Server != addr {
+		t.Errorf("entries not annotated with server: %q %q", sr.Entries[0].Server, sr.Entries[1].Server)
+	}
+	if lastSearch.BaseDN != "ou=b,o=example" || lastSearch.Scope != ScopeSingleLevel {
+		t.Errorf("referred search used base %q scope %d", lastSearch.BaseDN, lastSearch.Scope)
+	}
+	if binds != 1 {
+		t.Errorf("expected 1 bind on referred server, got %d", binds)
+	}
+
+	// one SearchResultDone, from the original server
+	handler := &countingResultHandler{}
+	if err := l.SearchWithHandler(req, handler, nil); err != nil {
+		t.Fatal(err)
+	}
+	if handler.entries != 2 || handler.dones != 1 {
+		t.Errorf("expected 2 entries and 1 done, got %d %d", handler.entries, handler.dones)
+	}
+
+	// stopping on the referred entry stops the original search
+	handler = &countingResultHandler{stopAt: 2}
+	if err := l.SearchWithHandler(req, handler, nil); err != nil {
+		t.Fatal(err)
+	}
+	if handler.entries != 2 || handler.dones != 0 {
+		t.Errorf("expected to stop after 2 entries, got %d entries %d dones", handler.entries, handler.dones)
+	}
+}
+
+type countingResultHandler struct {
+	entries, dones int
+	stopAt         int
+}
+
+func (h *countingResultHandler) ProcessDiscreteResult(dsr *DiscreteSearchResult, connInfo *ConnectionInfo) (bool, error) {
+	switch dsr.SearchResultType {
+	case SearchResultEntry:
+		h.entries++
+	case SearchResultDone:
+		h.dones++
+	}
+	return h.entries == h.stopAt, nil
+}
+
+func TestModifyReferral(t *testing.T) {
+	lastSearch := new(SearchRequest)
+	binds := 0
+	addr, listener := newTestListener(t, referredServer(lastSearch, &binds))
+	defer listener.Close()
+
+	l := newTestConnection(t, func(request *ber.Packet) []*ber.Packet {
+		return []*ber.Packet{testResponse(request, testReferralResult(ApplicationModifyResponse, "ldap://"+addr+"/"), nil)}
+	})
+	defer l.Close()
+
+	modReq := NewModifyRequest("cn=b,o=example")
+	modReq.AddMod(NewMod(ModReplace, "sn", []string{"b"}))
+	err := l.Modify(modReq)
+	lerr, ok := err.(*LDAPError)
+	if !ok || lerr.ResultCode != LDAPResultReferral || len(lerr.Referrals) != 1 {
+		t.Fatalf("without chasing expected referral error, got %v", err)
+	}
+
+	l.ReferralConfig = &ReferralConfig{}
+	if err := l.Modify(modReq); err != nil {
+		t.Errorf("referral not followed: %s", err)
+	}
+}
+
+func TestSearchContinuationReferenceSameServer(t *testing.T) {
+	// o=example refers to ou=zones,o=example on the same server, as AD
+	// does for its application partitions
+	var addr string
+	addr, listener := newTestListener(t, func(request *ber.Packet) []*ber.Packet {
+		if request.Children[1].Tag != ApplicationSearchRequest {
+			return nil
+		}
+		base := request.Children[1].Children[0].Value.(string)
+		e := NewEntry("cn=a," + base)
+		e.AddAttributeValue("cn", "a")
+		responses := []*ber.Packet{testResponse(request, testEntry(e), nil)}
+		if base == "o=example" {
+			ref := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationSearchResultReference, nil, "Search Result Reference")
+			ref.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, "ldap://"+addr+"/ou=zones,o=example", "URI"))
+			responses = append(responses, testResponse(request, ref, nil))
+		}
+		return append(responses, testResponse(request, testResult(ApplicationSearchResultDone, LDAPResultSuccess, ""), nil))
+	})
+	defer listener.Close()
+
+	l := NewLDAPConnection("127.0.0.1", 0)
+	l.Addr = addr
+	if err := l.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.ReferralConfig = &ReferralConfig{}
+	sr, err := l.Search(NewSimpleSearchRequest("o=example", ScopeWholeSubtree, "(cn=*)", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sr.Entries) != 2 || sr.Entries[1].DN != "cn=a,ou=zones,o=example" {
+		t.Errorf("reference to the same server not followed: %d entries", len(sr.Entries))
+	}
+}
+
+func TestReferralLoop(t *testing.T) {
+	// a refers to b, b back to a
+	var addrA, addrB string
+	var requestsA int32
+	addrA, listenerA := newTestListener(t, func(request *ber.Packet) []*ber.Packet {
+		atomic.AddInt32(&requestsA, 1)
+		return []*ber.Packet{testResponse(request, testReferralResult(ApplicationDelResponse, "ldap://"+addrB+"/"), nil)}
+	})
+	defer listenerA.Close()
+	addrB, listenerB := newTestListener(t, func(request *ber.Packet) []*ber.Packet {
+		return []*ber.Packet{testResponse(request, testReferralResult(ApplicationDelResponse, "ldap://"+addrA+"/"), nil)}
+	})
+	defer listenerB.Close()
+
+	l := NewLDAPConnection("127.0.0.1", 0)
+	l.Addr = addrA
+	if err := l.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.ReferralConfig = &ReferralConfig{}
+	err := l.Delete(NewDeleteRequest("cn=b,o=example"))
+	if lerr, ok := err.(*LDAPError); !ok || lerr.ResultCode != LDAPResultLoopDetect {
+		t.Errorf("expected loop detect, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requestsA); n != 1 {
+		t.Errorf("loop detected after %d requests to the origin server", n)
+	}
+
+	l.ReferralConfig = &ReferralConfig{HopLimit: 1}
+	l.referralChain = []string{"ldap://" + addrA + "/", "ldap://other:389/"}
+	err = l.Delete(NewDeleteRequest("cn=b,o=example"))
+	if lerr, ok := err.(*LDAPError); !ok || lerr.ResultCode != ErrorReferralLimit {
+		t.Errorf("expected referral limit, got %v", err)
+	}
+}
@@ -30,7 +30,10 @@ func requestBuildPacket(messageID uint64, opPacket *ber.Packet, controls []Contr
 	return
 }
 
-func (l *LDAPConnection) sendReqRespPacket(messageID uint64, packet *ber.Packet) error {
+// sendReqRespPacket sends a request and waits for its single response.
+// Returns any controls decoded from the response, along with an error if the
+// result code was not success.
+func (l *LDAPConnection) sendReqRespPacket(messageID uint64, packet *ber.Packet) ([]Control, error) {
 
 	if l.Debug {
 		ber.PrintPacket(packet)
@@ -39,11 +42,11 @@ func (l *LDAPConnection) sendReqRespPacket(messageID uint64, packet *ber.Packet)
 	channel, err := l.sendMessage(packet)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if channel == nil {
-		return NewLDAPError(ErrorNetwork, "Could not send message")
+		return nil, NewLDAPError(ErrorNetwork, "Could not send message")
 	}
 
 	defer l.finishMessage(messageID)
@@ -62,17 +65,17 @@ func (l *LDAPConnection) sendReqRespPacket(messageID uint64, packet *ber.Packet)
 	select {
 	case responsePacket, ok = <-channel:
 		if !ok {
-			return NewLDAPError(ErrorClosing, "Response Channel Closed")
+			return nil, NewLDAPError(ErrorClosing, "Response Channel Closed")
 		}
 	case <-time.After(timeout):
 		if l.AbandonMessageOnReadTimeout {
 			err = l.Abandon(messageID)
 			if err != nil {
-				return NewLDAPError(ErrorNetwork,
+				return nil, NewLDAPError(ErrorNetwork,
 					"Timeout waiting for Message and error on Abandon")
 			}
 		}
-		return NewLDAPError(ErrorNetwork, "Timeout waiting for Message")
+		return nil, NewLDAPError(ErrorNetwork, "Timeout waiting for Message")
 	}
 
 	if l.Debug {
@@ -80,24 +83,27 @@ func (l *LDAPConnection) sendReqRespPacket(messageID uint64, packet *ber.Packet)
 	}
 
 	if responsePacket == nil {
-		return NewLDAPError(ErrorNetwork, "Could not retrieve message")
+		return nil, NewLDAPError(ErrorNetwork, "Could not retrieve message")
 	}
 
 	if l.Debug {
 		if err := addLDAPDescriptions(responsePacket); err != nil {
-			return err
+			return nil, err
 		}
 		ber.PrintPacket(responsePacket)
 	}
 
-	result_code, result_description := getLDAPResultCode(responsePacket)
+	controls, err := decodeResponseControls(responsePacket)
+	if err != nil {
+		return nil, err
+	}
 
-	if result_code != 0 {
-		return NewLDAPError(result_code, result_description)
+	if err := getLDAPResultError(responsePacket); err != nil {
+		return controls, err
 	}
 
 	if l.Debug {
 		fmt.Printf("%d: returning\n", messageID)
 	}
-	return nil
+	return controls, nil
 }
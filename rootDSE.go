@@ -0,0 +1,159 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains the root DSE and server capability discovery, RFC 4512 5.1
+package ldap
+
+import (
+	"strconv"
+)
+
+// Extended operation OIDs
+const (
+	ExtensionStartTLS        = "1.3.6.1.4.1.1466.20037"
+	ExtensionPasswordModify  = "1.3.6.1.4.1.4203.1.11.1"
+	ExtensionWhoAmI          = "1.3.6.1.4.1.4203.1.11.3"
+	ExtensionCancel          = "1.3.6.1.1.8"
+	FeatureAllOperational    = "1.3.6.1.4.1.4203.1.5.1" // RFC 3673
+	FeatureAbsoluteTrueFalse = "1.3.6.1.4.1.4203.1.5.3" // RFC 4526, (&) and (|) filters
+)
+
+// RootDSEAttributes are the attributes read by GetRootDSE.
+var RootDSEAttributes = []string{
+	"namingContexts", "supportedControl", "supportedExtension",
+	"supportedFeatures", "supportedSASLMechanisms", "supportedLDAPVersion",
+	"vendorName", "vendorVersion", "subschemaSubentry",
+	// Active Directory
+	"defaultNamingContext",
+}
+
+// RootDSE - the server information in the root DSE.
+type RootDSE struct {
+	NamingContexts          []string
+	SupportedControls       []string
+	SupportedExtensions     []string
+	SupportedFeatures       []string
+	SupportedSASLMechanisms []string
+	SupportedLDAPVersions   []int
+	VendorName              string
+	VendorVersion           string
+	SubschemaSubentry       string
+	// DefaultNamingContext is only set by Active Directory.
+	DefaultNamingContext string
+	// Entry is the root DSE as read, for other attributes.
+	Entry *Entry
+}
+
+// NewRootDSE returns the RootDSE for the root DSE entry.
+func NewRootDSE(entry *Entry) *RootDSE {
+	r := &RootDSE{
+		NamingContexts:          entry.GetAttributeValues("namingContexts"),
+		SupportedControls:       entry.GetAttributeValues("supportedControl"),
+		SupportedExtensions:     entry.GetAttributeValues("supportedExtension"),
+		SupportedFeatures:       entry.GetAttributeValues("supportedFeatures"),
+		SupportedSASLMechanisms: entry.GetAttributeValues("supportedSASLMechanisms"),
+		VendorName:              firstValue(entry, "vendorName"),
+		VendorVersion:           firstValue(entry, "vendorVersion"),
+		SubschemaSubentry:       firstValue(entry, "subschemaSubentry"),
+		DefaultNamingContext:    firstValue(entry, "defaultNamingContext"),
+		Entry:                   entry,
+	}
+	for _, value := range entry.GetAttributeValues("supportedLDAPVersion") {
+		if version, err := strconv.Atoi(value); err == nil {
+			r.SupportedLDAPVersions = append(r.SupportedLDAPVersions, version)
+		}
+	}
+	return r
+}
+
+func firstValue(entry *Entry, attributeName string) string {
+	if values := entry.GetAttributeValues(attributeName); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// SupportsControl is true if the control OID is in supportedControl.
+func (r *RootDSE) SupportsControl(oid string) bool {
+	return containsOID(r.SupportedControls, oid)
+}
+
+// SupportsExtension is true if the extended operation OID is in
+// supportedExtension.
+func (r *RootDSE) SupportsExtension(oid string) bool {
+	return containsOID(r.SupportedExtensions, oid)
+}
+
+// SupportsFeature is true if the feature OID is in supportedFeatures.
+func (r *RootDSE) SupportsFeature(oid string) bool {
+	return containsOID(r.SupportedFeatures, oid)
+}
+
+// SupportsLDAPVersion is true if version is in supportedLDAPVersion.
+func (r *RootDSE) SupportsLDAPVersion(version int) bool {
+	for _, v := range r.SupportedLDAPVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func containsOID(oids []string, oid string) bool {
+	for _, o := range oids {
+		if o == oid {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRootDSE reads the root DSE with a base search of "". The result is
+// kept, later calls and the Supports methods use it without searching
+// again until the next Bind or StartTLS.
+func (l *LDAPConnection) GetRootDSE() (*RootDSE, error) {
+	l.rootDSELock.Lock()
+	defer l.rootDSELock.Unlock()
+	if l.rootDSE != nil {
+		return l.rootDSE, nil
+	}
+	req := NewSimpleSearchRequest("", ScopeBaseObject, "(objectClass=*)", RootDSEAttributes)
+	sr, err := l.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.Entries) == 0 {
+		return nil, NewLDAPError(LDAPResultNoSuchObject, "No root DSE returned")
+	}
+	l.rootDSE = NewRootDSE(sr.Entries[0])
+	return l.rootDSE, nil
+}
+
+// resetRootDSE drops the kept root DSE, after a Bind or StartTLS the server
+// may show more of it.
+func (l *LDAPConnection) resetRootDSE() {
+	l.rootDSELock.Lock()
+	l.rootDSE = nil
+	l.rootDSELock.Unlock()
+}
+
+// SupportsControl is true if the server lists the control OID in the root
+// DSE, see GetRootDSE.
+func (l *LDAPConnection) SupportsControl(oid string) (bool, error) {
+	r, err := l.GetRootDSE()
+	if err != nil {
+		return false, err
+	}
+	return r.SupportsControl(oid), nil
+}
+
+// SupportsExtension is true if the server lists the extended operation OID
+// in the root DSE, see GetRootDSE.
+func (l *LDAPConnection) SupportsExtension(oid string) (bool, error) {
+	r, err := l.GetRootDSE()
+	if err != nil {
+		return false, err
+	}
+	return r.SupportsExtension(oid), nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"github.com/mavricknz/asn1-ber"
+	"reflect"
+	"testing"
+)
+
+func testRootDSE(supportedControls ...string) *Entry {
+	e := NewEntry("")
+	e.AddAttributeValues("objectClass", []string{"top", "OpenLDAProotDSE"})
+	e.AddAttributeValues("namingContexts", []string{"dc=example,dc=com", "o=other"})
+	e.AddAttributeValues("supportedControl", supportedControls)
+	e.AddAttributeValues("supportedExtension", []string{ExtensionStartTLS, ExtensionWhoAmI})
+	e.AddAttributeValues("supportedFeatures", []string{FeatureAbsoluteTrueFalse})
+	e.AddAttributeValues("supportedSASLMechanisms", []string{"EXTERNAL", "GSSAPI"})
+	e.AddAttributeValues("supportedLDAPVersion", []string{"3"})
+	e.AddAttributeValues("vendorName", []string{"Example"})
+	e.AddAttributeValues("vendorVersion", []string{"1.0"})
+	e.AddAttributeValues("subschemaSubentry", []string{"cn=Subschema"})
+	return e
+}
+
+// rootDSEServer answers root DSE searches with rootDSE, and other searches
+// with one entry, recording whether they had a paging control. Binds
+// succeed.
+func rootDSEServer(rootDSE *Entry, rootSearches *int, paged *[]bool) testHandler {
+	return func(request *ber.Packet) []*ber.Packet {
+		if request.Children[1].Tag == ApplicationBindRequest {
+			return []*ber.Packet{testResponse(request, testResult(ApplicationBindResponse, LDAPResultSuccess, ""), nil)}
+		}
+		if request.Children[1].Tag != ApplicationSearchRequest {
+			return nil
+		}
+		done := testResult(ApplicationSearchResultDone, LDAPResultSuccess, "")
+		if request.Children[1].Children[0].Value.(string) == "" {
+			*rootSearches++
+			return []*ber.Packet{testResponse(request, testEntry(rootDSE), nil), testResponse(request, done, nil)}
+		}
+		hasPaging := false
+		for _, c := range testRequestControls(request) {
+			if _, err := NewControlPagingFromPacket(c); err == nil {
+				hasPaging = true
+			}
+		}
+		*paged = append(*paged, hasPaging)
+		e := NewEntry("cn=x,dc=example,dc=com")
+		e.AddAttributeValue("cn", "x")
+		var controls []Control
+		if hasPaging {
+			controls = []Control{&ControlPaging{}}
+		}
+		return []*ber.Packet{testResponse(request, testEntry(e), nil), testResponse(request, done, controls)}
+	}
+}
+
+func TestNewRootDSE(t *testing.T) {
+	r := NewRootDSE(testRootDSE(ControlTypePaging))
+	if !reflect.DeepEqual(r.NamingContexts, []string{"dc=example,dc=com", "o=other"}) ||
+		!reflect.DeepEqual(r.SupportedSASLMechanisms, []string{"EXTERNAL", "GSSAPI"}) ||
+		r.VendorName != "Example" || r.VendorVersion != "1.0" || r.SubschemaSubentry != "cn=Subschema" ||
+		r.DefaultNamingContext != "" {
+		t.Errorf("unexpected %+v", r)
+	}
+	if !r.SupportsControl(ControlTypePaging) || r.SupportsControl(ControlTypeVlvRequest) {
+		t.Errorf("SupportsControl")
+	}
+	if !r.SupportsExtension(ExtensionWhoAmI) || r.SupportsExtension(ExtensionPasswordModify) {
+		t.Errorf("SupportsExtension")
+	}
+	if !r.SupportsFeature(FeatureAbsoluteTrueFalse) || r.SupportsFeature(FeatureAllOperational) {
+		t.Errorf("SupportsFeature")
+	}
+	if !r.SupportsLDAPVersion(3) || r.SupportsLDAPVersion(2) {
+		t.Errorf("SupportsLDAPVersion")
+	}
+}
+
+func TestGetRootDSE(t *testing.T) {
+	rootSearches := 0
+	paged := make([]bool, 0)
+	l := newTestConnection(t, rootDSEServer(testRootDSE(ControlTypeServerSideSortRequest), &rootSearches, &paged))
+	defer l.Close()
+
+	r, err := l.GetRootDSE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.VendorName != "Example" {
+		t.Errorf("unexpected %+v", r)
+	}
+	if supported, err := l.SupportsControl(ControlTypeServerSideSortRequest); !supported || err != nil {
+		t.Errorf("expected sort supported, %v", err)
+	}
+	if supported, err := l.SupportsExtension(ExtensionPasswordModify); supported || err != nil {
+		t.Errorf("expected password modify unsupported, %v", err)
+	}
+	if rootSearches != 1 {
+		t.Errorf("expected the root DSE to be read once, read %d times", rootSearches)
+	}
+	// read again after a bind
+	if err := l.Bind("cn=admin", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.GetRootDSE(); err != nil {
+		t.Fatal(err)
+	}
+	if rootSearches != 2 {
+		t.Errorf("expected the root DSE to be read again after a bind, read %d times", rootSearches)
+	}
+}
+
+func TestSearchWithPagingUnsupported(t *testing.T) {
+	for _, test := range []struct {
+		controls []string
+		paged    bool
+	}{
+		{[]string{ControlTypeServerSideSortRequest, ControlTypePaging}, true},
+		{[]string{ControlTypeServerSideSortRequest}, false},
+		// supportedControl hidden, support unknown
+		{nil, true},
+	} {
+		rootSearches := 0
+		paged := make([]bool, 0)
+		l := newTestConnection(t, rootDSEServer(testRootDSE(test.controls...), &rootSearches, &paged))
+		req := NewSimpleSearchRequest("dc=example,dc=com", ScopeWholeSubtree, "(cn=*)", nil)
+		sr, err := l.SearchWithPaging(req, 10)
+		l.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sr.Entries) != 1 || !reflect.DeepEqual(paged, []bool{test.paged}) {
+			t.Errorf("supportedControl %v: %d entries, requests paged %v", test.controls, len(sr.Entries), paged)
+		}
+	}
+}
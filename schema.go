@@ -0,0 +1,588 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains retrieval and parsing of the subschema subentry, RFC 4512
+package ldap
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Object class kinds
+const (
+	ObjectClassStructural = "STRUCTURAL"
+	ObjectClassAbstract   = "ABSTRACT"
+	ObjectClassAuxiliary  = "AUXILIARY"
+)
+
+// Attribute type usages
+const (
+	AttributeUsageUserApplications     = "userApplications"
+	AttributeUsageDirectoryOperation   = "directoryOperation"
+	AttributeUsageDistributedOperation = "distributedOperation"
+	AttributeUsageDSAOperation         = "dSAOperation"
+)
+
+// Subschema subentry attributes, see GetSchema.
+var SchemaAttributes = []string{
+	"attributeTypes", "objectClasses", "matchingRules", "ldapSyntaxes",
+	"matchingRuleUse", "dITContentRules", "nameForms",
+}
+
+// SchemaElement holds the fields common to all schema definitions.
+type SchemaElement struct {
+	OID         string
+	Names       []string
+	Description string
+	Obsolete    bool
+	// Extensions e.g. X-ORIGIN, by upper case keyword
+	Extensions map[string][]string
+	// Raw is the definition as returned by the server
+	Raw string
+}
+
+// Name - the first name, the OID if there are none.
+func (e *SchemaElement) Name() string {
+	if len(e.Names) > 0 {
+		return e.Names[0]
+	}
+	return e.OID
+}
+
+// HasName is true for the OID or any of the names, ignoring case.
+func (e *SchemaElement) HasName(oidOrName string) bool {
+	if e.OID == oidOrName {
+		return true
+	}
+	for _, name := range e.Names {
+		if strings.EqualFold(name, oidOrName) {
+			return true
+		}
+	}
+	return false
+}
+
+// AttributeTypeDefinition - RFC 4512 4.1.2. Equality, Ordering, Substring
+// and Syntax are inherited from the superior type when not set.
+type AttributeTypeDefinition struct {
+	SchemaElement
+	Superior           string
+	Equality           string
+	Ordering           string
+	Substring          string
+	Syntax             string
+	SyntaxLength       int // the {len} of the syntax, 0 if not set
+	SingleValue        bool
+	Collective         bool
+	NoUserModification bool
+	Usage              string
+	// SuperiorType is set by schema resolution, nil if there is no SUP or
+	// it is not in the schema.
+	SuperiorType *AttributeTypeDefinition
+}
+
+// IsOperational is true for types with a usage other than
+// userApplications.
+func (a *AttributeTypeDefinition) IsOperational() bool {
+	return a.Usage != AttributeUsageUserApplications
+}
+
+// ObjectClassDefinition - RFC 4512 4.1.1.
+type ObjectClassDefinition struct {
+	SchemaElement
+	Superiors []string
+	Kind      string // ObjectClassStructural, ObjectClassAbstract or ObjectClassAuxiliary
+	Must      []string
+	May       []string
+	// Set by schema resolution: the superior classes found in the schema,
+	// and Must and May including those of all superior classes.
+	SuperiorClasses []*ObjectClassDefinition
+	AllMust         []string
+	AllMay          []string
+}
+
+// MatchingRuleDefinition - RFC 4512 4.1.3.
+type MatchingRuleDefinition struct {
+	SchemaElement
+	Syntax string
+}
+
+// MatchingRuleUseDefinition - RFC 4512 4.1.4, the OID is of the matching
+// rule.
+type MatchingRuleUseDefinition struct {
+	SchemaElement
+	Applies []string
+}
+
+// SyntaxDefinition - RFC 4512 4.1.5, syntaxes have no names.
+type SyntaxDefinition struct {
+	SchemaElement
+}
+
+// DITContentRuleDefinition - RFC 4512 4.1.6, the OID is of the structural
+// object class.
+type DITContentRuleDefinition struct {
+	SchemaElement
+	Auxiliary []string
+	Must      []string
+	May       []string
+	Not       []string
+}
+
+// NameFormDefinition - RFC 4512 4.1.7.
+type NameFormDefinition struct {
+	SchemaElement
+	ObjectClass string
+	Must        []string
+	May         []string
+}
+
+// Schema is the parsed content of a subschema subentry.
+type Schema struct {
+	DN               string
+	AttributeTypes   []*AttributeTypeDefinition
+	ObjectClasses    []*ObjectClassDefinition
+	MatchingRules    []*MatchingRuleDefinition
+	MatchingRuleUses []*MatchingRuleUseDefinition
+	Syntaxes         []*SyntaxDefinition
+	DITContentRules  []*DITContentRuleDefinition
+	NameForms        []*NameFormDefinition
+
+	// lower case OIDs and names to definitions
+	attributeTypes map[string]*AttributeTypeDefinition
+	objectClasses  map[string]*ObjectClassDefinition
+	matchingRules  map[string]*MatchingRuleDefinition
+	syntaxes       map[string]*SyntaxDefinition
+}
+
+// GetSubschemaSubentry returns the DN of the subschema subentry governing
+// dn, from its subschemaSubentry attribute. An empty dn reads the root DSE.
+func (l *LDAPConnection) GetSubschemaSubentry(dn string) (string, error) {
+	req := NewSimpleSearchRequest(dn, ScopeBaseObject, "(objectClass=*)", []string{"subschemaSubentry"})
+	sr, err := l.Search(req)
+	if err != nil {
+		return "", err
+	}
+	if len(sr.Entries) == 0 {
+		return "", NewLDAPError(LDAPResultNoSuchObject, "No entry for "+dn)
+	}
+	values := sr.Entries[0].GetAttributeValues("subschemaSubentry")
+	if len(values) == 0 {
+		return "", NewLDAPError(LDAPResultNoSuchAttribute, "No subschemaSubentry for "+dn)
+	}
+	return values[0], nil
+}
+
+// GetSchema reads and parses the schema governing dn, an empty dn gives the
+// schema of the root DSE.
+func (l *LDAPConnection) GetSchema(dn string) (*Schema, error) {
+	subschemaDN, err := l.GetSubschemaSubentry(dn)
+	if err != nil {
+		return nil, err
+	}
+	req := NewSimpleSearchRequest(subschemaDN, ScopeBaseObject, "(objectClass=subschema)", SchemaAttributes)
+	sr, err := l.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.Entries) == 0 {
+		return nil, NewLDAPError(LDAPResultNoSuchObject, "No subschema entry "+subschemaDN)
+	}
+	return ParseSchema(sr.Entries[0])
+}
+
+// ParseSchema parses the definitions in a subschema subentry and resolves
+// superior attribute types and object classes.
+func ParseSchema(entry *Entry) (*Schema, error) {
+	s := &Schema{DN: entry.DN}
+	for _, attr := range SchemaAttributes {
+		for _, value := range entry.GetAttributeValues(attr) {
+			d, err := parseSchemaDescription(value)
+			if err != nil {
+				return nil, NewLDAPError(ErrorDecoding, "Invalid "+attr+" definition: "+err.Error())
+			}
+			switch attr {
+			case "attributeTypes":
+				s.AttributeTypes = append(s.AttributeTypes, d.attributeType())
+			case "objectClasses":
+				s.ObjectClasses = append(s.ObjectClasses, d.objectClass())
+			case "matchingRules":
+				s.MatchingRules = append(s.MatchingRules, &MatchingRuleDefinition{SchemaElement: d.element(), Syntax: d.value("SYNTAX")})
+			case "ldapSyntaxes":
+				s.Syntaxes = append(s.Syntaxes, &SyntaxDefinition{SchemaElement: d.element()})
+			case "matchingRuleUse":
+				s.MatchingRuleUses = append(s.MatchingRuleUses, &MatchingRuleUseDefinition{SchemaElement: d.element(), Applies: d.values["APPLIES"]})
+			case "dITContentRules":
+				s.DITContentRules = append(s.DITContentRules, &DITContentRuleDefinition{
+					SchemaElement: d.element(),
+					Auxiliary:     d.values["AUX"],
+					Must:          d.values["MUST"],
+					May:           d.values["MAY"],
+					Not:           d.values["NOT"],
+				})
+			case "nameForms":
+				s.NameForms = append(s.NameForms, &NameFormDefinition{
+					SchemaElement: d.element(),
+					ObjectClass:   d.value("OC"),
+					Must:          d.values["MUST"],
+					May:           d.values["MAY"],
+				})
+			}
+		}
+	}
+	s.resolve()
+	return s, nil
+}
+
+// AttributeType by OID or name, nil if not found.
+func (s *Schema) AttributeType(oidOrName string) *AttributeTypeDefinition {
+	return s.attributeTypes[strings.ToLower(oidOrName)]
+}
+
+// ObjectClass by OID or name, nil if not found.
+func (s *Schema) ObjectClass(oidOrName string) *ObjectClassDefinition {
+	return s.objectClasses[strings.ToLower(oidOrName)]
+}
+
+// MatchingRule by OID or name, nil if not found.
+func (s *Schema) MatchingRule(oidOrName string) *MatchingRuleDefinition {
+	return s.matchingRules[strings.ToLower(oidOrName)]
+}
+
+// Syntax by OID, nil if not found.
+func (s *Schema) Syntax(oid string) *SyntaxDefinition {
+	return s.syntaxes[strings.ToLower(oid)]
+}
+
+// AttributeAliases returns the names and OIDs of all attribute types, e.g.
+// for SetDefaultAttributeAliases.
+func (s *Schema) AttributeAliases() AttributeAliases {
+	aa := make(AttributeAliases)
+	for _, at := range s.AttributeTypes {
+		aa.Add(append([]string{at.OID}, at.Names...)...)
+	}
+	return aa
+}
+
+// AttributeMatchingRules returns the equality matching rule OID of each
+// attribute type by lower case name and OID, for SetAttributeMatchingRules.
+func (s *Schema) AttributeMatchingRules() map[string]string {
+	rules := make(map[string]string)
+	for _, at := range s.AttributeTypes {
+		if len(at.Equality) == 0 {
+			continue
+		}
+		oid := at.Equality
+		if mr := s.MatchingRule(oid); mr != nil {
+			oid = mr.OID
+		}
+		rules[strings.ToLower(at.OID)] = oid
+		for _, name := range at.Names {
+			rules[strings.ToLower(name)] = oid
+		}
+	}
+	return rules
+}
+
+func (s *Schema) resolve() {
+	s.attributeTypes = make(map[string]*AttributeTypeDefinition)
+	for _, at := range s.AttributeTypes {
+		s.attributeTypes[strings.ToLower(at.OID)] = at
+		for _, name := range at.Names {
+			s.attributeTypes[strings.ToLower(name)] = at
+		}
+	}
+	s.objectClasses = make(map[string]*ObjectClassDefinition)
+	for _, oc := range s.ObjectClasses {
+		s.objectClasses[strings.ToLower(oc.OID)] = oc
+		for _, name := range oc.Names {
+			s.objectClasses[strings.ToLower(name)] = oc
+		}
+	}
+	s.matchingRules = make(map[string]*MatchingRuleDefinition)
+	for _, mr := range s.MatchingRules {
+		s.matchingRules[strings.ToLower(mr.OID)] = mr
+		for _, name := range mr.Names {
+			s.matchingRules[strings.ToLower(name)] = mr
+		}
+	}
+	s.syntaxes = make(map[string]*SyntaxDefinition)
+	for _, syntax := range s.Syntaxes {
+		s.syntaxes[strings.ToLower(syntax.OID)] = syntax
+	}
+
+	for _, at := range s.AttributeTypes {
+		if len(at.Superior) > 0 {
+			at.SuperiorType = s.AttributeType(at.Superior)
+		}
+	}
+	for _, at := range s.AttributeTypes {
+		// the chain may be defined in any order and may loop
+		seen := map[*AttributeTypeDefinition]bool{at: true}
+		for sup := at.SuperiorType; sup != nil && !seen[sup]; sup = sup.SuperiorType {
+			seen[sup] = true
+			if len(at.Equality) == 0 {
+				at.Equality = sup.Equality
+			}
+			if len(at.Ordering) == 0 {
+				at.Ordering = sup.Ordering
+			}
+			if len(at.Substring) == 0 {
+				at.Substring = sup.Substring
+			}
+			if len(at.Syntax) == 0 {
+				at.Syntax, at.SyntaxLength = sup.Syntax, sup.SyntaxLength
+			}
+		}
+	}
+
+	for _, oc := range s.ObjectClasses {
+		oc.SuperiorClasses = nil
+		for _, name := range oc.Superiors {
+			if sup := s.ObjectClass(name); sup != nil {
+				oc.SuperiorClasses = append(oc.SuperiorClasses, sup)
+			}
+		}
+	}
+	for _, oc := range s.ObjectClasses {
+		oc.AllMust, oc.AllMay = nil, nil
+		mustSeen, maySeen := make(map[string]bool), make(map[string]bool)
+		var collect func(c *ObjectClassDefinition, visited map[*ObjectClassDefinition]bool)
+		collect = func(c *ObjectClassDefinition, visited map[*ObjectClassDefinition]bool) {
+			if visited[c] {
+				return
+			}
+			visited[c] = true
+			for _, name := range c.Must {
+				if key := s.attributeKey(name); !mustSeen[key] {
+					mustSeen[key] = true
+					oc.AllMust = append(oc.AllMust, name)
+				}
+			}
+			for _, name := range c.May {
+				if key := s.attributeKey(name); !maySeen[key] {
+					maySeen[key] = true
+					oc.AllMay = append(oc.AllMay, name)
+				}
+			}
+			for _, sup := range c.SuperiorClasses {
+				collect(sup, visited)
+			}
+		}
+		collect(oc, make(map[*ObjectClassDefinition]bool))
+	}
+}
+
+// attributeKey - the OID of an attribute type name if known, so names and
+// OIDs of the same type compare equal.
+func (s *Schema) attributeKey(name string) string {
+	if at := s.AttributeType(name); at != nil {
+		return at.OID
+	}
+	return strings.ToLower(name)
+}
+
+// schemaDescription is a parsed RFC 4512 definition before it is converted
+// to one of the Definition types.
+type schemaDescription struct {
+	raw    string
+	oid    string
+	values map[string][]string // keyword to values
+	flags  map[string]bool     // keywords without values e.g. SINGLE-VALUE
+}
+
+// keywords that are not followed by a value
+var schemaFlagKeywords = map[string]bool{
+	"OBSOLETE": true, "SINGLE-VALUE": true, "COLLECTIVE": true,
+	"NO-USER-MODIFICATION": true, "ABSTRACT": true, "STRUCTURAL": true,
+	"AUXILIARY": true,
+}
+
+func (d *schemaDescription) value(keyword string) string {
+	if values := d.values[keyword]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (d *schemaDescription) element() SchemaElement {
+	e := SchemaElement{
+		OID:         d.oid,
+		Names:       d.values["NAME"],
+		Description: d.value("DESC"),
+		Obsolete:    d.flags["OBSOLETE"],
+		Raw:         d.raw,
+	}
+	for keyword, values := range d.values {
+		if strings.HasPrefix(keyword, "X-") {
+			if e.Extensions == nil {
+				e.Extensions = make(map[string][]string)
+			}
+			e.Extensions[keyword] = values
+		}
+	}
+	return e
+}
+
+func (d *schemaDescription) attributeType() *AttributeTypeDefinition {
+	at := &AttributeTypeDefinition{
+		SchemaElement:      d.element(),
+		Superior:           d.value("SUP"),
+		Equality:           d.value("EQUALITY"),
+		Ordering:           d.value("ORDERING"),
+		Substring:          d.value("SUBSTR"),
+		Syntax:             d.value("SYNTAX"),
+		SingleValue:        d.flags["SINGLE-VALUE"],
+		Collective:         d.flags["COLLECTIVE"],
+		NoUserModification: d.flags["NO-USER-MODIFICATION"],
+		Usage:              d.value("USAGE"),
+	}
+	if i := strings.IndexByte(at.Syntax, '{'); i >= 0 {
+		at.SyntaxLength, _ = strconv.Atoi(strings.TrimSuffix(at.Syntax[i+1:], "}"))
+		at.Syntax = at.Syntax[:i]
+	}
+	if len(at.Usage) == 0 {
+		at.Usage = AttributeUsageUserApplications
+	}
+	return at
+}
+
+func (d *schemaDescription) objectClass() *ObjectClassDefinition {
+	oc := &ObjectClassDefinition{
+		SchemaElement: d.element(),
+		Superiors:     d.values["SUP"],
+		Kind:          ObjectClassStructural,
+		Must:          d.values["MUST"],
+		May:           d.values["MAY"],
+	}
+	switch {
+	case d.flags[ObjectClassAbstract]:
+		oc.Kind = ObjectClassAbstract
+	case d.flags[ObjectClassAuxiliary]:
+		oc.Kind = ObjectClassAuxiliary
+	}
+	return oc
+}
+
+// parseSchemaDescription parses the generic form of RFC 4512 definitions
+//
+//	LPAREN WSP numericoid *(SP keyword [SP value]) WSP RPAREN
+//
+// where a value is a word, a quoted string, or a list in parentheses of
+// words separated by $ or quoted strings. Quoted OIDs and names, which some
+// servers return, are accepted.
+func parseSchemaDescription(raw string) (*schemaDescription, error) {
+	tokens, err := tokenizeSchemaDescription(raw)
+	if err != nil {
+		return nil, err
+	}
+	invalid := NewLDAPError(ErrorDecoding, raw)
+	if len(tokens) < 3 || tokens[0] != "(" || tokens[len(tokens)-1] != ")" || isSchemaPunctuation(tokens[1]) {
+		return nil, invalid
+	}
+	d := &schemaDescription{
+		raw:    raw,
+		oid:    unquoteSchemaToken(tokens[1]),
+		values: make(map[string][]string),
+		flags:  make(map[string]bool),
+	}
+	tokens = tokens[2 : len(tokens)-1]
+	for len(tokens) > 0 {
+		keyword := strings.ToUpper(tokens[0])
+		tokens = tokens[1:]
+		if isSchemaPunctuation(keyword) || strings.HasPrefix(keyword, "'") {
+			return nil, invalid
+		}
+		if schemaFlagKeywords[keyword] {
+			d.flags[keyword] = true
+			continue
+		}
+		if len(tokens) == 0 {
+			return nil, invalid
+		}
+		if tokens[0] != "(" {
+			if isSchemaPunctuation(tokens[0]) {
+				return nil, invalid
+			}
+			d.values[keyword] = append(d.values[keyword], unquoteSchemaToken(tokens[0]))
+			tokens = tokens[1:]
+			continue
+		}
+		// a list, $ separators are optional here
+		tokens = tokens[1:]
+		for len(tokens) > 0 && tokens[0] != ")" {
+			if tokens[0] != "$" {
+				if tokens[0] == "(" {
+					return nil, invalid
+				}
+				d.values[keyword] = append(d.values[keyword], unquoteSchemaToken(tokens[0]))
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) == 0 {
+			return nil, invalid
+		}
+		tokens = tokens[1:]
+		if _, ok := d.values[keyword]; !ok {
+			d.values[keyword] = []string{}
+		}
+	}
+	return d, nil
+}
+
+// tokenizeSchemaDescription splits into ( ) $, quoted strings with their
+// quotes, and words.
+func tokenizeSchemaDescription(raw string) ([]string, error) {
+	tokens := make([]string, 0, 16)
+	for i := 0; i < len(raw); {
+		switch c := raw[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '$':
+			tokens = append(tokens, raw[i:i+1])
+			i++
+		case c == '\'':
+			end := strings.IndexByte(raw[i+1:], '\'')
+			if end < 0 {
+				return nil, NewLDAPError(ErrorDecoding, "Unterminated quoted string: "+raw)
+			}
+			tokens = append(tokens, raw[i:i+end+2])
+			i += end + 2
+		default:
+			start := i
+			for i < len(raw) && strings.IndexByte(" \t\n\r()$'", raw[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, raw[start:i])
+		}
+	}
+	return tokens, nil
+}
+
+func isSchemaPunctuation(token string) bool {
+	return token == "(" || token == ")" || token == "$"
+}
+
+// unquoteSchemaToken removes quotes and the \27 and \5c escapes of
+// qdstrings.
+func unquoteSchemaToken(token string) string {
+	if len(token) < 2 || token[0] != '\'' {
+		return token
+	}
+	token = token[1 : len(token)-1]
+	if strings.IndexByte(token, '\\') < 0 {
+		return token
+	}
+	unquoted := make([]byte, 0, len(token))
+	for i := 0; i < len(token); i++ {
+		if token[i] == '\\' && i+2 < len(token) && isHexDigit(token[i+1]) && isHexDigit(token[i+2]) {
+			unquoted = append(unquoted, unhex(token[i+1])<<4|unhex(token[i+2]))
+			i += 2
+		} else {
+			unquoted = append(unquoted, token[i])
+		}
+	}
+	return string(unquoted)
+}
@@ -0,0 +1,424 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains client side schema checking of entries, adds and modifies
+package ldap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// extensibleObject allows any user attribute, RFC 4512 4.3
+const extensibleObjectOID = "1.3.6.1.4.1.1466.101.120.111"
+
+// SchemaViolation is one problem found by schema validation.
+type SchemaViolation struct {
+	// ResultCode is the result the server would return e.g.
+	// LDAPResultObjectClassViolation.
+	ResultCode uint8
+	// Attribute is empty for problems with the entry as a whole.
+	Attribute string
+	Message   string
+}
+
+func (v *SchemaViolation) Error() string {
+	if len(v.Attribute) == 0 {
+		return fmt.Sprintf("%s: %s", LDAPResultCodeMap[v.ResultCode], v.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", LDAPResultCodeMap[v.ResultCode], v.Attribute, v.Message)
+}
+
+// SchemaViolations is the error returned by the Schema Validate methods,
+// holding every problem found.
+type SchemaViolations []*SchemaViolation
+
+func (v SchemaViolations) Error() string {
+	messages := make([]string, len(v))
+	for i, violation := range v {
+		messages[i] = violation.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (v *SchemaViolations) add(resultCode uint8, attribute, format string, args ...interface{}) {
+	*v = append(*v, &SchemaViolation{ResultCode: resultCode, Attribute: attribute, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v SchemaViolations) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+// syntaxValidators check values of the syntaxes with OIDs 1.3.6.1.4.1.1466.
+// 115.121.1.x, other syntaxes are not checked.
+var syntaxValidators = map[string]func(string) error{
+	"1.3.6.1.4.1.1466.115.121.1.7": func(value string) error {
+		if value != "TRUE" && value != "FALSE" {
+			return fmt.Errorf("invalid Boolean %q", value)
+		}
+		return nil
+	},
+	"1.3.6.1.4.1.1466.115.121.1.12": func(value string) error {
+		if _, err := ParseDN(value); err != nil {
+			return fmt.Errorf("invalid DN %q", value)
+		}
+		return nil
+	},
+	"1.3.6.1.4.1.1466.115.121.1.24": func(value string) error {
+		if _, err := ParseGeneralizedTime(value); err != nil {
+			return fmt.Errorf("invalid GeneralizedTime %q", value)
+		}
+		return nil
+	},
+	"1.3.6.1.4.1.1466.115.121.1.27": func(value string) error {
+		if !isInteger(value) {
+			return fmt.Errorf("invalid INTEGER %q", value)
+		}
+		return nil
+	},
+	"1.3.6.1.4.1.1466.115.121.1.36": func(value string) error {
+		if _, err := prepNumericString(value); err != nil || len(value) == 0 {
+			return fmt.Errorf("invalid Numeric String %q", value)
+		}
+		return nil
+	},
+	"1.3.6.1.4.1.1466.115.121.1.38": func(value string) error {
+		if !attributeTypeRegex.MatchString(value) {
+			return fmt.Errorf("invalid OID %q", value)
+		}
+		return nil
+	},
+}
+
+// isInteger - RFC 4517 3.3.16, ( HYPHEN LDIGIT *DIGIT ) / number. There is
+// no sign for positive values and no leading zeros, any length is valid.
+func isInteger(value string) bool {
+	digits := strings.TrimPrefix(value, "-")
+	if digits == "0" {
+		return value == "0"
+	}
+	if len(digits) == 0 || digits[0] == '0' {
+		return false
+	}
+	return strings.Trim(digits, "0123456789") == ""
+}
+
+// ValidateEntry checks entry against the schema: objectClass values are
+// defined, there is one structural object class chain, attributes required
+// by the object classes (and DIT content rule) are present, other user
+// attributes are allowed, single valued attributes have one value, and
+// values of the Boolean, DN, GeneralizedTime, INTEGER, Numeric String and
+// OID syntaxes are valid. Operational attributes are not checked against
+// the object classes. The error is SchemaViolations, nil if there are no
+// problems.
+func (s *Schema) ValidateEntry(entry *Entry) error {
+	var violations SchemaViolations
+	s.validateEntry(entry, &violations)
+	return violations.err()
+}
+
+// ValidateAddRequest is ValidateEntry for the entry to add, also checking
+// that no NO-USER-MODIFICATION attributes are set.
+func (s *Schema) ValidateAddRequest(req *AddRequest) error {
+	var violations SchemaViolations
+	s.validateEntry(req.Entry, &violations)
+	for _, attr := range req.Entry.Attributes {
+		if at := s.AttributeType(splitAttributeDescription(attr.Name).Type); at != nil && at.NoUserModification {
+			violations.add(LDAPResultConstraintViolation, attr.Name, "attribute is not user modifiable")
+		}
+	}
+	return violations.err()
+}
+
+// ValidateModifyRequest checks the modifications of req: attribute types
+// are defined and user modifiable, values are valid for their syntax and
+// single valued attributes are not given more than one value. If current,
+// the entry being modified, is not nil the modifications are applied to a
+// copy of it which is checked with ValidateEntry.
+func (s *Schema) ValidateModifyRequest(req *ModifyRequest, current *Entry) error {
+	var violations SchemaViolations
+	for _, mod := range req.Mods {
+		name := mod.Modification.Name
+		at := s.AttributeType(splitAttributeDescription(name).Type)
+		if at == nil {
+			violations.add(LDAPResultUndefinedAttributeType, name, "undefined attribute type")
+			continue
+		}
+		if at.NoUserModification {
+			violations.add(LDAPResultConstraintViolation, name, "attribute is not user modifiable")
+		}
+		if mod.ModOperation == ModDelete {
+			continue
+		}
+		if at.SingleValue && len(mod.Modification.Values) > 1 {
+			violations.add(LDAPResultConstraintViolation, name, "single valued attribute has %d values", len(mod.Modification.Values))
+		}
+		if mod.ModOperation == ModIncrement {
+			for _, value := range mod.Modification.Values {
+				if !isInteger(value) {
+					violations.add(LDAPResultInvalidAttributeSyntax, name, "invalid increment %q", value)
+				}
+			}
+			continue
+		}
+		s.validateValues(at, name, mod.Modification.Values, &violations)
+	}
+	if current != nil && len(violations) == 0 {
+		modified, err := s.applyMods(current, req.Mods)
+		if err != nil {
+			violations.add(LDAPResultConstraintViolation, "", "%s", err.Error())
+		} else {
+			s.validateEntry(modified, &violations)
+		}
+	}
+	return violations.err()
+}
+
+func (s *Schema) validateEntry(entry *Entry, violations *SchemaViolations) {
+	// attribute types with values, by OID for types in the schema
+	present := make(map[string]bool)
+	for _, attr := range entry.Attributes {
+		if len(attr.Values) > 0 {
+			present[s.attributeKey(splitAttributeDescription(attr.Name).Type)] = true
+		}
+	}
+
+	// object classes
+	var classes []*ObjectClassDefinition
+	for _, attr := range entry.Attributes {
+		if s.attributeKey(splitAttributeDescription(attr.Name).Type) != s.attributeKey("objectClass") {
+			continue
+		}
+		for _, value := range attr.Values {
+			if oc := s.ObjectClass(value); oc != nil {
+				classes = append(classes, oc)
+			} else {
+				violations.add(LDAPResultObjectClassViolation, "", "undefined object class %s", value)
+			}
+		}
+	}
+	if len(classes) == 0 && !present[s.attributeKey("objectClass")] {
+		violations.add(LDAPResultObjectClassViolation, "", "no objectClass")
+	}
+	structural := s.structuralClass(classes, violations)
+
+	allowed := make(map[string]bool)
+	var required []string
+	requiredSeen := make(map[string]bool)
+	require := func(name string) {
+		key := s.attributeKey(name)
+		allowed[key] = true
+		if !requiredSeen[key] {
+			requiredSeen[key] = true
+			required = append(required, name)
+		}
+	}
+	extensible := false
+	for _, oc := range classes {
+		for _, name := range oc.AllMust {
+			require(name)
+		}
+		for _, name := range oc.AllMay {
+			allowed[s.attributeKey(name)] = true
+		}
+		extensible = extensible || oc.OID == extensibleObjectOID
+	}
+	forbidden := make(map[string]bool)
+	if structural != nil {
+		for _, rule := range s.DITContentRules {
+			if rule.OID != structural.OID {
+				continue
+			}
+			auxiliary := make(map[*ObjectClassDefinition]bool)
+			for _, name := range rule.Auxiliary {
+				if aux := s.ObjectClass(name); aux != nil {
+					auxiliary[aux] = true
+				}
+			}
+			for _, oc := range classes {
+				if oc.Kind == ObjectClassAuxiliary && !auxiliary[oc] {
+					violations.add(LDAPResultObjectClassViolation, "", "auxiliary object class %s not allowed by DIT content rule %s", oc.Name(), rule.Name())
+				}
+			}
+			for _, name := range rule.Must {
+				require(name)
+			}
+			for _, name := range rule.May {
+				allowed[s.attributeKey(name)] = true
+			}
+			for _, name := range rule.Not {
+				if present[s.attributeKey(name)] {
+					violations.add(LDAPResultObjectClassViolation, name, "not allowed by DIT content rule %s", rule.Name())
+				}
+				forbidden[s.attributeKey(name)] = true
+			}
+		}
+	}
+	for _, name := range required {
+		if !present[s.attributeKey(name)] {
+			violations.add(LDAPResultObjectClassViolation, name, "required attribute missing")
+		}
+	}
+
+	for _, attr := range entry.Attributes {
+		at := s.AttributeType(splitAttributeDescription(attr.Name).Type)
+		if at == nil {
+			violations.add(LDAPResultUndefinedAttributeType, attr.Name, "undefined attribute type")
+			continue
+		}
+		if !at.IsOperational() && !extensible && !allowed[at.OID] && !forbidden[at.OID] && len(classes) > 0 {
+			violations.add(LDAPResultObjectClassViolation, attr.Name, "attribute not allowed by the object classes")
+		}
+		if at.SingleValue && len(attr.Values) > 1 {
+			violations.add(LDAPResultConstraintViolation, attr.Name, "single valued attribute has %d values", len(attr.Values))
+		}
+		s.validateValues(at, attr.Name, attr.Values, violations)
+	}
+}
+
+// structuralClass returns the most specific structural class, checking
+// that there is one and the others are its superclasses.
+func (s *Schema) structuralClass(classes []*ObjectClassDefinition, violations *SchemaViolations) *ObjectClassDefinition {
+	var structural []*ObjectClassDefinition
+	for _, oc := range classes {
+		if oc.Kind == ObjectClassStructural {
+			structural = append(structural, oc)
+		}
+	}
+	if len(structural) == 0 {
+		if len(classes) > 0 {
+			violations.add(LDAPResultObjectClassViolation, "", "no structural object class")
+		}
+		return nil
+	}
+	// the most specific class has all the others as superclasses
+	for _, candidate := range structural {
+		ok := true
+		for _, oc := range structural {
+			if oc != candidate && !isSuperiorClass(oc, candidate, make(map[*ObjectClassDefinition]bool)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return candidate
+		}
+	}
+	names := make([]string, len(structural))
+	for i, oc := range structural {
+		names[i] = oc.Name()
+	}
+	violations.add(LDAPResultObjectClassViolation, "", "multiple structural object classes %s", strings.Join(names, ", "))
+	return nil
+}
+
+func isSuperiorClass(sup, oc *ObjectClassDefinition, visited map[*ObjectClassDefinition]bool) bool {
+	if visited[oc] {
+		return false
+	}
+	visited[oc] = true
+	for _, c := range oc.SuperiorClasses {
+		if c == sup || isSuperiorClass(sup, c, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) validateValues(at *AttributeTypeDefinition, name string, values []string, violations *SchemaViolations) {
+	validate, ok := syntaxValidators[at.Syntax]
+	if !ok {
+		return
+	}
+	for _, value := range values {
+		if err := validate(value); err != nil {
+			violations.add(LDAPResultInvalidAttributeSyntax, name, "%s", err.Error())
+		}
+	}
+}
+
+// applyMods returns a copy of entry with mods applied as the server would,
+// values are compared with the equality rule of the attribute type when
+// there is an implementation of it.
+func (s *Schema) applyMods(entry *Entry, mods []Mod) (*Entry, error) {
+	modified := NewEntry(entry.DN)
+	for _, attr := range entry.Attributes {
+		modified.AddAttributeValues(attr.Name, append([]string{}, attr.Values...))
+	}
+	for _, mod := range mods {
+		name := mod.Modification.Name
+		i := modified.GetAttributeIndex(name)
+		switch mod.ModOperation {
+		case ModAdd:
+			modified.AddAttributeValues(name, append([]string{}, mod.Modification.Values...))
+		case ModReplace:
+			if i >= 0 {
+				modified.Attributes = append(modified.Attributes[:i], modified.Attributes[i+1:]...)
+			}
+			if len(mod.Modification.Values) > 0 {
+				modified.AddAttributeValues(name, append([]string{}, mod.Modification.Values...))
+			}
+		case ModDelete:
+			if i < 0 {
+				return nil, fmt.Errorf("%s: no such attribute to delete", name)
+			}
+			if len(mod.Modification.Values) == 0 {
+				modified.Attributes = append(modified.Attributes[:i], modified.Attributes[i+1:]...)
+				continue
+			}
+			rule := s.equalityRule(name)
+			values := modified.Attributes[i].Values
+			for _, value := range mod.Modification.Values {
+				found := false
+				for j, existing := range values {
+					if ValuesEqual(rule, existing, value) {
+						values = append(values[:j], values[j+1:]...)
+						found = true
+						break
+					}
+				}
+				if !found {
+					return nil, fmt.Errorf("%s: no such value %q to delete", name, value)
+				}
+			}
+			if len(values) == 0 {
+				modified.Attributes = append(modified.Attributes[:i], modified.Attributes[i+1:]...)
+			} else {
+				modified.Attributes[i].Values = values
+			}
+		case ModIncrement:
+			if i < 0 || len(mod.Modification.Values) != 1 {
+				return nil, fmt.Errorf("%s: cannot increment", name)
+			}
+			increment, err := strconv.ParseInt(mod.Modification.Values[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: cannot increment by %q", name, mod.Modification.Values[0])
+			}
+			for j, value := range modified.Attributes[i].Values {
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s: cannot increment %q", name, value)
+				}
+				modified.Attributes[i].Values[j] = strconv.FormatInt(n+increment, 10)
+			}
+		}
+	}
+	return modified, nil
+}
+
+func (s *Schema) equalityRule(name string) MatchingRule {
+	if at := s.AttributeType(splitAttributeDescription(name).Type); at != nil && len(at.Equality) > 0 {
+		if rule := GetMatchingRule(at.Equality); rule != nil {
+			return rule
+		}
+		if mr := s.MatchingRule(at.Equality); mr != nil {
+			return GetMatchingRule(mr.OID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testValidationSchema(t *testing.T) *Schema {
+	e := testSchemaEntry()
+	e.AddAttributeValues("attributeTypes", []string{
+		"( 0.9.2342.19200300.100.1.10 NAME 'manager' EQUALITY distinguishedNameMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.12 )",
+		"( 1.2.3.10 NAME 'x-active' EQUALITY booleanMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.7 SINGLE-VALUE )",
+		"( 1.2.3.11 NAME 'x-oid' SYNTAX 1.3.6.1.4.1.1466.115.121.1.38 )",
+		"( 1.2.3.12 NAME 'x-pin' SYNTAX 1.3.6.1.4.1.1466.115.121.1.36 )",
+	})
+	e.AddAttributeValues("objectClasses", []string{
+		"( 1.2.3.20 NAME 'x-extra' AUXILIARY MAY ( manager $ x-active $ x-oid $ x-pin $ createTimestamp ) )",
+		"( 1.2.3.21 NAME 'device' SUP top STRUCTURAL MUST cn )",
+		"( 1.2.3.22 NAME 'room' SUP top STRUCTURAL MUST cn )",
+		"( 1.3.6.1.4.1.1466.101.120.111 NAME 'extensibleObject' SUP top AUXILIARY )",
+	})
+	s, err := ParseSchema(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func violationAttributes(err error) []string {
+	attributes := make([]string, 0)
+	if err == nil {
+		return attributes
+	}
+	for _, v := range err.(SchemaViolations) {
+		attributes = append(attributes, v.Attribute)
+	}
+	return attributes
+}
+
+func TestSchemaValidateEntry(t *testing.T) {
+	s := testValidationSchema(t)
+	e := NewEntry("uid=bob,dc=example")
+	e.AddAttributeValues("objectClass", []string{"top", "person", "inetOrgPerson", "posixAccount", "x-extra"})
+	e.AddAttributeValues("2.5.4.3", []string{"Bob"})
+	e.AddAttributeValues("surname", []string{"Smith"})
+	e.AddAttributeValues("uid", []string{"bob"})
+	e.AddAttributeValues("uidNumber", []string{"1000"})
+	e.AddAttributeValues("cn;lang-en", []string{"Bob"})
+	e.AddAttributeValues("manager", []string{"uid=alice,dc=example"})
+	e.AddAttributeValues("x-active", []string{"TRUE"})
+	e.AddAttributeValues("x-oid", []string{"1.2.3", "person"})
+	e.AddAttributeValues("createTimestamp", []string{"20130704120000Z"})
+	if err := s.ValidateEntry(e); err != nil {
+		t.Fatalf("unexpected %s", err)
+	}
+
+	e = NewEntry("uid=bob,dc=example")
+	e.AddAttributeValues("objectClass", []string{"person", "posixAccount", "x-extra", "nosuchclass"})
+	e.AddAttributeValues("sn", []string{"Smith"})
+	e.AddAttributeValues("uidNumber", []string{"1000", "x"})
+	e.AddAttributeValues("manager", []string{"uid=alice,"})
+	e.AddAttributeValues("x-active", []string{"yes"})
+	e.AddAttributeValues("x-oid", []string{"1.2."})
+	e.AddAttributeValues("x-pin", []string{"12a"})
+	e.AddAttributeValues("userid", []string{"bob"})
+	e.AddAttributeValues("mail", []string{"bob@example"})
+	e.AddAttributeValues("createTimestamp", []string{"yesterday"})
+	err := s.ValidateEntry(e)
+	// x-extra is not allowed by the content rule of person, userid is the
+	// uid it requires
+	want := []string{"", "", "cn", "uidNumber", "uidNumber", "manager", "x-active", "x-oid", "x-pin", "mail", "createTimestamp"}
+	if got := violationAttributes(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected violations of %v, got %s", want, err)
+	}
+	if v := err.(SchemaViolations); v[0].ResultCode != LDAPResultObjectClassViolation ||
+		v[3].ResultCode != LDAPResultConstraintViolation || v[4].ResultCode != LDAPResultInvalidAttributeSyntax ||
+		v[9].ResultCode != LDAPResultUndefinedAttributeType {
+		t.Errorf("unexpected result codes %s", err)
+	}
+
+	for _, test := range []struct {
+		objectClasses []string
+		attributes    []string
+		violations    int
+	}{
+		{[]string{"top", "x-extra"}, []string{"x-oid"}, 1},                // no structural class
+		{[]string{"device", "room"}, []string{"cn"}, 1},                   // two structural chains
+		{[]string{"top", "device"}, []string{"cn"}, 0},                    // one chain
+		{[]string{"device"}, []string{"cn", "sn"}, 1},                     // sn not allowed
+		{[]string{"device", "extensibleObject"}, []string{"cn", "sn"}, 0}, // anything allowed
+	} {
+		e := NewEntry("cn=x")
+		e.AddAttributeValues("objectClass", test.objectClasses)
+		for _, name := range test.attributes {
+			e.AddAttributeValue(name, "x")
+		}
+		err := s.ValidateEntry(e)
+		if len(violationAttributes(err)) != test.violations {
+			t.Errorf("%v %v expected %d violations, got %v", test.objectClasses, test.attributes, test.violations, err)
+		}
+	}
+
+	if err := s.ValidateEntry(NewEntry("cn=x")); len(violationAttributes(err)) != 1 {
+		t.Errorf("expected no objectClass, got %v", err)
+	}
+}
+
+func TestSchemaValidateDITContentRule(t *testing.T) {
+	s := testValidationSchema(t)
+	e := NewEntry("cn=x")
+	e.AddAttributeValues("objectClass", []string{"person", "x-extra"})
+	e.AddAttributeValues("cn", []string{"x"})
+	e.AddAttributeValues("sn", []string{"x"})
+	e.AddAttributeValues("telephoneNumber", []string{"1"})
+	// person allows auxiliary posixAccount only, requires uid and forbids
+	// telephoneNumber
+	err := s.ValidateEntry(e)
+	if got, want := violationAttributes(err), []string{"", "telephoneNumber", "uid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected violations of %v, got %s", want, err)
+	}
+}
+
+func TestSchemaValidateAddRequest(t *testing.T) {
+	s := testValidationSchema(t)
+	e := NewEntry("cn=x")
+	e.AddAttributeValues("objectClass", []string{"device", "x-extra"})
+	e.AddAttributeValues("cn", []string{"x"})
+	e.AddAttributeValues("createTimestamp", []string{"20130704120000Z"})
+	err := s.ValidateAddRequest(&AddRequest{Entry: e})
+	if got := violationAttributes(err); !reflect.DeepEqual(got, []string{"createTimestamp"}) {
+		t.Errorf("expected createTimestamp not user modifiable, got %v", err)
+	}
+}
+
+func TestSchemaValidateInteger(t *testing.T) {
+	s := testValidationSchema(t)
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"0", true},
+		{"5", true},
+		{"-5", true},
+		{"1000", true},
+		{"123456789012345678901234567890", true},
+		{"+5", false},
+		{"007", false},
+		{"-0", false},
+		{"-", false},
+		{"", false},
+		{" 5", false},
+		{"5x", false},
+	}
+	for _, test := range tests {
+		req := NewModifyRequest("cn=x")
+		req.AddMod(NewMod(ModReplace, "uidNumber", []string{test.value}))
+		req.AddMod(NewMod(ModIncrement, "x-pin", []string{test.value}))
+		err := s.ValidateModifyRequest(req, nil)
+		want := []string{}
+		if !test.valid {
+			want = []string{"uidNumber", "x-pin"}
+		}
+		if got := violationAttributes(err); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected violations of %v, got %v", test.value, want, err)
+		}
+	}
+}
+
+func TestSchemaValidateModifyRequest(t *testing.T) {
+	s := testValidationSchema(t)
+	current := NewEntry("cn=x")
+	current.AddAttributeValues("objectClass", []string{"device", "x-extra"})
+	current.AddAttributeValues("cn", []string{"x"})
+	current.AddAttributeValues("x-active", []string{"TRUE"})
+
+	req := NewModifyRequest("cn=x")
+	req.AddMod(NewMod(ModReplace, "x-active", []string{"TRUE", "FALSE"}))
+	req.AddMod(NewMod(ModAdd, "manager", []string{"bad"}))
+	req.AddMod(NewMod(ModAdd, "nosuch", []string{"1"}))
+	req.AddMod(NewMod(ModDelete, "createTimestamp", nil))
+	req.AddMod(NewMod(ModIncrement, "x-pin", []string{"one"}))
+	err := s.ValidateModifyRequest(req, current)
+	want := []string{"x-active", "manager", "nosuch", "createTimestamp", "x-pin"}
+	if got := violationAttributes(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected violations of %v, got %v", want, err)
+	}
+
+	// valid on its own, invalid for the entry
+	req = NewModifyRequest("cn=x")
+	req.AddMod(NewMod(ModAdd, "x-active", []string{"FALSE"}))
+	req.AddMod(NewMod(ModDelete, "CN", []string{"X"}))
+	req.AddMod(NewMod(ModAdd, "sn", []string{"y"}))
+	if err := s.ValidateModifyRequest(req, nil); err != nil {
+		t.Errorf("unexpected %s", err)
+	}
+	err = s.ValidateModifyRequest(req, current)
+	if got, want := violationAttributes(err), []string{"cn", "x-active", "sn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected violations of %v, got %v", want, err)
+	}
+	if len(current.GetAttributeValues("cn")) != 1 || len(current.GetAttributeValues("x-active")) != 1 {
+		t.Errorf("current entry was modified")
+	}
+
+	req = NewModifyRequest("cn=x")
+	req.AddMod(NewMod(ModDelete, "cn", []string{"y"}))
+	if err := s.ValidateModifyRequest(req, current); err == nil {
+		t.Errorf("expected an error deleting a missing value")
+	}
+	req = NewModifyRequest("cn=x")
+	req.AddMod(NewMod(ModReplace, "cn", []string{"y"}))
+	req.AddMod(NewMod(ModReplace, "x-active", nil))
+	if err := s.ValidateModifyRequest(req, current); err != nil {
+		t.Errorf("unexpected %s", err)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testSchemaEntry() *Entry {
+	e := NewEntry("cn=Subschema")
+	e.AddAttributeValues("attributeTypes", []string{
+		"( 2.5.4.41 NAME 'name' EQUALITY caseIgnoreMatch SUBSTR caseIgnoreSubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15{32768} )",
+		"( 2.5.4.3 NAME ( 'cn' 'commonName' ) DESC 'RFC4519: common name(s) for which the entity is known by' SUP name )",
+		"( 2.5.4.4 NAME ( 'sn' 'surname' ) SUP name )",
+		"( 2.5.4.0 NAME 'objectClass' EQUALITY objectIdentifierMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.38 )",
+		"( 0.9.2342.19200300.100.1.1 NAME ( 'uid' 'userid' ) EQUALITY caseIgnoreMatch SUBSTR caseIgnoreSubstringsMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.15{256} )",
+		"( 2.5.4.35 NAME 'userPassword' EQUALITY octetStringMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.40{128} )",
+		"( 1.3.6.1.1.1.1.0 NAME 'uidNumber' EQUALITY integerMatch ORDERING integerOrderingMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.27 SINGLE-VALUE )",
+		"( 2.5.18.1 NAME 'createTimestamp' EQUALITY generalizedTimeMatch ORDERING generalizedTimeOrderingMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.24 SINGLE-VALUE NO-USER-MODIFICATION USAGE directoryOperation )",
+		"( 2.5.4.20 NAME 'telephoneNumber' EQUALITY telephoneNumberMatch SYNTAX 1.3.6.1.4.1.1466.115.121.1.50{32} X-ORIGIN ( 'RFC 4519' 'user defined' ) )",
+		"( 1.2.3.4 NAME 'loop1' SUP loop2 )",
+		"( 1.2.3.5 NAME 'loop2' SUP loop1 )",
+	})
+	e.AddAttributeValues("objectClasses", []string{
+		"( 2.5.6.0 NAME 'top' ABSTRACT MUST objectClass )",
+		"( 2.5.6.6 NAME 'person' DESC 'RFC2256: a person' SUP top STRUCTURAL MUST ( sn $ cn ) MAY ( userPassword $ telephoneNumber ) )",
+		"( 2.16.840.1.113730.3.2.2 NAME 'inetOrgPerson' SUP person STRUCTURAL MAY ( uid $ 2.5.4.4 ) )",
+		"( 1.3.6.1.1.1.2.0 NAME 'posixAccount' SUP top AUXILIARY MUST ( cn $ uid $ uidNumber ) )",
+		"( 1.2.3.6 NAME 'multi' SUP ( person $ posixAccount ) MAY 'name' )",
+	})
+	e.AddAttributeValues("matchingRules", []string{
+		"( 2.5.13.2 NAME 'caseIgnoreMatch' SYNTAX 1.3.6.1.4.1.1466.115.121.1.15 )",
+		"( 2.5.13.14 NAME 'integerMatch' SYNTAX 1.3.6.1.4.1.1466.115.121.1.27 )",
+	})
+	e.AddAttributeValues("ldapSyntaxes", []string{
+		"( 1.3.6.1.4.1.1466.115.121.1.15 DESC 'Directory String' )",
+		"( 1.3.6.1.4.1.1466.115.121.1.5 DESC 'Binary' X-NOT-HUMAN-READABLE 'TRUE' )",
+	})
+	e.AddAttributeValues("matchingRuleUse", []string{
+		"( 2.5.13.2 NAME 'caseIgnoreMatch' APPLIES ( cn $ sn $ uid ) )",
+	})
+	e.AddAttributeValues("dITContentRules", []string{
+		"( 2.5.6.6 NAME 'personContentRule' AUX posixAccount MUST uid NOT telephoneNumber )",
+	})
+	e.AddAttributeValues("nameForms", []string{
+		"( 1.2.3.7 NAME 'personNameForm' OC person MUST cn MAY uid )",
+	})
+	return e
+}
+
+func TestParseSchema(t *testing.T) {
+	s, err := ParseSchema(testSchemaEntry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.AttributeTypes) != 11 || len(s.ObjectClasses) != 5 || len(s.MatchingRules) != 2 ||
+		len(s.Syntaxes) != 2 || len(s.MatchingRuleUses) != 1 || len(s.DITContentRules) != 1 || len(s.NameForms) != 1 {
+		t.Fatalf("unexpected definition counts %+v", s)
+	}
+
+	cn := s.AttributeType("COMMONNAME")
+	if cn == nil || cn.OID != "2.5.4.3" || s.AttributeType("2.5.4.3") != cn || cn.Name() != "cn" {
+		t.Fatalf("cn lookup: %+v", cn)
+	}
+	if cn.Description != "RFC4519: common name(s) for which the entity is known by" {
+		t.Errorf("DESC: %q", cn.Description)
+	}
+	// inherited from name
+	if cn.SuperiorType != s.AttributeType("name") || cn.Equality != "caseIgnoreMatch" ||
+		cn.Substring != "caseIgnoreSubstringsMatch" || cn.Syntax != "1.3.6.1.4.1.1466.115.121.1.15" ||
+		cn.SyntaxLength != 32768 || cn.Ordering != "" {
+		t.Errorf("cn inheritance: %+v", cn)
+	}
+	uidNumber := s.AttributeType("uidNumber")
+	if !uidNumber.SingleValue || uidNumber.IsOperational() || uidNumber.SyntaxLength != 0 {
+		t.Errorf("uidNumber: %+v", uidNumber)
+	}
+	created := s.AttributeType("createTimestamp")
+	if !created.NoUserModification || !created.IsOperational() || created.Usage != AttributeUsageDirectoryOperation {
+		t.Errorf("createTimestamp: %+v", created)
+	}
+	tel := s.AttributeType("telephoneNumber")
+	if !reflect.DeepEqual(tel.Extensions["X-ORIGIN"], []string{"RFC 4519", "user defined"}) {
+		t.Errorf("X-ORIGIN: %v", tel.Extensions)
+	}
+	if s.AttributeType("loop1").SuperiorType != s.AttributeType("loop2") {
+		t.Errorf("loop1 SUP not resolved")
+	}
+
+	person := s.ObjectClass("person")
+	if person.Kind != ObjectClassStructural || !reflect.DeepEqual(person.Must, []string{"sn", "cn"}) ||
+		!reflect.DeepEqual(person.AllMust, []string{"sn", "cn", "objectClass"}) {
+		t.Errorf("person: %+v", person)
+	}
+	if s.ObjectClass("top").Kind != ObjectClassAbstract || s.ObjectClass("posixAccount").Kind != ObjectClassAuxiliary {
+		t.Errorf("object class kinds")
+	}
+	inetOrgPerson := s.ObjectClass("2.16.840.1.113730.3.2.2")
+	// MUST and MAY are collected separately, sn as 2.5.4.4 stays in MAY
+	if !reflect.DeepEqual(inetOrgPerson.AllMay, []string{"uid", "2.5.4.4", "userPassword", "telephoneNumber"}) ||
+		!reflect.DeepEqual(inetOrgPerson.AllMust, []string{"sn", "cn", "objectClass"}) {
+		t.Errorf("inetOrgPerson: must %v may %v", inetOrgPerson.AllMust, inetOrgPerson.AllMay)
+	}
+	multi := s.ObjectClass("multi")
+	if len(multi.SuperiorClasses) != 2 ||
+		!reflect.DeepEqual(multi.AllMust, []string{"sn", "cn", "objectClass", "uid", "uidNumber"}) {
+		t.Errorf("multi: %v", multi.AllMust)
+	}
+
+	if mr := s.MatchingRule("caseignorematch"); mr == nil || mr.OID != "2.5.13.2" || mr.Syntax != "1.3.6.1.4.1.1466.115.121.1.15" {
+		t.Errorf("matching rule: %+v", mr)
+	}
+	if syntax := s.Syntax("1.3.6.1.4.1.1466.115.121.1.5"); syntax == nil || syntax.Description != "Binary" ||
+		syntax.Extensions["X-NOT-HUMAN-READABLE"][0] != "TRUE" {
+		t.Errorf("syntax: %+v", syntax)
+	}
+	if mru := s.MatchingRuleUses[0]; !reflect.DeepEqual(mru.Applies, []string{"cn", "sn", "uid"}) {
+		t.Errorf("matchingRuleUse: %+v", mru)
+	}
+	if dcr := s.DITContentRules[0]; dcr.OID != "2.5.6.6" || !reflect.DeepEqual(dcr.Auxiliary, []string{"posixAccount"}) ||
+		!reflect.DeepEqual(dcr.Must, []string{"uid"}) || !reflect.DeepEqual(dcr.Not, []string{"telephoneNumber"}) {
+		t.Errorf("dITContentRule: %+v", dcr)
+	}
+	if nf := s.NameForms[0]; nf.ObjectClass != "person" || !reflect.DeepEqual(nf.Must, []string{"cn"}) ||
+		!reflect.DeepEqual(nf.May, []string{"uid"}) {
+		t.Errorf("nameForm: %+v", nf)
+	}
+
+	aa := s.AttributeAliases()
+	if aa.Canonical("commonName") != aa.Canonical("2.5.4.3") || aa.Canonical("cn") == aa.Canonical("sn") {
+		t.Errorf("aliases: %v", aa)
+	}
+	rules := s.AttributeMatchingRules()
+	if rules["uidnumber"] != "2.5.13.14" || rules["cn"] != "2.5.13.2" || rules["userpassword"] != "octetStringMatch" {
+		t.Errorf("matching rules: %v", rules)
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	for _, def := range []string{
+		"",
+		"2.5.4.3 NAME 'cn'",
+		"( 2.5.4.3 NAME 'cn'",
+		"( 2.5.4.3 NAME 'cn )",
+		"( 2.5.4.3 NAME ( 'cn' 'commonName' )",
+		"( 2.5.4.3 NAME )",
+		"( ( 2.5.4.3 ) )",
+	} {
+		e := NewEntry("cn=Subschema")
+		e.AddAttributeValue("attributeTypes", def)
+		if _, err := ParseSchema(e); err == nil {
+			t.Errorf("%q expected an error", def)
+		}
+	}
+}
+
+func TestParseSchemaDescription(t *testing.T) {
+	d, err := parseSchemaDescription("('1.2.3' NAME 'a' DESC 'it\\27s \\5c' X-EMPTY ( ) OBSOLETE)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := d.element()
+	if e.OID != "1.2.3" || e.Description != `it's \` || !e.Obsolete || e.Extensions["X-EMPTY"] == nil ||
+		len(e.Extensions["X-EMPTY"]) != 0 || !e.HasName("A") || !e.HasName("1.2.3") || e.HasName("b") {
+		t.Errorf("unexpected %+v", e)
+	}
+}
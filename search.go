@@ -8,7 +8,6 @@ package ldap
 import (
 	"fmt"
 	"github.com/mavricknz/asn1-ber"
-	"log"
 )
 
 const (
@@ -76,6 +75,11 @@ type SearchRequest struct {
 	Filter       string
 	Attributes   []string
 	Controls     []Control
+	FilterTree   Filter // used instead of Filter when set
+	// SortFallback sorts the results locally when Controls has a
+	// ControlServerSideSortRequest the server ignored or failed, see
+	// SortEntries. Used by Search and SearchWithPaging.
+	SortFallback bool
 }
 
 //NewSimpleSearchRequest only requires four parameters and defaults the
@@ -131,8 +135,18 @@ func NewSearchRequest(
 //use with servers that require paging for certain result sizes (AD?).
 //
 //It is NOT an efficent way to process huge result sets i.e. it doesn't process on a pageSize
-//number of entries, it returns the combined result.
+//number of entries, it returns the combined result. See NewSearchPager for that.
+//
+//If the root DSE can be read and lists supported controls but not the paging control,
+//a single search without the control is done. An empty supportedControl, e.g. hidden by
+//access controls, is treated as unknown.
 func (l *LDAPConnection) SearchWithPaging(searchRequest *SearchRequest, pagingSize uint32) (*SearchResult, error) {
+	if r, err := l.GetRootDSE(); err == nil && len(r.SupportedControls) > 0 && !r.SupportsControl(ControlTypePaging) {
+		if l.Debug {
+			fmt.Println("Paging control not in supportedControl, searching without paging.")
+		}
+		return l.Search(searchRequest)
+	}
 	pagingControl := NewControlPaging(pagingSize)
 	searchRequest.AddControl(pagingControl)
 	allResults := new(SearchResult)
@@ -154,7 +168,7 @@ func (l *LDAPConnection) SearchWithPaging(searchRequest *SearchRequest, pagingSi
 			if l.Debug {
 				fmt.Println("Requested paging but no control returned, control unsupported.")
 			}
-			return allResults, nil
+			return allResults, l.sortFallback(searchRequest, allResults)
 		} else if pagingResponsePacket == nil {
 			return allResults, NewLDAPError(ErrorMissingControl, "Expected paging Control, it was not found.")
 		}
@@ -163,7 +177,7 @@ func (l *LDAPConnection) SearchWithPaging(searchRequest *SearchRequest, pagingSi
 			break
 		}
 	}
-	return allResults, nil
+	return allResults, l.sortFallback(searchRequest, allResults)
 }
 
 //ProcessDiscreteResult handles an individual result from a server. Member of the
@@ -193,7 +207,7 @@ func (l *LDAPConnection) Search(searchRequest *SearchRequest) (*SearchResult, er
 	if err != nil {
 		return result, err
 	}
-	return result, nil
+	return result, l.sortFallback(searchRequest, result)
 }
 
 func encodeSearchRequest(req *SearchRequest) (*ber.Packet, error) {
@@ -204,7 +218,13 @@ func encodeSearchRequest(req *SearchRequest) (*ber.Packet, error) {
 	searchRequest.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimative, ber.TagInteger, uint64(req.SizeLimit), "Size Limit"))
 	searchRequest.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimative, ber.TagInteger, uint64(req.TimeLimit), "Time Limit"))
 	searchRequest.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimative, ber.TagBoolean, req.TypesOnly, "Types Only"))
-	filterPacket, err := CompileFilter(req.Filter)
+	var filterPacket *ber.Packet
+	var err error
+	if req.FilterTree != nil {
+		filterPacket, err = req.FilterTree.Encode()
+	} else {
+		filterPacket, err = CompileFilter(req.Filter)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -226,50 +246,40 @@ func (req *SearchRequest) AddControl(control Control) {
 }
 
 // SearchResult decoded to Entry,Controls,Referral
+// Controls are decoded for every result type, not just SearchResultDone.
 func decodeSearchResponse(packet *ber.Packet) (discreteSearchResult *DiscreteSearchResult, err error) {
 	discreteSearchResult = new(DiscreteSearchResult)
+	discreteSearchResult.Controls, err = decodeResponseControls(packet)
+	if err != nil {
+		return nil, err
+	}
 	switch packet.Children[1].Tag {
 	case SearchResultEntry:
 		discreteSearchResult.SearchResultType = SearchResultEntry
 		entry := new(Entry)
-		entry.DN = packet.Children[1].Children[0].Value.(string)
+		// raw bytes, values may be binary e.g. objectGUID, jpegPhoto
+		entry.DN = string(packet.Children[1].Children[0].Data.Bytes())
 		for _, child := range packet.Children[1].Children[1].Children {
 			attr := new(EntryAttribute)
-			attr.Name = child.Children[0].Value.(string)
+			attr.Name = string(child.Children[0].Data.Bytes())
 			for _, value := range child.Children[1].Children {
-				attr.Values = append(attr.Values, value.Value.(string))
+				attr.Values = append(attr.Values, string(value.Data.Bytes()))
 			}
 			entry.Attributes = append(entry.Attributes, attr)
 		}
+		entry.Controls = discreteSearchResult.Controls
 		discreteSearchResult.Entry = entry
 		return discreteSearchResult, nil
 	case SearchResultDone:
 		discreteSearchResult.SearchResultType = SearchResultDone
-		result_code, result_description := getLDAPResultCode(packet)
-		if result_code != 0 {
-			return discreteSearchResult, NewLDAPError(result_code, result_description)
-		}
-
-		if len(packet.Children) == 3 {
-			controls := make([]Control, 0)
-			for _, child := range packet.Children[2].Children {
-				// child.Children[0].Value.(string) = control oid
-				decodeFunc, present := ControlDecodeMap[child.Children[0].Value.(string)]
-				if present {
-					c, _ := decodeFunc(child)
-					controls = append(controls, c)
-				} else {
-					// not fatal but definately a warning
-					log.Println("Couldn't decode Control : " + child.Children[0].Value.(string))
-				}
-			}
-			discreteSearchResult.Controls = controls
+		if err := getLDAPResultError(packet); err != nil {
+			return discreteSearchResult, err
 		}
 		return discreteSearchResult, nil
 	case SearchResultReference:
 		discreteSearchResult.SearchResultType = SearchResultReference
 		for ref := range packet.Children[1].Children {
-			discreteSearchResult.Referrals = append(discreteSearchResult.Referrals, packet.Children[1].Children[ref].Value.(string))
+			discreteSearchResult.Referrals = append(discreteSearchResult.Referrals, string(packet.Children[1].Children[ref].Data.Bytes()))
 		}
 		return discreteSearchResult, nil
 	}
@@ -360,10 +370,32 @@ func (l *LDAPConnection) SearchWithHandler(
 
 		discreteSearchResult, err := decodeSearchResponse(packet)
 
+		if referrals, ok := l.isReferral(err); ok {
+			err = l.chaseReferrals(referrals, func(conn *LDAPConnection, lu *LDAPURL) error {
+				return conn.SearchWithHandler(referralSearchRequest(searchRequest, lu), resultHandler, nil)
+			})
+			return sendError(errorChan, err)
+		}
+
 		if err != nil {
 			return sendError(errorChan, err)
 		}
 
+		if discreteSearchResult.SearchResultType == SearchResultEntry {
+			discreteSearchResult.Entry.Server = l.Addr
+		}
+
+		if discreteSearchResult.SearchResultType == SearchResultReference && l.ReferralConfig != nil {
+			stop, err := l.chaseSearchReferences(searchRequest, discreteSearchResult, resultHandler, connectionInfo)
+			if err != nil {
+				return sendError(errorChan, err)
+			}
+			if stop {
+				break
+			}
+			continue
+		}
+
 		stop, err := resultHandler.ProcessDiscreteResult(discreteSearchResult, connectionInfo)
 		if err != nil {
 			return sendError(errorChan, err)
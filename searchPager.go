@@ -0,0 +1,122 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains a streaming paged search iterator
+package ldap
+
+// SearchPager iterates over the entries of a paged search one at a time.
+// A page is only requested from the server when the previous page has been
+// consumed, so at most pagingSize entries are held in memory.
+//
+//	pager := l.NewSearchPager(searchRequest, 500)
+//	defer pager.Close()
+//	for {
+//		entry, err := pager.Next()
+//		if err != nil {
+//			return err
+//		}
+//		if entry == nil {
+//			break // no more entries
+//		}
+//		...
+//	}
+//
+// A SearchPager is not safe for concurrent use.
+type SearchPager struct {
+	// Controls from the SearchResultDone of the most recent page.
+	Controls []Control
+	// Referrals from all pages so far.
+	Referrals []string
+	// PageCount is the number of pages requested so far.
+	PageCount int
+
+	conn          *LDAPConnection
+	searchRequest *SearchRequest
+	pagingControl *ControlPaging
+	entries       []*Entry
+	done          bool
+	err           error
+}
+
+// NewSearchPager returns a SearchPager for searchRequest using pages of
+// pagingSize. searchRequest is copied and not modified, an existing paging
+// control in it is replaced. No request is sent until Next is called.
+func (l *LDAPConnection) NewSearchPager(searchRequest *SearchRequest, pagingSize uint32) *SearchPager {
+	pagingControl := NewControlPaging(pagingSize)
+	req := *searchRequest
+	req.Controls = make([]Control, 0, len(searchRequest.Controls)+1)
+	for _, c := range searchRequest.Controls {
+		if c.GetControlType() != ControlTypePaging {
+			req.Controls = append(req.Controls, c)
+		}
+	}
+	req.AddControl(pagingControl)
+	return &SearchPager{
+		conn:          l,
+		searchRequest: &req,
+		pagingControl: pagingControl,
+	}
+}
+
+// Next returns the next entry, requesting the next page if required.
+// Returns nil, nil when there are no more entries. Once an error is
+// returned it is returned on all following calls.
+func (sp *SearchPager) Next() (*Entry, error) {
+	for len(sp.entries) == 0 {
+		if sp.err != nil {
+			return nil, sp.err
+		}
+		if sp.done {
+			return nil, nil
+		}
+		sp.err = sp.nextPage()
+	}
+	entry := sp.entries[0]
+	sp.entries[0] = nil
+	sp.entries = sp.entries[1:]
+	return entry, nil
+}
+
+func (sp *SearchPager) nextPage() error {
+	result := new(SearchResult)
+	err := sp.conn.SearchWithHandler(sp.searchRequest, result, nil)
+	sp.PageCount++
+	sp.entries = result.Entries
+	sp.Controls = result.Controls
+	sp.Referrals = append(sp.Referrals, result.Referrals...)
+	if err != nil {
+		sp.done = true
+		return err
+	}
+
+	_, pagingResponse := FindControl(result.Controls, ControlTypePaging)
+	// If initial result and no paging control then server doesn't support paging
+	if pagingResponse == nil && sp.PageCount == 1 {
+		sp.done = true
+		return nil
+	} else if pagingResponse == nil {
+		sp.done = true
+		return NewLDAPError(ErrorMissingControl, "Expected paging Control, it was not found.")
+	}
+	sp.pagingControl.SetCookie(pagingResponse.(*ControlPaging).Cookie)
+	if len(sp.pagingControl.Cookie) == 0 {
+		sp.done = true
+	}
+	return nil
+}
+
+// Close stops the iteration. If the server still holds paging state a
+// request with a paging size of zero is sent to release it.
+func (sp *SearchPager) Close() error {
+	sp.entries = nil
+	if sp.done {
+		return nil
+	}
+	sp.done = true
+	if len(sp.pagingControl.Cookie) == 0 {
+		return nil
+	}
+	sp.pagingControl.PagingSize = 0
+	return sp.conn.SearchWithHandler(sp.searchRequest, new(SearchResult), nil)
+}
@@ -0,0 +1,106 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"fmt"
+	"github.com/mavricknz/asn1-ber"
+	"strconv"
+	"testing"
+)
+
+// pagingServer returns total entries in pages, the cookie is the offset of
+// the next page. Records the paging sizes requested.
+func pagingServer(total int, sizes *[]int) testHandler {
+	return func(request *ber.Packet) []*ber.Packet {
+		if request.Children[1].Tag != ApplicationSearchRequest {
+			return nil
+		}
+		var paging *ControlPaging
+		for _, c := range testRequestControls(request) {
+			control, err := NewControlPagingFromPacket(c)
+			if err == nil {
+				paging = control.(*ControlPaging)
+			}
+		}
+		start, _ := strconv.Atoi(string(paging.Cookie))
+		*sizes = append(*sizes, int(paging.PagingSize))
+
+		responses := make([]*ber.Packet, 0)
+		end := start + int(paging.PagingSize)
+		if end > total {
+			end = total
+		}
+		for i := start; i < end; i++ {
+			e := NewEntry(fmt.Sprintf("cn=%d,o=example", i))
+			e.AddAttributeValue("cn", strconv.Itoa(i))
+			responses = append(responses, testResponse(request, testEntry(e), nil))
+		}
+		cookie := ""
+		if end < total && paging.PagingSize > 0 {
+			cookie = strconv.Itoa(end)
+		}
+		responsePaging := &ControlPaging{Cookie: []byte(cookie)}
+		done := testResult(ApplicationSearchResultDone, LDAPResultSuccess, "")
+		return append(responses, testResponse(request, done, []Control{responsePaging}))
+	}
+}
+
+func TestSearchPager(t *testing.T) {
+	sizes := make([]int, 0)
+	l := newTestConnection(t, pagingServer(7, &sizes))
+	defer l.Close()
+
+	req := NewSimpleSearchRequest("o=example", ScopeWholeSubtree, "(cn=*)", nil)
+	pager := l.NewSearchPager(req, 3)
+	count := 0
+	for {
+		entry, err := pager.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.GetAttributeValues("cn")[0] != strconv.Itoa(count) {
+			t.Errorf("unexpected entry %s", entry.DN)
+		}
+		count++
+	}
+	if count != 7 || pager.PageCount != 3 {
+		t.Errorf("expected 7 entries in 3 pages, got %d in %d", count, pager.PageCount)
+	}
+	if len(req.Controls) != 0 {
+		t.Errorf("SearchRequest was modified")
+	}
+	if err := pager.Close(); err != nil {
+		t.Error(err)
+	}
+	if len(sizes) != 3 {
+		t.Errorf("unexpected requests after completion: %v", sizes)
+	}
+}
+
+func TestSearchPagerClose(t *testing.T) {
+	sizes := make([]int, 0)
+	l := newTestConnection(t, pagingServer(10, &sizes))
+	defer l.Close()
+
+	pager := l.NewSearchPager(NewSimpleSearchRequest("o=example", ScopeWholeSubtree, "(cn=*)", nil), 4)
+	for i := 0; i < 5; i++ {
+		if _, err := pager.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 3 || sizes[2] != 0 {
+		t.Errorf("expected a zero size release request, got %v", sizes)
+	}
+	if entry, err := pager.Next(); entry != nil || err != nil {
+		t.Errorf("expected no more entries after Close")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains client side sorting of search results, for servers that
+// ignore the Server Side Sort control, RFC 2891
+package ldap
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SortEntries sorts entries in place by sortKeys, as a server does for a
+// ControlServerSideSortRequest: by the first key, ties broken by the next.
+// The value of an entry for a key is its least value under the key's
+// OrderingRule, or the rule of the attribute set by SetAttributeMatchingRules
+// if there is none. Entries without a valid value sort after all others,
+// ReverseOrder reverses the order including these. The sort is stable. An
+// unknown OrderingRule is an error, entries are then not sorted.
+func SortEntries(entries []*Entry, sortKeys []ServerSideSortAttrRuleOrder) error {
+	rules := make([]MatchingRule, len(sortKeys))
+	for i, key := range sortKeys {
+		if len(key.OrderingRule) == 0 {
+			rules[i] = attributeMatchingRule(key.AttributeName)
+		} else if rules[i] = GetMatchingRule(key.OrderingRule); rules[i] == nil {
+			return NewLDAPError(LDAPResultInappropriateMatching, "Unknown ordering rule: "+key.OrderingRule)
+		}
+	}
+	s := entrySorter{entries, sortKeys, rules, make([][]sortKeyValue, len(entries))}
+	for i, entry := range entries {
+		s.values[i] = make([]sortKeyValue, len(sortKeys))
+		for k, key := range sortKeys {
+			s.values[i][k] = leastValue(rules[k], entry.GetAttributeValues(key.AttributeName))
+		}
+	}
+	sort.Stable(s)
+	return nil
+}
+
+// Sort sorts the entries of sr, see SortEntries.
+func (sr *SearchResult) Sort(sortKeys []ServerSideSortAttrRuleOrder) error {
+	return SortEntries(sr.Entries, sortKeys)
+}
+
+// sortKeyValue - the normalized value of an entry for a sort key, ok is
+// false if the entry has no valid value.
+type sortKeyValue struct {
+	value string
+	ok    bool
+}
+
+func leastValue(rule MatchingRule, values []string) (least sortKeyValue) {
+	for _, value := range values {
+		norm, err := rule.Normalize(value)
+		if err != nil {
+			continue
+		}
+		if !least.ok || rule.Compare(norm, least.value) < 0 {
+			least = sortKeyValue{norm, true}
+		}
+	}
+	return least
+}
+
+type entrySorter struct {
+	entries  []*Entry
+	sortKeys []ServerSideSortAttrRuleOrder
+	rules    []MatchingRule
+	values   [][]sortKeyValue
+}
+
+func (s entrySorter) Len() int {
+	return len(s.entries)
+}
+
+func (s entrySorter) Less(i, j int) bool {
+	for k, key := range s.sortKeys {
+		a, b := s.values[i][k], s.values[j][k]
+		c := 0
+		switch {
+		case !a.ok && !b.ok:
+		case !a.ok:
+			c = 1
+		case !b.ok:
+			c = -1
+		default:
+			c = s.rules[k].Compare(a.value, b.value)
+		}
+		if key.ReverseOrder {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+func (s entrySorter) Swap(i, j int) {
+	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+}
+
+// sortFallback sorts result if searchRequest asks for it with SortFallback
+// and a ControlServerSideSortRequest, and the server did not return a
+// successful ControlServerSideSortResponse.
+func (l *LDAPConnection) sortFallback(searchRequest *SearchRequest, result *SearchResult) error {
+	if !searchRequest.SortFallback {
+		return nil
+	}
+	_, request := FindControl(searchRequest.Controls, ControlTypeServerSideSortRequest)
+	if request == nil {
+		return nil
+	}
+	_, response := FindControl(result.Controls, ControlTypeServerSideSortResponse)
+	if response, ok := response.(*ControlServerSideSortResponse); ok && response.SortResult == LDAPResultSuccess {
+		return nil
+	}
+	if l.Debug {
+		fmt.Println("Server did not sort the results, sorting locally.")
+	}
+	return result.Sort(request.(*ControlServerSideSortRequest).SortKeyList)
+}
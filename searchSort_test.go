@@ -0,0 +1,117 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"github.com/mavricknz/asn1-ber"
+	"testing"
+)
+
+func testSortEntries() []*Entry {
+	entries := make([]*Entry, 0)
+	for _, values := range [][3]string{
+		{"c", "Smith", "10"},
+		{"a", "jones", "9"},
+		{"b", "", "100"},
+		{"d", "smith", "x"},
+		{"e", "Brown", ""},
+	} {
+		e := NewEntry("uid=" + values[0] + ",dc=example")
+		e.AddAttributeValue("uid", values[0])
+		if len(values[1]) > 0 {
+			e.AddAttributeValue("sn", values[1])
+		}
+		if len(values[2]) > 0 {
+			e.AddAttributeValue("uidNumber", values[2])
+		}
+		entries = append(entries, e)
+	}
+	entries[4].AddAttributeValue("uidNumber", "5")
+	entries[4].AddAttributeValue("uidNumber", "20")
+	return entries
+}
+
+func sortedUIDs(entries []*Entry) string {
+	uids := ""
+	for _, e := range entries {
+		uids += e.GetAttributeValues("uid")[0]
+	}
+	return uids
+}
+
+func TestSortEntries(t *testing.T) {
+	for _, test := range []struct {
+		sortKeys []ServerSideSortAttrRuleOrder
+		uids     string
+	}{
+		{[]ServerSideSortAttrRuleOrder{{AttributeName: "uid"}}, "abcde"},
+		{[]ServerSideSortAttrRuleOrder{{AttributeName: "uid", ReverseOrder: true}}, "edcba"},
+		// uidNumber is an integer, e sorts by its least value 5, d has none
+		{[]ServerSideSortAttrRuleOrder{{AttributeName: "uidNumber"}}, "eacbd"},
+		// as strings, e by "20"
+		{[]ServerSideSortAttrRuleOrder{{AttributeName: "uidNumber", OrderingRule: "caseIgnoreOrderingMatch"}}, "cbead"},
+		{[]ServerSideSortAttrRuleOrder{{AttributeName: "sn"}, {AttributeName: "uid", ReverseOrder: true}}, "eadcb"},
+		{[]ServerSideSortAttrRuleOrder{{AttributeName: "sn", ReverseOrder: true}, {AttributeName: "uid"}}, "bcdae"},
+		{nil, "cabde"},
+	} {
+		entries := testSortEntries()
+		if err := SortEntries(entries, test.sortKeys); err != nil {
+			t.Errorf("%v: %s", test.sortKeys, err)
+			continue
+		}
+		if uids := sortedUIDs(entries); uids != test.uids {
+			t.Errorf("%v: expected %s, got %s", test.sortKeys, test.uids, uids)
+		}
+	}
+
+	entries := testSortEntries()
+	err := SortEntries(entries, []ServerSideSortAttrRuleOrder{{AttributeName: "uid", OrderingRule: "1.2.3.4"}})
+	if err == nil || err.(*LDAPError).ResultCode != LDAPResultInappropriateMatching || sortedUIDs(entries) != "cabde" {
+		t.Errorf("expected an inappropriate matching error, got %v", err)
+	}
+}
+
+func TestSearchSortFallback(t *testing.T) {
+	sortKeys := []ServerSideSortAttrRuleOrder{{AttributeName: "uid"}}
+	for _, test := range []struct {
+		response     Control
+		sortFallback bool
+		uids         string
+	}{
+		{nil, true, "abcde"},
+		{nil, false, "cabde"},
+		{&ControlServerSideSortResponse{SortResult: LDAPResultSuccess}, true, "cabde"},
+		{&ControlServerSideSortResponse{SortResult: LDAPResultUnwillingToPerform}, true, "abcde"},
+	} {
+		var controls []Control
+		if test.response != nil {
+			controls = []Control{test.response}
+		}
+		l := newTestConnection(t, func(request *ber.Packet) []*ber.Packet {
+			responses := make([]*ber.Packet, 0)
+			for _, e := range testSortEntries() {
+				responses = append(responses, testResponse(request, testEntry(e), nil))
+			}
+			done := testResult(ApplicationSearchResultDone, LDAPResultSuccess, "")
+			return append(responses, testResponse(request, done, controls))
+		})
+		req := NewSimpleSearchRequest("dc=example", ScopeWholeSubtree, "(uid=*)", nil)
+		req.AddControl(NewControlServerSideSortRequest(sortKeys, false))
+		req.SortFallback = test.sortFallback
+		sr, err := l.Search(req)
+		l.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uids := sortedUIDs(sr.Entries); uids != test.uids {
+			t.Errorf("%v fallback %t: expected %s, got %s", test.response, test.sortFallback, test.uids, uids)
+		}
+	}
+
+	sr := &SearchResult{Entries: testSortEntries()}
+	if err := sr.Sort(sortKeys); err != nil || sortedUIDs(sr.Entries) != "abcde" {
+		t.Errorf("SearchResult.Sort: %v %s", err, sortedUIDs(sr.Entries))
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"github.com/mavricknz/asn1-ber"
+	"net"
+	"testing"
+)
+
+// testHandler is given each request received by the test server and returns
+// the response messages to send, built with testResponse.
+type testHandler func(request *ber.Packet) []*ber.Packet
+
+// newTestConnection returns a connected LDAPConnection talking to an in
+// process server over a net.Pipe. handler answers the requests.
+func newTestConnection(t *testing.T, handler testHandler) *LDAPConnection {
+	client, server := net.Pipe()
+	go testServe(server, handler)
+	l := &LDAPConnection{conn: client}
+	if err := l.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// newTestListener starts a test server on a local TCP port, for tests that
+// need to dial e.g. referrals. Returns the address, close the listener when done.
+func newTestListener(t *testing.T, handler testHandler) (string, net.Listener) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go testServe(conn, handler)
+		}
+	}()
+	return listener.Addr().String(), listener
+}
+
+func testServe(conn net.Conn, handler testHandler) {
+	defer conn.Close()
+	for {
+		request, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		for _, response := range handler(request) {
+			if _, err := conn.Write(response.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// testResponse builds an LDAPMessage answering request.
+func testResponse(request *ber.Packet, op *ber.Packet, controls []Control) *ber.Packet {
+	p, err := requestBuildPacket(request.Children[0].Value.(uint64), op, controls)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// testResult builds an LDAPResult for application, e.g. ApplicationSearchResultDone.
+func testResult(application uint8, resultCode uint8, diagnosticMessage string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, application, nil, ApplicationMap[application])
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimative, ber.TagEnumerated, uint64(resultCode), "resultCode"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, "", "matchedDN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, diagnosticMessage, "diagnosticMessage"))
+	return p
+}
+
+// testReferralResult builds an LDAPResult with resultCode referral.
+func testReferralResult(application uint8, referrals ...string) *ber.Packet {
+	p := testResult(application, LDAPResultReferral, "")
+	refs := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, nil, "Referral")
+	for _, r := range referrals {
+		refs.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, r, "URI"))
+	}
+	p.AppendChild(refs)
+	return p
+}
+
+// testEntry builds a SearchResultEntry from e.
+func testEntry(e *Entry) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationSearchResultEntry, nil, "Search Result Entry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, e.DN, "Object Name"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, attr := range e.Attributes {
+		a := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, attr.Name, "Attribute Name"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Attribute Values")
+		for _, v := range attr.Values {
+			values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimative, ber.TagOctetString, v, "Attribute Value"))
+		}
+		a.AppendChild(values)
+		attrs.AppendChild(a)
+	}
+	p.AppendChild(attrs)
+	return p
+}
+
+// testRequestControls returns the Control packets sent with a request.
+func testRequestControls(request *ber.Packet) []*ber.Packet {
+	if len(request.Children) < 3 {
+		return nil
+	}
+	return request.Children[2].Children
+}
+
+// newTestMessageIDPacket is a request with message ID 1 for testResponse.
+func newTestMessageIDPacket() *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimative, ber.TagInteger, 1, "MessageID"))
+	return p
+}
@@ -0,0 +1,120 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// File contains a Virtual List View browser
+package ldap
+
+import (
+	"fmt"
+)
+
+// VlvBrowser scrolls through the sorted results of a search using the
+// Virtual List View and Server Side Sort controls. The ContextID returned by
+// the server is sent with each following request and ContentCount and
+// TargetPosition are updated from every VlvResponse.
+//
+//	vb := NewVlvBrowser(l, NewSimpleSearchRequest(base, ScopeWholeSubtree, "(objectclass=person)", attrs),
+//		[]ServerSideSortAttrRuleOrder{{AttributeName: "cn"}})
+//	page, err := vb.Page(1, 20)        // entries 1..20
+//	page, err = vb.Seek("Smith", 20)   // 20 entries from the first cn >= "Smith"
+//
+// A VlvBrowser is not safe for concurrent use.
+type VlvBrowser struct {
+	Conn          *LDAPConnection
+	SearchRequest *SearchRequest
+	SortKeyList   []ServerSideSortAttrRuleOrder
+
+	ContextID      []byte
+	ContentCount   uint64 // from the last VlvResponse
+	TargetPosition uint64 // from the last VlvResponse
+}
+
+// NewVlvBrowser returns a browser bound to the base, scope, filter and
+// attributes of searchRequest, sorted by sortKeyList. searchRequest is not
+// modified, any Server Side Sort or VLV controls in it are replaced and a
+// paging control is dropped, servers refuse paging combined with VLV.
+func NewVlvBrowser(conn *LDAPConnection, searchRequest *SearchRequest, sortKeyList []ServerSideSortAttrRuleOrder) *VlvBrowser {
+	return &VlvBrowser{
+		Conn:          conn,
+		SearchRequest: searchRequest,
+		SortKeyList:   sortKeyList,
+	}
+}
+
+// Page returns count entries starting at offset, offsets start at 1.
+func (vb *VlvBrowser) Page(offset, count int32) (*SearchResult, error) {
+	if offset < 1 || count < 1 {
+		return nil, NewLDAPError(ErrorInvalidArgument,
+			fmt.Sprintf("VLV offset and count must be > 0, offset: %d, count: %d", offset, count))
+	}
+	vlv := &ControlVlvRequest{
+		Criticality: true,
+		BeforeCount: 0,
+		AfterCount:  count - 1,
+		ByOffset:    &VlvOffSet{Offset: offset, ContentCount: int32(vb.ContentCount)},
+	}
+	return vb.search(vlv)
+}
+
+// Seek returns count entries starting at the first entry whose sort key is
+// greater than or equal to value.
+func (vb *VlvBrowser) Seek(value string, count int32) (*SearchResult, error) {
+	if len(value) == 0 || count < 1 {
+		return nil, NewLDAPError(ErrorInvalidArgument, "VLV seek requires a value and a count > 0")
+	}
+	vlv := &ControlVlvRequest{
+		Criticality:        true,
+		BeforeCount:        0,
+		AfterCount:         count - 1,
+		GreaterThanOrEqual: value,
+	}
+	return vb.search(vlv)
+}
+
+func (vb *VlvBrowser) search(vlv *ControlVlvRequest) (*SearchResult, error) {
+	vlv.ContextID = vb.ContextID
+	result, err := vb.Conn.Search(vb.buildSearchRequest(vlv))
+	if err != nil {
+		return result, err
+	}
+	if err := vb.update(result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// buildSearchRequest copies the bound SearchRequest adding the sort and vlv
+// controls, without paging.
+func (vb *VlvBrowser) buildSearchRequest(vlv *ControlVlvRequest) *SearchRequest {
+	req := *vb.SearchRequest
+	req.Controls = make([]Control, 0, len(vb.SearchRequest.Controls)+2)
+	for _, c := range vb.SearchRequest.Controls {
+		switch c.GetControlType() {
+		case ControlTypeServerSideSortRequest, ControlTypeVlvRequest, ControlTypePaging:
+			continue
+		}
+		req.Controls = append(req.Controls, c)
+	}
+	req.AddControl(NewControlServerSideSortRequest(vb.SortKeyList, true))
+	req.AddControl(vlv)
+	return &req
+}
+
+// update records the position, count and contextID from the VlvResponse.
+func (vb *VlvBrowser) update(result *SearchResult) error {
+	_, c := FindControl(result.Controls, ControlTypeVlvResponse)
+	if c == nil {
+		return NewLDAPError(ErrorMissingControl, "Expected VlvResponse Control, it was not found.")
+	}
+	vlvResponse := c.(*ControlVlvResponse)
+	if err := vlvResponse.VlvError(); err != nil {
+		return err
+	}
+	vb.TargetPosition = vlvResponse.TargetPosition
+	vb.ContentCount = vlvResponse.ContentCount
+	if len(vlvResponse.ContextID) > 0 {
+		vb.ContextID = []byte(vlvResponse.ContextID)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ package ldap
 
 import (
 	"fmt"
+	"github.com/mavricknz/asn1-ber"
 	"testing"
 )
 
@@ -43,3 +44,134 @@ func TestVlvRequest(t *testing.T) {
 	}
 	fmt.Println("TestVlvRequest finsished.")
 }
+
+func TestVlvBrowser(t *testing.T) {
+	fmt.Println("TestVlvBrowser starting...")
+	paging := NewControlPaging(10)
+	req := NewSimpleSearchRequest("o=example", ScopeWholeSubtree, "(objectclass=person)", []string{"cn"})
+	req.AddControl(paging)
+	req.AddControl(&ControlVlvRequest{ByOffset: &VlvOffSet{Offset: 5}})
+	req.AddControl(NewControlManageDsaITRequest(false))
+
+	vb := NewVlvBrowser(nil, req, []ServerSideSortAttrRuleOrder{{AttributeName: "cn"}})
+	vb.ContextID = []byte("ctx")
+	vlv := &ControlVlvRequest{AfterCount: 9, ByOffset: &VlvOffSet{Offset: 1}, ContextID: vb.ContextID}
+	vlvReq := vb.buildSearchRequest(vlv)
+
+	if len(req.Controls) != 3 {
+		t.Errorf("bound SearchRequest was modified: %v", req.Controls)
+	}
+	if len(vlvReq.Controls) != 3 {
+		t.Fatalf("expected 3 controls got %d", len(vlvReq.Controls))
+	}
+	if _, c := FindControl(vlvReq.Controls, ControlTypePaging); c != nil {
+		t.Errorf("paging control sent with vlv")
+	}
+	if _, c := FindControl(vlvReq.Controls, ControlTypeManageDsaITRequest); c == nil {
+		t.Errorf("other controls not kept")
+	}
+	if _, c := FindControl(vlvReq.Controls, ControlTypeVlvRequest); c != vlv {
+		t.Errorf("vlv request control not found")
+	}
+	if _, c := FindControl(vlvReq.Controls, ControlTypeServerSideSortRequest); c == nil {
+		t.Errorf("server side sort control not found")
+	}
+	if _, err := encodeSearchRequest(vlvReq); err != nil {
+		t.Error(err)
+	}
+
+	result := &SearchResult{Controls: []Control{&ControlVlvResponse{
+		TargetPosition: 1, ContentCount: 42, ContextID: "ctx2",
+	}}}
+	if err := vb.update(result); err != nil {
+		t.Fatal(err)
+	}
+	if vb.ContentCount != 42 || vb.TargetPosition != 1 || string(vb.ContextID) != "ctx2" {
+		t.Errorf("VlvBrowser not updated: %d %d %q", vb.ContentCount, vb.TargetPosition, vb.ContextID)
+	}
+
+	result.Controls[0].(*ControlVlvResponse).VlvResult = VlvResultOffsetRangeError
+	if err := vb.update(result); err == nil {
+		t.Errorf("expected offsetRangeError")
+	}
+	if err := vb.update(&SearchResult{}); err == nil {
+		t.Errorf("expected missing control error")
+	}
+	fmt.Println("TestVlvBrowser finished.")
+}
+
+func TestVlvBrowserPageSeek(t *testing.T) {
+	// each response moves the position and count on and returns a new
+	// contextID, the last VlvRequest is recorded
+	var sent *ControlVlvRequest
+	var paged bool
+	responses := []*ControlVlvResponse{
+		{TargetPosition: 1, ContentCount: 42, ContextID: "c1"},
+		{TargetPosition: 20, ContentCount: 41, ContextID: "c2"},
+		{TargetPosition: 5, ContentCount: 41},
+	}
+	l := newTestConnection(t, func(request *ber.Packet) []*ber.Packet {
+		if request.Children[1].Tag != ApplicationSearchRequest {
+			return nil
+		}
+		for _, p := range testRequestControls(request) {
+			c, err := DecodeControl(p)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			switch c := c.(type) {
+			case *ControlVlvRequest:
+				sent = c
+			case *ControlPaging:
+				paged = true
+			}
+		}
+		response := responses[0]
+		responses = responses[1:]
+		e := NewEntry("cn=a,o=example")
+		e.AddAttributeValue("cn", "a")
+		return []*ber.Packet{
+			testResponse(request, testEntry(e), nil),
+			testResponse(request, testResult(ApplicationSearchResultDone, LDAPResultSuccess, ""), []Control{response}),
+		}
+	})
+	defer l.Close()
+
+	req := NewSimpleSearchRequest("o=example", ScopeWholeSubtree, "(objectclass=person)", []string{"cn"})
+	req.AddControl(NewControlPaging(10))
+	vb := NewVlvBrowser(l, req, []ServerSideSortAttrRuleOrder{{AttributeName: "cn"}})
+
+	if _, err := vb.Page(1, 20); err != nil {
+		t.Fatal(err)
+	}
+	if sent == nil || sent.ByOffset == nil || sent.ByOffset.Offset != 1 || len(sent.ContextID) != 0 || sent.AfterCount != 19 {
+		t.Fatalf("unexpected first VlvRequest %v", sent)
+	}
+	if vb.TargetPosition != 1 || vb.ContentCount != 42 || string(vb.ContextID) != "c1" {
+		t.Errorf("Page did not update: %d %d %q", vb.TargetPosition, vb.ContentCount, vb.ContextID)
+	}
+
+	if _, err := vb.Seek("Smith", 20); err != nil {
+		t.Fatal(err)
+	}
+	if sent.GreaterThanOrEqual != "Smith" || string(sent.ContextID) != "c1" {
+		t.Errorf("Seek sent %q contextID %q", sent.GreaterThanOrEqual, sent.ContextID)
+	}
+	if vb.TargetPosition != 20 || vb.ContentCount != 41 || string(vb.ContextID) != "c2" {
+		t.Errorf("Seek did not update: %d %d %q", vb.TargetPosition, vb.ContentCount, vb.ContextID)
+	}
+
+	if _, err := vb.Page(5, 20); err != nil {
+		t.Fatal(err)
+	}
+	if sent.ByOffset.Offset != 5 || sent.ByOffset.ContentCount != 41 || string(sent.ContextID) != "c2" {
+		t.Errorf("Page sent offset %d count %d contextID %q", sent.ByOffset.Offset, sent.ByOffset.ContentCount, sent.ContextID)
+	}
+	if vb.TargetPosition != 5 || string(vb.ContextID) != "c2" {
+		t.Errorf("contextID not kept when the server returns none: %q", vb.ContextID)
+	}
+	if paged {
+		t.Errorf("paging control sent with vlv")
+	}
+}